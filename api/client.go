@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"runtime"
+	"strings"
 
 	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
@@ -96,7 +97,9 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		reqBody = bytes.NewReader(data)
 	}
 
+	path, query, _ := strings.Cut(path, "?")
 	requestURL := c.base.JoinPath(path)
+	requestURL.RawQuery = query
 	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
 	if err != nil {
 		return err
@@ -250,6 +253,30 @@ func (c *Client) Pull(ctx context.Context, req *PullRequest, fn PullProgressFunc
 	})
 }
 
+// ListPulls lists pulls which haven't finished, including paused pulls.
+func (c *Client) ListPulls(ctx context.Context) (*ListPullsResponse, error) {
+	var resp ListPullsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/pulls", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PausePull stops a pull, keeping what's been downloaded so it can be resumed.
+func (c *Client) PausePull(ctx context.Context, req *PullsRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/pulls/pause", req, nil)
+}
+
+// ResumePull resumes a paused pull in the background.
+func (c *Client) ResumePull(ctx context.Context, req *PullsRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/pulls/resume", req, nil)
+}
+
+// CancelPull stops a pull and removes what's been downloaded.
+func (c *Client) CancelPull(ctx context.Context, req *PullsRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/pulls/cancel", req, nil)
+}
+
 // PushProgressFunc is a function that [Client.Push] invokes when progress is
 // made.
 // It's similar to other progress function types like [PullProgressFunc].
@@ -298,6 +325,25 @@ func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	return &lr, nil
 }
 
+// ListFiltered lists models that are available locally and match every
+// filter, e.g. "label=owner=search-team" or "quantization=Q4_0".
+func (c *Client) ListFiltered(ctx context.Context, filters ...string) (*ListResponse, error) {
+	var lr ListResponse
+	if err := c.do(ctx, http.MethodGet, "/api/tags?"+url.Values{"filter": filters}.Encode(), nil, &lr); err != nil {
+		return nil, err
+	}
+	return &lr, nil
+}
+
+// Labels sets the labels of a model. Labels set to an empty value are
+// removed.
+func (c *Client) Labels(ctx context.Context, req *LabelsRequest) error {
+	if err := c.do(ctx, http.MethodPost, "/api/labels", req, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
 // ListRunning lists running models.
 func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	var lr ProcessResponse
@@ -307,6 +353,25 @@ func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
 	return &lr, nil
 }
 
+// Storage reports the space used by the model store.
+func (c *Client) Storage(ctx context.Context) (*StorageResponse, error) {
+	var resp StorageResponse
+	if err := c.do(ctx, http.MethodGet, "/api/storage", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GC removes blobs which aren't used by any model or pull, and partial
+// downloads which won't be resumed.
+func (c *Client) GC(ctx context.Context, req *GCRequest) (*GCResponse, error) {
+	var resp GCResponse
+	if err := c.do(ctx, http.MethodPost, "/api/gc", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Copy copies a model - creating a model with another name from an existing
 // model.
 func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
@@ -316,6 +381,39 @@ func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
 	return nil
 }
 
+// Alias points an alias to a model, replacing the model it pointed to.
+func (c *Client) Alias(ctx context.Context, req *AliasRequest) error {
+	if err := c.do(ctx, http.MethodPost, "/api/alias", req, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Move moves a model to another model store.
+func (c *Client) Move(ctx context.Context, req *MoveRequest) error {
+	if err := c.do(ctx, http.MethodPost, "/api/move", req, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Login verifies credentials for a registry and stores them so models can be
+// pushed to and pulled from it.
+func (c *Client) Login(ctx context.Context, req *LoginRequest) error {
+	if err := c.do(ctx, http.MethodPost, "/api/login", req, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Logout removes the stored credentials for a registry.
+func (c *Client) Logout(ctx context.Context, req *LogoutRequest) error {
+	if err := c.do(ctx, http.MethodPost, "/api/logout", req, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
 // Delete deletes a model and its data.
 func (c *Client) Delete(ctx context.Context, req *DeleteRequest) error {
 	if err := c.do(ctx, http.MethodDelete, "/api/delete", req, nil); err != nil {
@@ -351,6 +449,35 @@ func (c *Client) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse,
 	return &resp, nil
 }
 
+// Tokenize returns the tokens a model splits a prompt into.
+func (c *Client) Tokenize(ctx context.Context, req *TokenizeRequest) (*TokenizeResponse, error) {
+	var resp TokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/tokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Inspect returns the metadata, tensors and estimated memory of a GGUF file or
+// safetensors model on the server without creating a model from it.
+func (c *Client) Inspect(ctx context.Context, req *InspectRequest) (*InspectResponse, error) {
+	var resp InspectResponse
+	if err := c.do(ctx, http.MethodPost, "/api/inspect", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Estimate estimates the memory a model needs to be loaded with the given
+// options without loading it.
+func (c *Client) Estimate(ctx context.Context, req *EstimateRequest) (*EstimateResponse, error) {
+	var resp EstimateResponse
+	if err := c.do(ctx, http.MethodPost, "/api/estimate", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Embeddings generates an embedding from a model.
 func (c *Client) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
 	var resp EmbeddingResponse
@@ -7,6 +7,7 @@ import (
 	"math"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -231,17 +232,55 @@ type Options struct {
 
 // Runner options which must be set when the model is loaded into memory
 type Runner struct {
-	NumCtx    int   `json:"num_ctx,omitempty"`
-	NumBatch  int   `json:"num_batch,omitempty"`
-	NumGPU    int   `json:"num_gpu,omitempty"`
-	MainGPU   int   `json:"main_gpu,omitempty"`
-	LowVRAM   bool  `json:"low_vram,omitempty"`
-	F16KV     bool  `json:"f16_kv,omitempty"`
-	LogitsAll bool  `json:"logits_all,omitempty"`
-	VocabOnly bool  `json:"vocab_only,omitempty"`
-	UseMMap   *bool `json:"use_mmap,omitempty"`
-	UseMLock  bool  `json:"use_mlock,omitempty"`
-	NumThread int   `json:"num_thread,omitempty"`
+	NumCtx             int     `json:"num_ctx,omitempty"`
+	NumBatch           int     `json:"num_batch,omitempty"`
+	NumGPU             int     `json:"num_gpu,omitempty"`
+	MainGPU            int     `json:"main_gpu,omitempty"`
+	LowVRAM            bool    `json:"low_vram,omitempty"`
+	F16KV              bool    `json:"f16_kv,omitempty"`
+	CacheTypeK         string  `json:"cache_type_k,omitempty"`
+	CacheTypeV         string  `json:"cache_type_v,omitempty"`
+	RopeScalingType    string  `json:"rope_scaling_type,omitempty"`
+	RopeFrequencyBase  float32 `json:"rope_frequency_base,omitempty"`
+	RopeFrequencyScale float32 `json:"rope_frequency_scale,omitempty"`
+	YarnExtFactor      float32 `json:"yarn_ext_factor,omitempty"`
+	YarnAttnFactor     float32 `json:"yarn_attn_factor,omitempty"`
+	YarnBetaFast       float32 `json:"yarn_beta_fast,omitempty"`
+	YarnBetaSlow       float32 `json:"yarn_beta_slow,omitempty"`
+	LogitsAll          bool    `json:"logits_all,omitempty"`
+	VocabOnly          bool    `json:"vocab_only,omitempty"`
+	UseMMap            *bool   `json:"use_mmap,omitempty"`
+	UseMLock           bool    `json:"use_mlock,omitempty"`
+	NumThread          int     `json:"num_thread,omitempty"`
+}
+
+// CacheTypes are the types the K and V caches can be stored as. The quantized
+// types use less memory for long contexts at some cost to quality.
+var CacheTypes = []string{"f32", "f16", "q8_0", "q5_1", "q5_0", "iq4_nl", "q4_1", "q4_0"}
+
+// RopeScalingTypes are the ways the RoPE frequencies can be scaled to run a
+// model past the context length it was trained with.
+var RopeScalingTypes = []string{"none", "linear", "yarn"}
+
+// validateOption checks the value of an option which only accepts some
+// values of its type. Numbers are given as float64.
+func validateOption(key string, val any) error {
+	switch key {
+	case "cache_type_k", "cache_type_v":
+		if s, ok := val.(string); ok && !slices.Contains(CacheTypes, s) {
+			return fmt.Errorf("option %q must be one of %s", key, strings.Join(CacheTypes, ", "))
+		}
+	case "rope_scaling_type":
+		if s, ok := val.(string); ok && !slices.Contains(RopeScalingTypes, s) {
+			return fmt.Errorf("option %q must be one of %s", key, strings.Join(RopeScalingTypes, ", "))
+		}
+	case "rope_frequency_base", "rope_frequency_scale", "yarn_attn_factor", "yarn_beta_fast", "yarn_beta_slow":
+		if f, ok := val.(float64); ok && f < 0 {
+			return fmt.Errorf("option %q must not be negative", key)
+		}
+	}
+
+	return nil
 }
 
 // EmbedRequest is the request passed to [Client.Embed].
@@ -293,6 +332,31 @@ type EmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
+// TokenizeRequest is the request passed to [Client.Tokenize].
+type TokenizeRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// Prompt is the text to tokenize.
+	Prompt string `json:"prompt"`
+
+	// KeepAlive controls how long the model will stay loaded in memory following
+	// this request.
+	KeepAlive *Duration `json:"keep_alive,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]interface{} `json:"options"`
+}
+
+// TokenizeResponse is the response from [Client.Tokenize].
+type TokenizeResponse struct {
+	Model  string `json:"model"`
+	Tokens []int  `json:"tokens"`
+
+	// NumCtx is the size of the context window the model is loaded with.
+	NumCtx int `json:"num_ctx"`
+}
+
 // CreateRequest is the request passed to [Client.Create].
 type CreateRequest struct {
 	Model     string `json:"model"`
@@ -300,6 +364,13 @@ type CreateRequest struct {
 	Stream    *bool  `json:"stream,omitempty"`
 	Quantize  string `json:"quantize,omitempty"`
 
+	// Imatrix is the digest of an importance matrix blob to quantize with
+	Imatrix string `json:"imatrix,omitempty"`
+
+	// Calibration is the digest of a text blob to compute an importance
+	// matrix from
+	Calibration string `json:"calibration,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 
@@ -329,6 +400,10 @@ type ShowRequest struct {
 
 	Options map[string]interface{} `json:"options"`
 
+	// Diff is the name of a model to compare the model with. The
+	// differences are returned in [ShowResponse.Diff].
+	Diff string `json:"diff,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 }
@@ -344,7 +419,122 @@ type ShowResponse struct {
 	Messages      []Message      `json:"messages,omitempty"`
 	ModelInfo     map[string]any `json:"model_info,omitempty"`
 	ProjectorInfo map[string]any `json:"projector_info,omitempty"`
+	Vision        *VisionInfo    `json:"vision,omitempty"`
 	ModifiedAt    time.Time      `json:"modified_at,omitempty"`
+	Diff          *ModelDiff     `json:"diff,omitempty"`
+}
+
+// ModelDiff is how a model has changed from the model it's compared with in
+// [ShowRequest.Diff].
+type ModelDiff struct {
+	// Model is the model compared with
+	Model   string        `json:"model"`
+	Changes []ModelChange `json:"changes"`
+}
+
+// ModelChange is a change to a part of a model. Section is one of
+// "modelfile", "template", "system", "parameters", "adapters", "layers" or
+// "model_info". Key is the parameter, layer media type or metadata key for
+// the sections which have them. From or To is missing if the part was added
+// or removed.
+type ModelChange struct {
+	Section string `json:"section"`
+	Key     string `json:"key,omitempty"`
+	From    any    `json:"from,omitempty"`
+	To      any    `json:"to,omitempty"`
+}
+
+// InspectRequest is the request passed to [Client.Inspect].
+type InspectRequest struct {
+	// Path is the GGUF file or safetensors model directory to inspect. It's
+	// a path on the server.
+	Path    string `json:"path"`
+	Verbose bool   `json:"verbose"`
+
+	// Options are the model parameters, such as num_ctx, used to estimate
+	// the memory the model needs
+	Options map[string]interface{} `json:"options"`
+}
+
+// InspectResponse is the response returned from [Client.Inspect].
+type InspectResponse struct {
+	// Format is gguf, or safetensors for a model which is shown as it will be
+	// once it's converted
+	Format         string          `json:"format"`
+	ParameterCount uint64          `json:"parameter_count"`
+	ModelInfo      map[string]any  `json:"model_info"`
+	Tensors        []TensorInfo    `json:"tensors"`
+	TemplateName   string          `json:"template_name,omitempty"`
+	Template       string          `json:"template,omitempty"`
+	Memory         *MemoryEstimate `json:"memory,omitempty"`
+}
+
+// TensorInfo describes a tensor of a model.
+type TensorInfo struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Shape []uint64 `json:"shape"`
+}
+
+// MemoryEstimate is how much memory a model is estimated to need and how many
+// of its layers fit on the GPUs.
+type MemoryEstimate struct {
+	Library     string          `json:"library"`
+	NumCtx      int             `json:"num_ctx"`
+	NumParallel int             `json:"num_parallel"`
+	Layers      int             `json:"layers"`
+	TotalLayers int             `json:"total_layers"`
+	Graph       uint64          `json:"graph"`
+	KVSize      uint64          `json:"kv_size"`
+	VRAMSize    uint64          `json:"vram_size"`
+	TotalSize   uint64          `json:"total_size"`
+	GPUs        []GPUAllocation `json:"gpus,omitempty"`
+
+	// MaxNumCtx is the largest context length of each request which fits
+	// fully on the GPUs, or in system memory when running on the CPU
+	MaxNumCtx int `json:"max_num_ctx"`
+}
+
+// GPUAllocation is the part of a model estimated to be loaded on a GPU.
+type GPUAllocation struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	FreeMemory uint64 `json:"free_memory"`
+	Size       uint64 `json:"size"`
+	Layers     int    `json:"layers"`
+}
+
+// EstimateRequest is the request passed to [Client.Estimate].
+type EstimateRequest struct {
+	// Model is the model name.
+	Model string `json:"model"`
+
+	// NumParallel is the number of requests the model is loaded to handle in
+	// parallel. It defaults to OLLAMA_NUM_PARALLEL.
+	NumParallel int `json:"num_parallel,omitempty"`
+
+	// Options lists model-specific options.
+	Options map[string]interface{} `json:"options"`
+}
+
+// EstimateResponse is the response from [Client.Estimate].
+type EstimateResponse struct {
+	Model string `json:"model"`
+	MemoryEstimate
+}
+
+// VisionInfo describes how a multimodal model preprocesses images and how
+// much of the context window each image occupies.
+type VisionInfo struct {
+	ProjectorType  string      `json:"projector_type,omitempty"`
+	ImageSize      uint64      `json:"image_size,omitempty"`
+	PatchSize      uint64      `json:"patch_size,omitempty"`
+	ImageMean      []float32   `json:"image_mean,omitempty"`
+	ImageStd       []float32   `json:"image_std,omitempty"`
+	GridPinpoints  [][2]uint64 `json:"grid_pinpoints,omitempty"`
+	PatchMergeType string      `json:"patch_merge_type,omitempty"`
+	MaxTiles       uint64      `json:"max_tiles,omitempty"`
+	TokensPerImage uint64      `json:"tokens_per_image,omitempty"`
 }
 
 // CopyRequest is the request passed to [Client.Copy].
@@ -353,6 +543,34 @@ type CopyRequest struct {
 	Destination string `json:"destination"`
 }
 
+// LabelsRequest is the request passed to [Client.Labels].
+type LabelsRequest struct {
+	Model string `json:"model"`
+
+	// Labels are the labels to set. A label set to an empty value is
+	// removed, and labels which aren't set are left as they are.
+	Labels map[string]string `json:"labels"`
+}
+
+// AliasRequest is the request passed to [Client.Alias].
+type AliasRequest struct {
+	// Alias is the name which points to Target
+	Alias string `json:"alias"`
+
+	// Target is the model Alias points to. It must be a model, not another
+	// alias.
+	Target string `json:"target"`
+}
+
+// MoveRequest is the request passed to [Client.Move].
+type MoveRequest struct {
+	Model string `json:"model"`
+
+	// Store is the model store to move the model to. It must be one of the
+	// directories in OLLAMA_MODELS.
+	Store string `json:"store"`
+}
+
 // PullRequest is the request passed to [Client.Pull].
 type PullRequest struct {
 	Model    string `json:"model"`
@@ -361,10 +579,38 @@ type PullRequest struct {
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// MaxRate is the maximum download rate of the pull in bytes per second
+	MaxRate int64 `json:"max_rate,omitempty"`
+
+	// Store is the model store to pull the model to. It must be one of the
+	// directories in OLLAMA_MODELS.
+	Store string `json:"store,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 }
 
+// PullsRequest is the request passed to [Client.PausePull],
+// [Client.ResumePull] and [Client.CancelPull].
+type PullsRequest struct {
+	Model string `json:"model"`
+}
+
+// ListPullsResponse is the response from [Client.ListPulls].
+type ListPullsResponse struct {
+	Pulls []PullStatus `json:"pulls"`
+}
+
+// PullStatus is the progress of a pull which hasn't finished. Status is
+// "pulling" or "paused".
+type PullStatus struct {
+	Model     string `json:"model"`
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	MaxRate   int64  `json:"max_rate,omitempty"`
+}
+
 // ProgressResponse is the response passed to progress functions like
 // [PullProgressFunc] and [PushProgressFunc].
 type ProgressResponse struct {
@@ -382,15 +628,87 @@ type PushRequest struct {
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
 
+	// Sign pushes a signature of the model's manifest, made with the
+	// server's Ollama key, along with the model.
+	Sign bool `json:"sign,omitempty"`
+
 	// Deprecated: set the model name with Model instead
 	Name string `json:"name"`
 }
 
+// LoginRequest is the request passed to [Client.Login].
+type LoginRequest struct {
+	// Registry is the host of the registry to log in to, e.g. ghcr.io.
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+
+	// Password is the password or access token of the user.
+	Password string `json:"password"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// LogoutRequest is the request passed to [Client.Logout].
+type LogoutRequest struct {
+	Registry string `json:"registry"`
+}
+
 // ListResponse is the response from [Client.List].
 type ListResponse struct {
 	Models []ListModelResponse `json:"models"`
 }
 
+// StorageResponse is the response from [Client.Storage].
+type StorageResponse struct {
+	// Path is the directory models are stored in. If there are several
+	// model stores they're separated as they are in OLLAMA_MODELS.
+	Path string `json:"path"`
+
+	// Size is the size of every blob in the store, including partial
+	// downloads
+	Size int64 `json:"size"`
+
+	Models []ModelStorage `json:"models"`
+
+	// Orphaned are blobs which aren't used by any model or pull
+	Orphaned []BlobStorage `json:"orphaned"`
+
+	// Partial are blobs which are partially downloaded
+	Partial []BlobStorage `json:"partial"`
+}
+
+// ModelStorage is the space used by a model in [StorageResponse]. Blobs used
+// by several models are counted as shared by each of them.
+type ModelStorage struct {
+	Name      string `json:"name"`
+	Store     string `json:"store"`
+	Size      int64  `json:"size"`
+	Exclusive int64  `json:"exclusive"`
+	Shared    int64  `json:"shared"`
+}
+
+// BlobStorage is a blob in [StorageResponse] and [GCResponse].
+type BlobStorage struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+
+	// Pull is the model a partial download is being pulled for, if any
+	Pull string `json:"pull,omitempty"`
+}
+
+// GCRequest is the request passed to [Client.GC].
+type GCRequest struct {
+	// DryRun reports what would be removed without removing it
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// GCResponse is the response from [Client.GC].
+type GCResponse struct {
+	Removed []BlobStorage `json:"removed"`
+
+	// Size is the space reclaimed, or which would be with DryRun
+	Size int64 `json:"size"`
+}
+
 // ProcessResponse is the response from [Client.Process].
 type ProcessResponse struct {
 	Models []ProcessModelResponse `json:"models"`
@@ -404,6 +722,12 @@ type ListModelResponse struct {
 	Size       int64        `json:"size"`
 	Digest     string       `json:"digest"`
 	Details    ModelDetails `json:"details,omitempty"`
+
+	// Labels are user defined key=value metadata of the model
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Target is the model an alias points to
+	Target string `json:"target,omitempty"`
 }
 
 // ProcessModelResponse is a single model description in [ProcessResponse].
@@ -539,12 +863,18 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 				if !ok {
 					return fmt.Errorf("option %q must be of type float32", key)
 				}
+				if err := validateOption(key, val); err != nil {
+					return err
+				}
 				field.SetFloat(val)
 			case reflect.String:
 				val, ok := val.(string)
 				if !ok {
 					return fmt.Errorf("option %q must be of type string", key)
 				}
+				if err := validateOption(key, val); err != nil {
+					return err
+				}
 				field.SetString(val)
 			case reflect.Slice:
 				// JSON unmarshals to []interface{}, not []string
@@ -616,6 +946,9 @@ func DefaultOptions() Options {
 			F16KV:     true,
 			UseMLock:  false,
 			UseMMap:   nil,
+
+			// -1 here indicates that the extrapolation mix is loaded from the model
+			YarnExtFactor: -1,
 		},
 	}
 }
@@ -691,6 +1024,10 @@ func FormatParams(params map[string][]string) (map[string]interface{}, error) {
 						return nil, fmt.Errorf("invalid float value %s", vals)
 					}
 
+					if err := validateOption(key, floatVal); err != nil {
+						return nil, err
+					}
+
 					out[key] = float32(floatVal)
 				case reflect.Int:
 					intVal, err := strconv.ParseInt(vals[0], 10, 64)
@@ -707,6 +1044,10 @@ func FormatParams(params map[string][]string) (map[string]interface{}, error) {
 
 					out[key] = boolVal
 				case reflect.String:
+					if err := validateOption(key, vals[0]); err != nil {
+						return nil, err
+					}
+
 					out[key] = vals[0]
 				case reflect.Slice:
 					// TODO: only string slices are supported right now
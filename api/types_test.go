@@ -209,6 +209,91 @@ func TestUseMmapFormatParams(t *testing.T) {
 	}
 }
 
+func TestCacheTypeOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		err  bool
+	}{
+		{"f16", "f16", false},
+		{"q8_0", "q8_0", false},
+		{"q4_0", "q4_0", false},
+		{"unknown", "q3_k", true},
+		{"empty", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params, err := FormatParams(map[string][]string{"cache_type_k": {test.val}, "cache_type_v": {test.val}})
+			if test.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]any{"cache_type_k": test.val, "cache_type_v": test.val}, params)
+			}
+
+			opts := DefaultOptions()
+			err = opts.FromMap(map[string]any{"cache_type_k": test.val, "cache_type_v": test.val})
+			if test.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.val, opts.CacheTypeK)
+				assert.Equal(t, test.val, opts.CacheTypeV)
+			}
+		})
+	}
+}
+
+func TestRopeOptions(t *testing.T) {
+	tests := []struct {
+		key, val string
+		err      bool
+	}{
+		{"rope_scaling_type", "yarn", false},
+		{"rope_scaling_type", "linear", false},
+		{"rope_scaling_type", "ntk", true},
+		{"rope_frequency_base", "1000000", false},
+		{"rope_frequency_base", "-1", true},
+		{"rope_frequency_scale", "0.25", false},
+		{"rope_frequency_scale", "-0.25", true},
+		{"yarn_ext_factor", "0", false},
+		{"yarn_attn_factor", "1.0", false},
+		{"yarn_beta_fast", "32", false},
+		{"yarn_beta_slow", "-1", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key+" "+test.val, func(t *testing.T) {
+			params, err := FormatParams(map[string][]string{test.key: {test.val}})
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			// options from the API are given as JSON
+			b, err := json.Marshal(params)
+			require.NoError(t, err)
+
+			var m map[string]any
+			require.NoError(t, json.Unmarshal(b, &m))
+
+			opts := DefaultOptions()
+			require.NoError(t, opts.FromMap(m))
+		})
+	}
+
+	opts := DefaultOptions()
+	assert.Equal(t, float32(-1), opts.YarnExtFactor)
+	require.NoError(t, opts.FromMap(map[string]any{"rope_scaling_type": "yarn", "rope_frequency_scale": 0.25, "yarn_ext_factor": 0.0}))
+	assert.Equal(t, "yarn", opts.RopeScalingType)
+	assert.Equal(t, float32(0.25), opts.RopeFrequencyScale)
+	assert.Equal(t, float32(0), opts.YarnExtFactor)
+
+	require.Error(t, opts.FromMap(map[string]any{"rope_frequency_base": -10000.0}))
+}
+
 func TestMessage_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -58,19 +58,23 @@ func NewNonce(r io.Reader, length int) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(nonce), nil
 }
 
-func Sign(ctx context.Context, bts []byte) (string, error) {
+func privateKey() (ssh.Signer, error) {
 	keyPath, err := keyPath()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	privateKeyFile, err := os.ReadFile(keyPath)
 	if err != nil {
 		slog.Info(fmt.Sprintf("Failed to load private key: %v", err))
-		return "", err
+		return nil, err
 	}
 
-	privateKey, err := ssh.ParsePrivateKey(privateKeyFile)
+	return ssh.ParsePrivateKey(privateKeyFile)
+}
+
+func Sign(ctx context.Context, bts []byte) (string, error) {
+	privateKey, err := privateKey()
 	if err != nil {
 		return "", err
 	}
@@ -90,3 +94,23 @@ func Sign(ctx context.Context, bts []byte) (string, error) {
 	// signature is <pubkey>:<signature>
 	return fmt.Sprintf("%s:%s", bytes.TrimSpace(parts[1]), base64.StdEncoding.EncodeToString(signedData.Blob)), nil
 }
+
+// SignBytes signs bts with the private key and returns the raw ed25519
+// signature, which can be verified with the key returned by GetPublicKey.
+func SignBytes(bts []byte) ([]byte, error) {
+	privateKey, err := privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := privateKey.Sign(rand.Reader, bts)
+	if err != nil {
+		return nil, err
+	}
+
+	if signature.Format != ssh.KeyAlgoED25519 {
+		return nil, fmt.Errorf("unsupported key type %s", signature.Format)
+	}
+
+	return signature.Blob, nil
+}
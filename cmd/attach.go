@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+// maxAttachmentsSize is the most text which is attached to a message
+const maxAttachmentsSize = 1 << 20
+
+var (
+	errNotText         = errors.New("not a text file")
+	errAttachmentsSize = fmt.Errorf("attachments are larger than %s", format.HumanBytes(maxAttachmentsSize))
+)
+
+// attachmentRef matches @path and @url references in a message
+var attachmentRef = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// attachment is a text file, or the text at a URL, included in a message
+type attachment struct {
+	name    string
+	content string
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// sniffLen is how much of a file is looked at to tell whether it's text
+const sniffLen = 512
+
+// isText reports whether b, or its first sniffLen bytes, looks like text
+// rather than binary data
+func isText(b []byte) bool {
+	sample := b[:min(len(b), sniffLen)]
+	if bytes.ContainsRune(sample, 0) {
+		return false
+	}
+
+	// a character may be cut off at the end of a full sample
+	for cut := range utf8.UTFMax {
+		if utf8.Valid(sample[:len(sample)-cut]) {
+			return true
+		}
+
+		if len(sample) < sniffLen || cut == len(sample) {
+			break
+		}
+	}
+
+	return false
+}
+
+// readText reads the text file at path if it's at most limit bytes. Only its
+// start is read if it looks like binary data, which returns errNotText, and
+// nothing more is read if it's larger than limit.
+func readText(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	if !isText(head[:n]) {
+		return nil, fmt.Errorf("%w: %s", errNotText, path)
+	}
+
+	if fi.Size() > limit {
+		return nil, errAttachmentsSize
+	}
+
+	// the file may have grown since it was checked
+	rest, err := io.ReadAll(io.LimitReader(f, limit-int64(n)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(head[:n], rest...), nil
+}
+
+// hasGlob reports whether s is a glob pattern
+func hasGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// collectAttachments reads the text files and URLs in args. Directories are
+// walked for text files, skipping hidden ones. Arguments which are globs
+// without a path separator filter the files found in directories, such as
+// `src/ *.go`, while other globs are expanded, such as `src/*.go`.
+func collectAttachments(ctx context.Context, args []string) ([]attachment, error) {
+	var filters, paths []string
+	for _, arg := range args {
+		arg = normalizeFilePath(arg)
+		switch {
+		case isURL(arg):
+			paths = append(paths, arg)
+		case hasGlob(arg) && !strings.ContainsAny(arg, `/\`):
+			filters = append(filters, arg)
+		case hasGlob(arg):
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+
+			paths = append(paths, matches...)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+
+	match := func(name string) bool {
+		return len(filters) == 0 || slices.ContainsFunc(filters, func(filter string) bool {
+			ok, _ := filepath.Match(filter, name)
+			return ok
+		})
+	}
+
+	var attachments []attachment
+	var size int
+	add := func(name string, b []byte) error {
+		size += len(b)
+		if size > maxAttachmentsSize {
+			return errAttachmentsSize
+		}
+
+		attachments = append(attachments, attachment{name: name, content: string(b)})
+		return nil
+	}
+
+	for _, p := range paths {
+		if isURL(p) {
+			b, err := fetchAttachment(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := add(p, b); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.IsDir() {
+			b, err := readText(p, int64(maxAttachmentsSize-size))
+			if err != nil {
+				return nil, err
+			}
+
+			if err := add(p, b); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if path != p && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if d.IsDir() || !d.Type().IsRegular() || !match(d.Name()) {
+				return nil
+			}
+
+			// binary files in directories are skipped rather than refused
+			b, err := readText(path, int64(maxAttachmentsSize-size))
+			if errors.Is(err, errNotText) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			return add(path, b)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return attachments, nil
+}
+
+// fetchAttachment returns the text at the URL u
+func fetchAttachment(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("couldn't fetch %s: %s", u, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentsSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > maxAttachmentsSize {
+		return nil, errAttachmentsSize
+	}
+
+	if !isText(b) {
+		return nil, fmt.Errorf("%w: %s", errNotText, u)
+	}
+
+	return b, nil
+}
+
+// extractAttachments removes the @ from the @path and @url references in
+// input which exist and returns what they refer to. Images are left to
+// extractFileData.
+func extractAttachments(ctx context.Context, input string) (string, []attachment, error) {
+	var refs []string
+	input = attachmentRef.ReplaceAllStringFunc(input, func(s string) string {
+		m := attachmentRef.FindStringSubmatch(s)
+		ref := m[2]
+		if !isURL(ref) {
+			if _, err := os.Stat(normalizeFilePath(ref)); err != nil {
+				return s
+			}
+		}
+
+		if !slices.Contains([]string{".jpg", ".jpeg", ".png"}, strings.ToLower(filepath.Ext(ref))) {
+			refs = append(refs, ref)
+		}
+
+		return m[1] + ref
+	})
+
+	if len(refs) == 0 {
+		return input, nil, nil
+	}
+
+	attachments, err := collectAttachments(ctx, refs)
+	return input, attachments, err
+}
+
+// formatAttachments formats attachments to follow a message, each in a code
+// block headed by its name
+func formatAttachments(attachments []attachment) string {
+	var sb strings.Builder
+	for _, a := range attachments {
+		// the fence must be longer than any run of backticks in the content
+		fence := "```"
+		for strings.Contains(a.content, fence) {
+			fence += "`"
+		}
+
+		lang := strings.TrimPrefix(filepath.Ext(a.name), ".")
+		if isURL(a.name) {
+			lang = ""
+		}
+
+		fmt.Fprintf(&sb, "\n\n%s:\n%s%s\n%s", a.name, fence, lang, a.content)
+		if !strings.HasSuffix(a.content, "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fence)
+	}
+
+	return sb.String()
+}
+
+// checkAttachmentsBudget returns an error if the attachments don't fit in the
+// model's context window, counting their tokens with the model's tokenizer
+func checkAttachmentsBudget(ctx context.Context, opts runOptions, attachments []attachment) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Tokenize(ctx, &api.TokenizeRequest{
+		Model:     opts.Model,
+		Prompt:    formatAttachments(attachments),
+		Options:   opts.Options,
+		KeepAlive: opts.KeepAlive,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Tokens) > resp.NumCtx {
+		return fmt.Errorf("attachments are %d tokens, more than the %d token context; attach fewer files or set a larger num_ctx", len(resp.Tokens), resp.NumCtx)
+	}
+
+	return nil
+}
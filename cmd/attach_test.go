@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollectAttachments(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"README.md":        "# readme\n",
+		"sub/util.go":      "package sub\n",
+		".git/config":      "[core]\n",
+		"sub/.env":         "SECRET=1\n",
+		"sub/image.bin":    "\x00\x01\x02",
+		"sub/deep/more.go": "package deep\n",
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(t *testing.T, args ...string) []string {
+		t.Helper()
+
+		attachments, err := collectAttachments(context.Background(), args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, a := range attachments {
+			rel, err := filepath.Rel(dir, a.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+
+		return names
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"README.md", "main.go", "sub/deep/more.go", "sub/util.go"}, names(t, dir)); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"main.go", "sub/deep/more.go", "sub/util.go"}, names(t, dir, "*.go")); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"sub/util.go"}, names(t, filepath.Join(dir, "sub", "*.go"))); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		if _, err := collectAttachments(context.Background(), []string{filepath.Join(dir, "sub", "image.bin")}); !errors.Is(err, errNotText) {
+			t.Errorf("expected %v, got %v", errNotText, err)
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, "remote text")
+		}))
+		defer srv.Close()
+
+		attachments, err := collectAttachments(context.Background(), []string{srv.URL + "/notes.txt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]attachment{{name: srv.URL + "/notes.txt", content: "remote text"}}, attachments, cmp.AllowUnexported(attachment{})); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+
+		if _, err := collectAttachments(context.Background(), []string{srv.URL + "/missing"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		main := filepath.Join(dir, "main.go")
+		msg, attachments, err := extractAttachments(context.Background(), "ask @someone about @"+main)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expect := "ask @someone about " + main; msg != expect {
+			t.Errorf("expected %q, got %q", expect, msg)
+		}
+
+		if diff := cmp.Diff([]attachment{{name: main, content: "package main\n"}}, attachments, cmp.AllowUnexported(attachment{})); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCollectAttachmentsSize(t *testing.T) {
+	dir := t.TempDir()
+
+	// a large binary file is skipped without being read in full
+	binary := append([]byte{0}, bytes.Repeat([]byte("x"), maxAttachmentsSize)...)
+	if err := os.WriteFile(filepath.Join(dir, "model.bin"), binary, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	attachments, err := collectAttachments(context.Background(), []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attachments) != 1 || filepath.Base(attachments[0].name) != "notes.txt" {
+		t.Errorf("expected only notes.txt, got %v", attachments)
+	}
+
+	large := filepath.Join(dir, "large.txt")
+	if err := os.WriteFile(large, bytes.Repeat([]byte("x"), maxAttachmentsSize+1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arg := range []string{large, dir} {
+		if _, err := collectAttachments(context.Background(), []string{arg}); !errors.Is(err, errAttachmentsSize) {
+			t.Errorf("%s: expected %v, got %v", arg, errAttachmentsSize, err)
+		}
+	}
+}
+
+func TestIsText(t *testing.T) {
+	cases := []struct {
+		name   string
+		b      []byte
+		expect bool
+	}{
+		{"text", []byte("hello\n"), true},
+		{"empty", nil, true},
+		{"nul", []byte("hello\x00"), false},
+		{"invalid utf-8", []byte("hello\xff"), false},
+		// only the start of a file is looked at
+		{"nul after sample", append(bytes.Repeat([]byte("a"), sniffLen), 0), true},
+		{"character cut off by sample", append(bytes.Repeat([]byte("a"), sniffLen-1), "é"...), true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isText(tt.b); got != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestFormatAttachments(t *testing.T) {
+	got := formatAttachments([]attachment{
+		{name: "main.go", content: "package main\n"},
+		{name: "README.md", content: "```sh\nollama run llama3.1\n```"},
+	})
+
+	expect := "\n\nmain.go:\n```go\npackage main\n```" +
+		"\n\nREADME.md:\n````md\n```sh\nollama run llama3.1\n```\n````"
+
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/ed25519"
@@ -52,6 +53,12 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// an importance matrix which is passed in is only used to quantize
+	quantize, _ := cmd.Flags().GetString("quantize")
+	if path, _ := cmd.Flags().GetString("imatrix"); path != "" && quantize == "" {
+		return errors.New("--imatrix requires --quantize")
+	}
+
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
@@ -135,6 +142,18 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 				p.Add(resp.Digest, bar)
 			}
 
+			bar.Set(resp.Completed)
+		} else if resp.Total > 0 {
+			// per-tensor progress while quantizing
+			spinner.Stop()
+
+			bar, ok := bars[resp.Status]
+			if !ok {
+				bar = progress.NewBar(resp.Status, resp.Total, resp.Completed)
+				bars[resp.Status] = bar
+				p.Add(resp.Status, bar)
+			}
+
 			bar.Set(resp.Completed)
 		} else if status != resp.Status {
 			spinner.Stop()
@@ -147,9 +166,26 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	quantize, _ := cmd.Flags().GetString("quantize")
-
 	request := api.CreateRequest{Name: args[0], Modelfile: modelfile.String(), Quantize: quantize}
+
+	if path, _ := cmd.Flags().GetString("imatrix"); path != "" {
+		digest, err := createBlob(cmd, client, path, spinner)
+		if err != nil {
+			return err
+		}
+
+		request.Imatrix = digest
+	}
+
+	if path, _ := cmd.Flags().GetString("calibration"); path != "" {
+		digest, err := createBlob(cmd, client, path, spinner)
+		if err != nil {
+			return err
+		}
+
+		request.Calibration = digest
+	}
+
 	if err := client.Create(cmd.Context(), &request, fn); err != nil {
 		return err
 	}
@@ -348,16 +384,42 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 	interactive := true
 
 	opts := runOptions{
-		Model:    args[0],
 		WordWrap: os.Getenv("TERM") == "xterm-256color",
 		Options:  map[string]interface{}{},
+		Markdown: term.IsTerminal(int(os.Stdout.Fd())),
 	}
 
-	format, err := cmd.Flags().GetString("format")
+	sessionName, err := cmd.Flags().GetString("session")
 	if err != nil {
 		return err
 	}
-	opts.Format = format
+
+	// a saved session is resumed with its model unless another is given
+	var resumed *session
+	if sessionName != "" {
+		s, err := loadSession(sessionName)
+		switch {
+		case err == nil:
+			resumed = s
+			s.restore(&opts)
+		case errors.Is(err, os.ErrNotExist):
+			opts.Session = sessionName
+		default:
+			return err
+		}
+	}
+
+	switch {
+	case len(args) > 0:
+		opts.Model = args[0]
+		args = args[1:]
+	case resumed == nil:
+		return fmt.Errorf("a model is required to start session %q", sessionName)
+	}
+
+	if err := applyRunFlags(cmd, &opts); err != nil {
+		return err
+	}
 
 	keepAlive, err := cmd.Flags().GetString("keepalive")
 	if err != nil {
@@ -371,7 +433,14 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 		opts.KeepAlive = &api.Duration{Duration: d}
 	}
 
-	prompts := args[1:]
+	if dry, err := cmd.Flags().GetBool("dry-run"); err != nil {
+		return err
+	} else if dry {
+		return dryRun(cmd, opts)
+	}
+
+	prompts := args
+	var lines []string
 	// prepend stdin to the prompt if provided
 	if !term.IsTerminal(int(os.Stdin.Fd())) {
 		in, err := io.ReadAll(os.Stdin)
@@ -379,15 +448,33 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		prompts = append([]string{string(in)}, prompts...)
+		if opts.EachLine {
+			lines = strings.Split(string(in), "\n")
+		} else {
+			prompts = append([]string{string(in)}, prompts...)
+		}
 		opts.WordWrap = false
 		interactive = false
+	} else if opts.EachLine {
+		return errors.New("--each-line reads prompts from stdin")
 	}
-	opts.Prompt = strings.Join(prompts, " ")
 	if len(prompts) > 0 {
+		opts.Prompt = withSchema(strings.Join(prompts, " "), opts.Schema)
 		interactive = false
 	}
 
+	// these only apply to a prompt given on the command line or stdin
+	if interactive {
+		switch {
+		case opts.Output != "text":
+			return fmt.Errorf("--output %s needs a prompt", opts.Output)
+		case opts.Schema != "":
+			return errors.New("--format with a JSON schema file needs a prompt")
+		case len(opts.Images) > 0:
+			return errors.New("--image needs a prompt")
+		}
+	}
+
 	nowrap, err := cmd.Flags().GetBool("nowordwrap")
 	if err != nil {
 		return err
@@ -401,7 +488,7 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	name := args[0]
+	name := opts.Model
 	info, err := func() (*api.ShowResponse, error) {
 		showReq := &api.ShowRequest{Name: name}
 		info, err := client.Show(cmd.Context(), showReq)
@@ -426,23 +513,68 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		for _, msg := range info.Messages {
-			switch msg.Role {
-			case "user":
-				fmt.Printf(">>> %s\n", msg.Content)
-			case "assistant":
-				state := &displayResponseState{}
-				displayResponse(msg.Content, opts.WordWrap, state)
-				fmt.Println()
-				fmt.Println()
-			}
+		if resumed != nil || len(opts.Messages) > 0 {
+			printMessages(opts, opts.Messages)
+		} else {
+			printMessages(opts, info.Messages)
 		}
 
+		opts.Messages = chatMessages(opts)
 		return generateInteractive(cmd, opts)
 	}
+
+	switch {
+	case opts.EachLine:
+		return generateEachLine(cmd, opts, lines, args)
+	case opts.Output != "text":
+		return generateOutput(cmd, opts)
+	case opts.Session != "" || len(opts.Messages) > 0:
+		// a prompt given to a session or conversation continues it
+		opts.Messages = chatMessages(opts)
+		assistant, err := chat(cmd, opts)
+		if err != nil {
+			return err
+		}
+
+		if assistant != nil {
+			opts.Messages = append(opts.Messages, *assistant)
+		}
+
+		if opts.Session != "" {
+			return saveSession(opts)
+		}
+
+		return nil
+	}
+
 	return generate(cmd, opts)
 }
 
+// printMessages prints the conversation so far when a model or session is
+// loaded
+func printMessages(opts runOptions, messages []api.Message) {
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			fmt.Printf(">>> %s\n", msg.Content)
+			if len(msg.Images) > 0 {
+				fmt.Printf("(%d image(s))\n", len(msg.Images))
+			}
+		case "assistant":
+			if opts.renderMarkdown() {
+				md := newMarkdownRenderer(os.Stdout, markdownWidth(opts.WordWrap))
+				md.Write(msg.Content)
+				md.Flush()
+			} else {
+				state := &displayResponseState{}
+				displayResponse(msg.Content, opts.WordWrap, state)
+			}
+			fmt.Println()
+			fmt.Println()
+		}
+	}
+}
+
 func errFromUnknownKey(unknownKeyErr error) error {
 	// find SSH public key in the error message
 	sshKeyPattern := `ssh-\w+ [^\s"]+`
@@ -529,7 +661,12 @@ func PushHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	request := api.PushRequest{Name: args[0], Insecure: insecure}
+	sign, err := cmd.Flags().GetBool("sign")
+	if err != nil {
+		return err
+	}
+
+	request := api.PushRequest{Name: args[0], Insecure: insecure, Sign: sign}
 	if err := client.Push(cmd.Context(), &request, fn); err != nil {
 		if spinner != nil {
 			spinner.Stop()
@@ -558,7 +695,10 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	models, err := client.List(cmd.Context())
+	// the flag isn't defined when listing from an interactive session
+	filters, _ := cmd.Flags().GetStringArray("filter")
+
+	models, err := client.ListFiltered(cmd.Context(), filters...)
 	if err != nil {
 		return err
 	}
@@ -567,7 +707,12 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 
 	for _, m := range models.Models {
 		if len(args) == 0 || strings.HasPrefix(m.Name, args[0]) {
-			data = append(data, []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")})
+			name := m.Name
+			if m.Target != "" {
+				name = fmt.Sprintf("%s -> %s", m.Name, m.Target)
+			}
+
+			data = append(data, []string{name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")})
 		}
 	}
 
@@ -631,6 +776,89 @@ func ListRunningHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func StorageHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	storage, err := client.Storage(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	// the store of each model is only shown if there are several
+	stores := strings.Contains(storage.Path, string(filepath.ListSeparator))
+
+	var data [][]string
+	for _, m := range storage.Models {
+		row := []string{m.Name, format.HumanBytes(m.Size), format.HumanBytes(m.Exclusive), format.HumanBytes(m.Shared)}
+		if stores {
+			row = append(row, m.Store)
+		}
+		data = append(data, row)
+	}
+
+	header := []string{"NAME", "SIZE", "EXCLUSIVE", "SHARED"}
+	if stores {
+		header = append(header, "STORE")
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	sum := func(blobs []api.BlobStorage) (size int64) {
+		for _, b := range blobs {
+			size += b.Size
+		}
+		return size
+	}
+
+	fmt.Println()
+	fmt.Printf("orphaned blobs     %d (%s)\n", len(storage.Orphaned), format.HumanBytes(sum(storage.Orphaned)))
+	fmt.Printf("partial downloads  %d (%s)\n", len(storage.Partial), format.HumanBytes(sum(storage.Partial)))
+	fmt.Printf("total              %s in %s\n", format.HumanBytes(storage.Size), storage.Path)
+
+	return nil
+}
+
+func GCHandler(cmd *cobra.Command, args []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GC(cmd.Context(), &api.GCRequest{DryRun: dryRun})
+	if err != nil {
+		return err
+	}
+
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+
+	for _, b := range resp.Removed {
+		fmt.Printf("%s %s (%s)\n", verb, b.Digest, format.HumanBytes(b.Size))
+	}
+
+	fmt.Printf("%s %d blobs, reclaiming %s\n", verb, len(resp.Removed), format.HumanBytes(resp.Size))
+	return nil
+}
+
 func DeleteHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -658,8 +886,9 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	parameters, errParams := cmd.Flags().GetBool("parameters")
 	system, errSystem := cmd.Flags().GetBool("system")
 	template, errTemplate := cmd.Flags().GetBool("template")
+	diff, errDiff := cmd.Flags().GetString("diff")
 
-	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate} {
+	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate, errDiff} {
 		if boolErr != nil {
 			return errors.New("error retrieving flags")
 		}
@@ -693,16 +922,24 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 		showType = "template"
 	}
 
+	if diff != "" {
+		flagsSet++
+	}
+
 	if flagsSet > 1 {
-		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', or '--template' can be specified")
+		return errors.New("only one of '--diff', '--license', '--modelfile', '--parameters', '--system', or '--template' can be specified")
 	}
 
-	req := api.ShowRequest{Name: args[0]}
+	req := api.ShowRequest{Name: args[0], Diff: diff}
 	resp, err := client.Show(cmd.Context(), &req)
 	if err != nil {
 		return err
 	}
 
+	if resp.Diff != nil {
+		return writeDiff(os.Stdout, args[0], resp.Diff)
+	}
+
 	if flagsSet == 1 {
 		switch showType {
 		case "license":
@@ -756,6 +993,15 @@ func showInfo(resp *api.ShowResponse) {
 			[]string{"projection dimensionality", fmt.Sprintf("%v", resp.ProjectorInfo["clip.vision.projection_dim"].(float64))},
 		)
 
+		if resp.Vision != nil {
+			projectorData = append(projectorData,
+				[]string{"image size", fmt.Sprintf("%d", resp.Vision.ImageSize)},
+				[]string{"patch size", fmt.Sprintf("%d", resp.Vision.PatchSize)},
+				[]string{"max tiles", fmt.Sprintf("%d", resp.Vision.MaxTiles)},
+				[]string{"tokens per image", fmt.Sprintf("%d", resp.Vision.TokensPerImage)},
+			)
+		}
+
 		mainTableData = append(mainTableData,
 			[]string{"Projector"},
 			[]string{renderSubTable(projectorData, false)},
@@ -852,6 +1098,139 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func LabelHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.LabelsRequest{Model: args[0], Labels: make(map[string]string)}
+	for _, arg := range args[1:] {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("label must be of the form key=value: %q", arg)
+		}
+
+		req.Labels[k] = v
+	}
+
+	return client.Labels(cmd.Context(), &req)
+}
+
+func AliasHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.AliasRequest{Alias: args[0], Target: args[1]}
+	if err := client.Alias(cmd.Context(), &req); err != nil {
+		return err
+	}
+	fmt.Printf("'%s' now points to '%s'\n", args[0], args[1])
+	return nil
+}
+
+func MoveHandler(cmd *cobra.Command, args []string) error {
+	store, err := cmd.Flags().GetString("store")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.MoveRequest{Model: args[0], Store: store}
+	if err := client.Move(cmd.Context(), &req); err != nil {
+		return err
+	}
+	fmt.Printf("moved '%s' to '%s'\n", args[0], store)
+	return nil
+}
+
+func LoginHandler(cmd *cobra.Command, args []string) error {
+	insecure, err := cmd.Flags().GetBool("insecure")
+	if err != nil {
+		return err
+	}
+
+	username, err := cmd.Flags().GetString("username")
+	if err != nil {
+		return err
+	}
+
+	passwordStdin, err := cmd.Flags().GetBool("password-stdin")
+	if err != nil {
+		return err
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	if username == "" {
+		if passwordStdin {
+			return errors.New("--username is required with --password-stdin")
+		}
+
+		fmt.Print("Username: ")
+		line, err := stdin.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		username = strings.TrimSpace(line)
+	}
+
+	var password string
+	switch {
+	case passwordStdin:
+		bts, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+
+		password = strings.TrimRight(string(bts), "\r\n")
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		fmt.Print("Password: ")
+		bts, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return err
+		}
+
+		password = string(bts)
+	default:
+		return errors.New("use --password-stdin to read the password from stdin")
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	req := api.LoginRequest{Registry: args[0], Username: username, Password: password, Insecure: insecure}
+	if err := client.Login(cmd.Context(), &req); err != nil {
+		return err
+	}
+
+	fmt.Printf("logged in to '%s'\n", args[0])
+	return nil
+}
+
+func LogoutHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Logout(cmd.Context(), &api.LogoutRequest{Registry: args[0]}); err != nil {
+		return err
+	}
+
+	fmt.Printf("logged out of '%s'\n", args[0])
+	return nil
+}
+
 func PullHandler(cmd *cobra.Command, args []string) error {
 	insecure, err := cmd.Flags().GetBool("insecure")
 	if err != nil {
@@ -863,6 +1242,32 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	for _, action := range []struct {
+		flag string
+		fn   func(context.Context, *api.PullsRequest) error
+		msg  string
+	}{
+		{"pause", client.PausePull, "paused pull of '%s'\n"},
+		{"resume", client.ResumePull, "resumed pull of '%s' in the background\n"},
+		{"cancel", client.CancelPull, "cancelled pull of '%s'\n"},
+	} {
+		if ok, _ := cmd.Flags().GetBool(action.flag); ok {
+			if err := action.fn(cmd.Context(), &api.PullsRequest{Model: args[0]}); err != nil {
+				return err
+			}
+
+			fmt.Printf(action.msg, args[0])
+			return nil
+		}
+	}
+
+	var maxRate int64
+	if s, _ := cmd.Flags().GetString("max-rate"); s != "" {
+		if maxRate, err = format.ParseBytes(s); err != nil {
+			return err
+		}
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -898,7 +1303,12 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	request := api.PullRequest{Name: args[0], Insecure: insecure}
+	store, err := cmd.Flags().GetString("store")
+	if err != nil {
+		return err
+	}
+
+	request := api.PullRequest{Name: args[0], Insecure: insecure, MaxRate: maxRate, Store: store}
 	if err := client.Pull(cmd.Context(), &request, fn); err != nil {
 		return err
 	}
@@ -906,6 +1316,46 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func ListPullsHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	pulls, err := client.ListPulls(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, p := range pulls.Pulls {
+		percent := "-"
+		if p.Total > 0 {
+			percent = fmt.Sprintf("%d%%", p.Completed*100/p.Total)
+		}
+
+		rate := "unlimited"
+		if p.MaxRate > 0 {
+			rate = format.HumanBytes(p.MaxRate) + "/s"
+		}
+
+		data = append(data, []string{p.Model, p.Status, percent, fmt.Sprintf("%s/%s", format.HumanBytes(p.Completed), format.HumanBytes(p.Total)), rate})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "STATUS", "PROGRESS", "SIZE", "RATE"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
+
 type generateContextKey string
 
 type runOptions struct {
@@ -920,6 +1370,18 @@ type runOptions struct {
 	Options     map[string]interface{}
 	MultiModal  bool
 	KeepAlive   *api.Duration
+	Session     string
+	Markdown    bool
+	Output      string
+	Schema      string
+	EachLine    bool
+	Parallel    int
+}
+
+// renderMarkdown reports whether replies are rendered as markdown. Replies
+// in a format such as JSON are written as they are.
+func (opts runOptions) renderMarkdown() bool {
+	return opts.Markdown && opts.Format == ""
 }
 
 type displayResponseState struct {
@@ -1003,6 +1465,11 @@ func chat(cmd *cobra.Command, opts runOptions) (*api.Message, error) {
 	var fullResponse strings.Builder
 	var role string
 
+	var md *markdownRenderer
+	if opts.renderMarkdown() {
+		md = newMarkdownRenderer(os.Stdout, markdownWidth(opts.WordWrap))
+	}
+
 	fn := func(response api.ChatResponse) error {
 		p.StopAndClear()
 
@@ -1012,7 +1479,11 @@ func chat(cmd *cobra.Command, opts runOptions) (*api.Message, error) {
 		content := response.Message.Content
 		fullResponse.WriteString(content)
 
-		displayResponse(content, opts.WordWrap, state)
+		if md != nil {
+			md.Write(content)
+		} else {
+			displayResponse(content, opts.WordWrap, state)
+		}
 
 		return nil
 	}
@@ -1028,7 +1499,12 @@ func chat(cmd *cobra.Command, opts runOptions) (*api.Message, error) {
 		req.KeepAlive = opts.KeepAlive
 	}
 
-	if err := client.Chat(cancelCtx, req, fn); err != nil {
+	err = client.Chat(cancelCtx, req, fn)
+	if md != nil {
+		md.Flush()
+	}
+
+	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return nil, nil
 		}
@@ -1084,22 +1560,33 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 
 	var state *displayResponseState = &displayResponseState{}
 
+	var md *markdownRenderer
+	if opts.renderMarkdown() {
+		md = newMarkdownRenderer(os.Stdout, markdownWidth(opts.WordWrap))
+	}
+
 	fn := func(response api.GenerateResponse) error {
 		p.StopAndClear()
 
 		latest = response
 		content := response.Response
 
-		displayResponse(content, opts.WordWrap, state)
+		if md != nil {
+			md.Write(content)
+		} else {
+			displayResponse(content, opts.WordWrap, state)
+		}
 
 		return nil
 	}
 
 	if opts.MultiModal {
-		opts.Prompt, opts.Images, err = extractFileData(opts.Prompt)
+		var images []api.ImageData
+		opts.Prompt, images, err = extractFileData(opts.Prompt)
 		if err != nil {
 			return err
 		}
+		opts.Images = append(opts.Images, images...)
 	}
 
 	request := api.GenerateRequest{
@@ -1113,7 +1600,12 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 		KeepAlive: opts.KeepAlive,
 	}
 
-	if err := client.Generate(ctx, &request, fn); err != nil {
+	err = client.Generate(ctx, &request, fn)
+	if md != nil {
+		md.Flush()
+	}
+
+	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return nil
 		}
@@ -1144,17 +1636,29 @@ func generate(cmd *cobra.Command, opts runOptions) error {
 	return nil
 }
 
-func RunServer(_ *cobra.Command, _ []string) error {
+func RunServer(cmd *cobra.Command, _ []string) error {
 	if err := initializeKeypair(); err != nil {
 		return err
 	}
 
+	serve := server.Serve
+	registry, _ := cmd.Flags().GetBool("registry")
+	push, _ := cmd.Flags().GetBool("registry-push")
+	switch {
+	case registry:
+		serve = func(ln net.Listener) error {
+			return server.ServeRegistry(ln, push)
+		}
+	case push:
+		return errors.New("--registry-push requires --registry")
+	}
+
 	ln, err := net.Listen("tcp", envconfig.Host().Host)
 	if err != nil {
 		return err
 	}
 
-	err = server.Serve(ln)
+	err = serve(ln)
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	}
@@ -1297,6 +1801,9 @@ func NewCLI() *cobra.Command {
 
 	createCmd.Flags().StringP("file", "f", "Modelfile", "Name of the Modelfile")
 	createCmd.Flags().StringP("quantize", "q", "", "Quantize model to this level (e.g. q4_0)")
+	createCmd.Flags().String("imatrix", "", "Importance matrix file to quantize with")
+	createCmd.Flags().String("calibration", "", "Text file to compute an importance matrix from")
+	createCmd.MarkFlagsMutuallyExclusive("imatrix", "calibration")
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -1311,11 +1818,18 @@ func NewCLI() *cobra.Command {
 	showCmd.Flags().Bool("parameters", false, "Show parameters of a model")
 	showCmd.Flags().Bool("template", false, "Show template of a model")
 	showCmd.Flags().Bool("system", false, "Show system message of a model")
+	showCmd.Flags().String("diff", "", "Show what changed from another model")
 
 	runCmd := &cobra.Command{
-		Use:     "run MODEL [PROMPT]",
-		Short:   "Run a model",
-		Args:    cobra.MinimumNArgs(1),
+		Use:   "run MODEL [PROMPT]",
+		Short: "Run a model",
+		Args: func(cmd *cobra.Command, args []string) error {
+			// a saved session knows its model
+			if session, _ := cmd.Flags().GetString("session"); session != "" {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		PreRunE: checkServerHeartbeat,
 		RunE:    RunHandler,
 	}
@@ -1324,7 +1838,16 @@ func NewCLI() *cobra.Command {
 	runCmd.Flags().Bool("verbose", false, "Show timings for response")
 	runCmd.Flags().Bool("insecure", false, "Use an insecure registry")
 	runCmd.Flags().Bool("nowordwrap", false, "Don't wrap words to the next line automatically")
-	runCmd.Flags().String("format", "", "Response format (e.g. json)")
+	runCmd.Flags().String("format", "", "Response format: json, or a JSON schema file")
+	runCmd.Flags().String("system", "", "System message")
+	runCmd.Flags().StringArray("option", nil, "Model parameter as key=value (e.g. temperature=0.5)")
+	runCmd.Flags().StringArray("image", nil, "Image to include with the prompt")
+	runCmd.Flags().String("messages", "", "JSON file of messages to continue the conversation from")
+	runCmd.Flags().String("output", "text", "Output format: text, json or jsonl")
+	runCmd.Flags().Bool("each-line", false, "Run a prompt for each line of stdin")
+	runCmd.Flags().Int("parallel", 4, "Number of lines to run at once with --each-line")
+	runCmd.Flags().String("session", "", "Save the conversation to a session, resuming it if it exists")
+	runCmd.Flags().Bool("dry-run", false, "Show how much memory the model needs without loading it")
 	serveCmd := &cobra.Command{
 		Use:     "serve",
 		Aliases: []string{"start"},
@@ -1333,6 +1856,9 @@ func NewCLI() *cobra.Command {
 		RunE:    RunServer,
 	}
 
+	serveCmd.Flags().Bool("registry", false, "Serve local models as a registry to pull from")
+	serveCmd.Flags().Bool("registry-push", false, "Allow models to be pushed to the registry with the credentials in OLLAMA_REGISTRY_AUTH")
+
 	pullCmd := &cobra.Command{
 		Use:     "pull MODEL",
 		Short:   "Pull a model from a registry",
@@ -1342,6 +1868,20 @@ func NewCLI() *cobra.Command {
 	}
 
 	pullCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pullCmd.Flags().String("max-rate", "", "Maximum download rate per second (e.g. 50MB)")
+	pullCmd.Flags().Bool("pause", false, "Pause the pull of the model, keeping what's been downloaded")
+	pullCmd.Flags().Bool("resume", false, "Resume a paused pull of the model in the background")
+	pullCmd.Flags().Bool("cancel", false, "Cancel the pull of the model, removing what's been downloaded")
+	pullCmd.Flags().String("store", "", "Model store to pull the model to, one of the directories in OLLAMA_MODELS")
+	pullCmd.MarkFlagsMutuallyExclusive("pause", "resume", "cancel")
+
+	pullsCmd := &cobra.Command{
+		Use:     "pulls",
+		Short:   "List pulls in progress",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ListPullsHandler,
+	}
 
 	pushCmd := &cobra.Command{
 		Use:     "push MODEL",
@@ -1352,6 +1892,7 @@ func NewCLI() *cobra.Command {
 	}
 
 	pushCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pushCmd.Flags().Bool("sign", false, "Push a signature of the model made with your Ollama key")
 
 	listCmd := &cobra.Command{
 		Use:     "list",
@@ -1361,6 +1902,16 @@ func NewCLI() *cobra.Command {
 		RunE:    ListHandler,
 	}
 
+	listCmd.Flags().StringArray("filter", nil, "Only list models which match a filter, e.g. label=owner=search-team, label=owner, family=llama or quantization=Q4_0")
+
+	labelCmd := &cobra.Command{
+		Use:     "label MODEL KEY=VALUE [KEY=VALUE...]",
+		Short:   "Set the labels of a model, removing those set to an empty value",
+		Args:    cobra.MinimumNArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    LabelHandler,
+	}
+
 	psCmd := &cobra.Command{
 		Use:     "ps",
 		Short:   "List running models",
@@ -1368,6 +1919,36 @@ func NewCLI() *cobra.Command {
 		RunE:    ListRunningHandler,
 	}
 
+	duCmd := &cobra.Command{
+		Use:     "du",
+		Short:   "Show the disk space used by models",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    StorageHandler,
+	}
+
+	inspectCmd := &cobra.Command{
+		Use:     "inspect PATH",
+		Short:   "Show the metadata and tensors of a GGUF file or safetensors model",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    InspectHandler,
+	}
+
+	inspectCmd.Flags().Int("num-ctx", 0, "Context length to estimate memory for")
+	inspectCmd.Flags().Bool("verbose", false, "Show all metadata, including long lists")
+	inspectCmd.Flags().String("output", "table", "Output format: table or json")
+
+	gcCmd := &cobra.Command{
+		Use:     "gc",
+		Short:   "Remove blobs which aren't used by any model",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: checkServerHeartbeat,
+		RunE:    GCHandler,
+	}
+
+	gcCmd.Flags().Bool("dry-run", false, "Show what would be removed without removing it")
+
 	copyCmd := &cobra.Command{
 		Use:     "cp SOURCE DESTINATION",
 		Short:   "Copy a model",
@@ -1376,6 +1957,25 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	aliasCmd := &cobra.Command{
+		Use:     "alias ALIAS MODEL",
+		Short:   "Point an alias to a model",
+		Args:    cobra.ExactArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    AliasHandler,
+	}
+
+	moveCmd := &cobra.Command{
+		Use:     "mv MODEL",
+		Short:   "Move a model to another model store",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    MoveHandler,
+	}
+
+	moveCmd.Flags().String("store", "", "Model store to move the model to, one of the directories in OLLAMA_MODELS")
+	moveCmd.MarkFlagRequired("store")
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1384,6 +1984,26 @@ func NewCLI() *cobra.Command {
 		RunE:    DeleteHandler,
 	}
 
+	loginCmd := &cobra.Command{
+		Use:     "login REGISTRY",
+		Short:   "Log in to a registry",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    LoginHandler,
+	}
+
+	loginCmd.Flags().StringP("username", "u", "", "Username")
+	loginCmd.Flags().Bool("password-stdin", false, "Read the password from stdin")
+	loginCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+
+	logoutCmd := &cobra.Command{
+		Use:     "logout REGISTRY",
+		Short:   "Log out of a registry",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    LogoutHandler,
+	}
+
 	envVars := envconfig.AsMap()
 
 	envs := []envconfig.EnvVar{envVars["OLLAMA_HOST"]}
@@ -1391,13 +2011,22 @@ func NewCLI() *cobra.Command {
 	for _, cmd := range []*cobra.Command{
 		createCmd,
 		showCmd,
+		inspectCmd,
 		runCmd,
 		pullCmd,
+		pullsCmd,
 		pushCmd,
 		listCmd,
 		psCmd,
+		duCmd,
+		gcCmd,
 		copyCmd,
+		aliasCmd,
+		labelCmd,
+		moveCmd,
 		deleteCmd,
+		loginCmd,
+		logoutCmd,
 		serveCmd,
 	} {
 		switch cmd {
@@ -1405,18 +2034,23 @@ func NewCLI() *cobra.Command {
 			appendEnvDocs(cmd, []envconfig.EnvVar{envVars["OLLAMA_HOST"], envVars["OLLAMA_NOHISTORY"]})
 		case serveCmd:
 			appendEnvDocs(cmd, []envconfig.EnvVar{
+				envVars["OLLAMA_BASE_MODELS"],
 				envVars["OLLAMA_DEBUG"],
 				envVars["OLLAMA_HOST"],
 				envVars["OLLAMA_KEEP_ALIVE"],
+				envVars["OLLAMA_MAX_DOWNLOAD_RATE"],
 				envVars["OLLAMA_MAX_LOADED_MODELS"],
 				envVars["OLLAMA_MAX_QUEUE"],
 				envVars["OLLAMA_MODELS"],
 				envVars["OLLAMA_NUM_PARALLEL"],
 				envVars["OLLAMA_NOPRUNE"],
 				envVars["OLLAMA_ORIGINS"],
+				envVars["OLLAMA_PROMOTE_MODELS"],
+				envVars["OLLAMA_PULL_STORE"],
 				envVars["OLLAMA_SCHED_SPREAD"],
 				envVars["OLLAMA_TMPDIR"],
 				envVars["OLLAMA_FLASH_ATTENTION"],
+				envVars["OLLAMA_KV_CACHE_TYPE"],
 				envVars["OLLAMA_LLM_LIBRARY"],
 			})
 		default:
@@ -1428,13 +2062,22 @@ func NewCLI() *cobra.Command {
 		serveCmd,
 		createCmd,
 		showCmd,
+		inspectCmd,
 		runCmd,
 		pullCmd,
+		pullsCmd,
 		pushCmd,
 		listCmd,
 		psCmd,
+		duCmd,
+		gcCmd,
 		copyCmd,
+		aliasCmd,
+		labelCmd,
+		moveCmd,
 		deleteCmd,
+		loginCmd,
+		logoutCmd,
 	)
 
 	return rootCmd
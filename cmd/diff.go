@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/ollama/ollama/api"
+)
+
+// maxDiffItems is the most items of a list shown in a diff
+const maxDiffItems = 8
+
+// writeDiff writes the changes in d from its model to the model name as a
+// unified diff, with a file for each section of the model
+func writeDiff(w io.Writer, name string, d *api.ModelDiff) error {
+	var sections []string
+	changes := make(map[string][]api.ModelChange)
+	for _, c := range d.Changes {
+		if _, ok := changes[c.Section]; !ok {
+			sections = append(sections, c.Section)
+		}
+		changes[c.Section] = append(changes[c.Section], c)
+	}
+
+	for _, section := range sections {
+		var a, b []string
+		for _, c := range changes[section] {
+			a = append(a, diffLines(c.Key, c.From)...)
+			b = append(b, diffLines(c.Key, c.To)...)
+		}
+
+		if err := difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+			A:        a,
+			B:        b,
+			FromFile: d.Model + "/" + section,
+			ToFile:   name + "/" + section,
+			Context:  3,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// diffLines returns the lines of a changed value. Keyed values are a single
+// line, while text and lists are a line for each line or item.
+func diffLines(key string, v any) []string {
+	if v == nil {
+		return nil
+	}
+
+	if key != "" {
+		return []string{key + " " + formatValue(v) + "\n"}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return difflib.SplitLines(v)
+	case []any:
+		lines := make([]string, len(v))
+		for i, item := range v {
+			lines[i] = fmt.Sprintf("%v\n", item)
+		}
+		return lines
+	default:
+		return []string{formatValue(v) + "\n"}
+	}
+}
+
+// formatValue formats v on one line, shortening long lists such as a
+// tokenizer's vocabulary
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []any:
+		if len(v) > maxDiffItems {
+			return fmt.Sprintf("%s, ...] (%d items)", strings.TrimSuffix(marshalValue(v[:maxDiffItems]), "]"), len(v))
+		}
+	}
+
+	return marshalValue(v)
+}
+
+func marshalValue(v any) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
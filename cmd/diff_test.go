@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestWriteDiff(t *testing.T) {
+	vocab := make([]any, 10)
+	for i := range vocab {
+		vocab[i] = string(rune('a' + i))
+	}
+
+	d := api.ModelDiff{
+		Model: "base",
+		Changes: []api.ModelChange{
+			{Section: "system", From: "You are helpful.\nBe brief.", To: "You are a pirate.\nBe brief."},
+			{Section: "parameters", Key: "stop", To: []any{"<end>"}},
+			{Section: "parameters", Key: "temperature", From: 0.5, To: 0.8},
+			{Section: "parameters", Key: "top_k", From: float64(10)},
+			{Section: "model_info", Key: "tokenizer.ggml.tokens", From: vocab[:2], To: vocab},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := writeDiff(&b, "changed", &d); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `--- base/system
++++ changed/system
+@@ -1,2 +1,2 @@
+-You are helpful.
++You are a pirate.
+ Be brief.
+--- base/parameters
++++ changed/parameters
+@@ -1,2 +1,2 @@
+-temperature 0.5
+-top_k 10
++stop ["<end>"]
++temperature 0.8
+--- base/model_info
++++ changed/model_info
+@@ -1 +1 @@
+-tokenizer.ggml.tokens ["a","b"]
++tokenizer.ggml.tokens ["a","b","c","d","e","f","g","h", ...] (10 items)
+`
+
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+// dryRun prints how much memory the model is estimated to need with the
+// options of the run without loading it
+func dryRun(cmd *cobra.Command, opts runOptions) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Estimate(cmd.Context(), &api.EstimateRequest{Model: opts.Model, Options: opts.Options})
+	if err != nil {
+		return err
+	}
+
+	if opts.Output != "text" {
+		enc := json.NewEncoder(os.Stdout)
+		if opts.Output == "json" {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(resp)
+	}
+
+	showEstimate(os.Stdout, resp)
+	return nil
+}
+
+func showEstimate(w io.Writer, resp *api.EstimateResponse) {
+	table := tablewriter.NewWriter(w)
+	table.SetAutoWrapText(false)
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	table.Append([]string{"Model"})
+	table.Append([]string{renderSubTable([][]string{{"name", resp.Model}}, false)})
+	table.Append([]string{"Memory"})
+	table.Append([]string{renderSubTable(memoryData(&resp.MemoryEstimate), false)})
+
+	table.Render()
+}
+
+// memoryData returns the rows of a memory estimate table, with a row for
+// each GPU the model is split across
+func memoryData(m *api.MemoryEstimate) [][]string {
+	data := [][]string{
+		{"library", m.Library},
+		{"context length", strconv.Itoa(m.NumCtx)},
+		{"parallel", strconv.Itoa(m.NumParallel)},
+		{"gpu layers", fmt.Sprintf("%d/%d", m.Layers, m.TotalLayers)},
+		{"graph", format.HumanBytes2(m.Graph)},
+		{"kv cache", format.HumanBytes2(m.KVSize)},
+		{"vram", format.HumanBytes2(m.VRAMSize)},
+		{"total", format.HumanBytes2(m.TotalSize)},
+		{"max context length", strconv.Itoa(m.MaxNumCtx)},
+	}
+
+	for _, g := range m.GPUs {
+		name := "gpu " + g.ID
+		if g.Name != "" {
+			name += " (" + g.Name + ")"
+		}
+
+		data = append(data, []string{name, fmt.Sprintf("%s, %d layers (%s free)", format.HumanBytes2(g.Size), g.Layers, format.HumanBytes2(g.FreeMemory))})
+	}
+
+	return data
+}
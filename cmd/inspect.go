@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+func InspectHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	if output != "table" && output != "json" {
+		return fmt.Errorf("output must be table or json")
+	}
+
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+
+	numCtx, err := cmd.Flags().GetInt("num-ctx")
+	if err != nil {
+		return err
+	}
+
+	// the path is read by the server so it mustn't be relative
+	path, err := filepath.Abs(normalizeFilePath(args[0]))
+	if err != nil {
+		return err
+	}
+
+	req := api.InspectRequest{Path: path, Verbose: verbose}
+	if numCtx > 0 {
+		req.Options = map[string]any{"num_ctx": numCtx}
+	}
+
+	resp, err := client.Inspect(cmd.Context(), &req)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	showInspect(os.Stdout, resp)
+	return nil
+}
+
+// showInspect writes the model, memory estimate, metadata and tensors of an
+// inspected model as tables
+func showInspect(w io.Writer, resp *api.InspectResponse) {
+	modelData := [][]string{
+		{"format", resp.Format},
+		{"arch", fmt.Sprint(resp.ModelInfo["general.architecture"])},
+		{"parameters", format.HumanNumber(resp.ParameterCount)},
+	}
+
+	if resp.TemplateName != "" {
+		modelData = append(modelData, []string{"template", resp.TemplateName})
+	}
+
+	mainTableData := [][]string{
+		{"Model"},
+		{renderSubTable(modelData, false)},
+	}
+
+	if resp.Memory != nil {
+		mainTableData = append(mainTableData, []string{"Memory"}, []string{renderSubTable(memoryData(resp.Memory), false)})
+	}
+
+	keys := make([]string, 0, len(resp.ModelInfo))
+	for k := range resp.ModelInfo {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var infoData [][]string
+	for _, k := range keys {
+		v := resp.ModelInfo[k]
+		if s, ok := v.(string); ok {
+			// long strings such as chat templates are shortened to a line
+			s, _, _ = strings.Cut(s, "\n")
+			v = s
+			if len(s) > 60 {
+				v = s[:60] + "..."
+			}
+		}
+
+		infoData = append(infoData, []string{k, formatInfoValue(v)})
+	}
+
+	mainTableData = append(mainTableData, []string{"Metadata"}, []string{renderSubTable(infoData, true)})
+
+	var tensorData [][]string
+	for _, t := range resp.Tensors {
+		shape := make([]string, len(t.Shape))
+		for i, n := range t.Shape {
+			shape[i] = strconv.FormatUint(n, 10)
+		}
+
+		tensorData = append(tensorData, []string{t.Name, t.Type, "[" + strings.Join(shape, ", ") + "]"})
+	}
+
+	if len(tensorData) > 0 {
+		mainTableData = append(mainTableData, []string{"Tensors"}, []string{renderSubTable(tensorData, true)})
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetAutoWrapText(false)
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, v := range mainTableData {
+		table.Append(v)
+	}
+
+	table.Render()
+}
+
+// formatInfoValue formats a metadata value, leaving strings unquoted. Long
+// lists which aren't returned unless verbose are empty.
+func formatInfoValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "[]"
+	case string:
+		return v
+	}
+
+	return formatValue(v)
+}
@@ -8,15 +8,19 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"slices"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/maps"
+	"golang.org/x/term"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/parser"
 	"github.com/ollama/ollama/progress"
 	"github.com/ollama/ollama/readline"
@@ -58,12 +62,19 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		fmt.Fprintln(os.Stderr, "  /show           Show model information")
 		fmt.Fprintln(os.Stderr, "  /load <model>   Load a session or model")
 		fmt.Fprintln(os.Stderr, "  /save <model>   Save your current session")
+		fmt.Fprintln(os.Stderr, "  /attach <path>  Attach text files, directories or URLs to the next message")
 		fmt.Fprintln(os.Stderr, "  /clear          Clear session context")
+		fmt.Fprintln(os.Stderr, "  /copy           Copy the last code block to the clipboard")
+		fmt.Fprintln(os.Stderr, "  /sessions       List or switch saved sessions")
+		fmt.Fprintln(os.Stderr, "  /fork <name>    Copy this conversation to a new session")
+		fmt.Fprintln(os.Stderr, "  /undo           Remove the last message and response")
+		fmt.Fprintln(os.Stderr, "  /retry          Regenerate the last response")
 		fmt.Fprintln(os.Stderr, "  /bye            Exit")
 		fmt.Fprintln(os.Stderr, "  /?, /help       Help for a command")
 		fmt.Fprintln(os.Stderr, "  /? shortcuts    Help for keyboard shortcuts")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Use \"\"\" to begin a multi-line message.")
+		fmt.Fprintf(os.Stderr, "Use @%s to include a text file, directory or URL.\n", filepath.FromSlash("path/to/file"))
 
 		if opts.MultiModal {
 			fmt.Fprintf(os.Stderr, "Use %s to include .jpg or .png images.\n", filepath.FromSlash("/path/to/file"))
@@ -80,6 +91,8 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		fmt.Fprintln(os.Stderr, "  /set nohistory         Disable history")
 		fmt.Fprintln(os.Stderr, "  /set wordwrap          Enable wordwrap")
 		fmt.Fprintln(os.Stderr, "  /set nowordwrap        Disable wordwrap")
+		fmt.Fprintln(os.Stderr, "  /set markdown          Render markdown in responses")
+		fmt.Fprintln(os.Stderr, "  /set nomarkdown        Show responses as plain text")
 		fmt.Fprintln(os.Stderr, "  /set format json       Enable JSON mode")
 		fmt.Fprintln(os.Stderr, "  /set noformat          Disable formatting")
 		fmt.Fprintln(os.Stderr, "  /set verbose           Show LLM stats")
@@ -96,6 +109,8 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		fmt.Fprintln(os.Stderr, "  Ctrl + k            Delete the sentence after the cursor")
 		fmt.Fprintln(os.Stderr, "  Ctrl + u            Delete the sentence before the cursor")
 		fmt.Fprintln(os.Stderr, "  Ctrl + w            Delete the word before the cursor")
+		fmt.Fprintln(os.Stderr, "  Ctrl + r            Search the history")
+		fmt.Fprintln(os.Stderr, "       Tab            Complete commands, parameters, models and paths")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "  Ctrl + l            Clear the screen")
 		fmt.Fprintln(os.Stderr, "  Ctrl + c            Stop the model from responding")
@@ -145,13 +160,44 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		scanner.HistoryDisable()
 	}
 
+	scanner.Completer = &completer{
+		opts: &opts,
+		models: func() []string {
+			client, err := api.ClientFromEnvironment()
+			if err != nil {
+				return nil
+			}
+
+			models, err := client.List(cmd.Context())
+			if err != nil {
+				return nil
+			}
+
+			var names []string
+			for _, m := range models.Models {
+				names = append(names, m.Name)
+			}
+
+			return names
+		},
+	}
+
 	fmt.Print(readline.StartBracketedPaste)
 	defer fmt.Printf(readline.EndBracketedPaste)
 
 	var sb strings.Builder
 	var multiline MultilineState
 
+	// files attached with /attach which are sent with the next message
+	var attachments []attachment
+
 	for {
+		if opts.Session != "" {
+			if err := saveSession(opts); err != nil {
+				fmt.Fprintf(os.Stderr, "error: couldn't save session: %v\n", err)
+			}
+		}
+
 		line, err := scanner.Readline()
 		switch {
 		case errors.Is(err, io.EOF):
@@ -249,7 +295,144 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 			}
 			fmt.Printf("Created new model '%s'\n", args[1])
 			continue
+		case strings.HasPrefix(line, "/sessions"):
+			args := strings.Fields(line)
+			if len(args) == 1 {
+				if err := showSessions(opts.Session); err != nil {
+					return err
+				}
+				continue
+			}
+
+			s, err := loadSession(args[1])
+			switch {
+			case err == nil:
+				model := opts.Model
+				s.restore(&opts)
+				if opts.Model != model {
+					fmt.Printf("Loading model '%s'\n", opts.Model)
+					if err := loadModel(cmd, &opts); err != nil {
+						return err
+					}
+				}
+
+				printMessages(opts, opts.Messages)
+				fmt.Printf("Resumed session '%s'\n", s.Name)
+			case errors.Is(err, os.ErrNotExist):
+				opts.Session = args[1]
+				opts.Messages = []api.Message{}
+				if opts.System != "" {
+					opts.Messages = append(opts.Messages, api.Message{Role: "system", Content: opts.System})
+				}
+				fmt.Printf("Started session '%s'\n", args[1])
+			default:
+				fmt.Printf("error: %v\n", err)
+			}
+			continue
+		case strings.HasPrefix(line, "/fork"):
+			args := strings.Fields(line)
+			if len(args) != 2 {
+				fmt.Println("Usage:\n  /fork <session>")
+				continue
+			}
+
+			if _, err := loadSession(args[1]); !errors.Is(err, os.ErrNotExist) {
+				if err == nil {
+					fmt.Printf("error: session '%s' already exists\n", args[1])
+				} else {
+					fmt.Printf("error: %v\n", err)
+				}
+				continue
+			}
+
+			opts.Session = args[1]
+			fmt.Printf("Forked the conversation to session '%s'\n", args[1])
+			continue
+		case strings.HasPrefix(line, "/undo"):
+			i := lastUserMessage(opts.Messages)
+			if i < 0 {
+				fmt.Println("Nothing to undo.")
+				continue
+			}
+
+			opts.Messages = opts.Messages[:i]
+			fmt.Println("Removed the last message and response.")
+			continue
+		case strings.HasPrefix(line, "/retry"):
+			i := lastUserMessage(opts.Messages)
+			if i < 0 {
+				fmt.Println("Nothing to retry.")
+				continue
+			}
+
+			opts.Messages = opts.Messages[:i+1]
+			assistant, err := chat(cmd, opts)
+			if err != nil {
+				return err
+			}
+			if assistant != nil {
+				opts.Messages = append(opts.Messages, *assistant)
+			}
+			continue
+		case strings.HasPrefix(line, "/copy"):
+			var response string
+			for i := len(opts.Messages) - 1; i >= 0; i-- {
+				if opts.Messages[i].Role == "assistant" {
+					response = opts.Messages[i].Content
+					break
+				}
+			}
+
+			if response == "" {
+				fmt.Println("Nothing to copy.")
+				continue
+			}
+
+			args := strings.Fields(line)
+			if len(args) < 2 || args[1] != "all" {
+				block, ok := lastCodeBlock(response)
+				if !ok {
+					fmt.Println("The last response has no code block. Use '/copy all' to copy all of it.")
+					continue
+				}
+				response = block
+			}
+
+			copyToClipboard(os.Stdout, response)
+			fmt.Println("Copied to the clipboard.")
+			continue
+		case strings.HasPrefix(line, "/attach"):
+			args := strings.Fields(line)
+			if len(args) == 1 {
+				if len(attachments) == 0 {
+					fmt.Println("Usage:\n  /attach <path|url|glob> ...")
+				}
+
+				for _, a := range attachments {
+					fmt.Printf("%s (%s)\n", a.name, format.HumanBytes(int64(len(a.content))))
+				}
+				continue
+			}
+
+			files, err := collectAttachments(cmd.Context(), args[1:])
+			if err == nil && len(files) == 0 {
+				err = errors.New("no text files found")
+			}
+
+			if err == nil {
+				err = checkAttachmentsBudget(cmd.Context(), opts, append(slices.Clip(attachments), files...))
+			}
+
+			if err != nil {
+				fmt.Printf("Couldn't attach files: %v\n", err)
+				continue
+			}
+
+			attachments = append(attachments, files...)
+			fmt.Printf("Attached %d file(s) to the next message.\n", len(files))
+			continue
 		case strings.HasPrefix(line, "/clear"):
+			attachments = nil
 			opts.Messages = []api.Message{}
 			if opts.System != "" {
 				newMessage := api.Message{Role: "system", Content: opts.System}
@@ -271,6 +454,19 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 				case "nowordwrap":
 					opts.WordWrap = false
 					fmt.Println("Set 'nowordwrap' mode.")
+				case "markdown":
+					if !term.IsTerminal(int(os.Stdout.Fd())) {
+						fmt.Println("Markdown can only be rendered to a terminal.")
+						continue
+					}
+					opts.Markdown = true
+					fmt.Println("Set 'markdown' mode.")
+					if opts.Format != "" {
+						fmt.Println("Markdown isn't rendered until the format is disabled with '/set noformat'.")
+					}
+				case "nomarkdown":
+					opts.Markdown = false
+					fmt.Println("Set 'nomarkdown' mode.")
 				case "verbose":
 					if err := cmd.Flags().Set("verbose", "true"); err != nil {
 						return err
@@ -474,6 +670,30 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 				newMessage.Images = images
 			}
 
+			msg, refs, err := extractAttachments(cmd.Context(), newMessage.Content)
+			if err != nil {
+				fmt.Printf("Couldn't attach files: %v\n", err)
+				sb.Reset()
+				continue
+			}
+
+			if files := append(attachments, refs...); len(files) > 0 {
+				if err := checkAttachmentsBudget(cmd.Context(), opts, files); err != nil {
+					fmt.Printf("Couldn't attach files: %v\n", err)
+					sb.Reset()
+					continue
+				}
+
+				for _, a := range files {
+					fmt.Fprintf(os.Stderr, "Added file '%s'\n", a.name)
+				}
+
+				msg += formatAttachments(files)
+				attachments = nil
+			}
+
+			newMessage.Content = msg
+
 			opts.Messages = append(opts.Messages, newMessage)
 
 			assistant, err := chat(cmd, opts)
@@ -620,3 +840,157 @@ func getImageData(filePath string) ([]byte, error) {
 
 	return buf, nil
 }
+
+// interactiveCommands are the commands completed at the start of a line
+var interactiveCommands = []string{"/attach", "/bye", "/clear", "/copy", "/exit", "/fork", "/help", "/list", "/load", "/retry", "/save", "/sessions", "/set", "/show", "/undo", "/?"}
+
+// interactiveArgs are the arguments completed after a command
+var interactiveArgs = map[string][]string{
+	"/set":        {"format", "history", "markdown", "noformat", "nohistory", "nomarkdown", "nowordwrap", "parameter", "quiet", "system", "verbose", "wordwrap"},
+	"/copy":       {"all"},
+	"/set format": {"json"},
+	"/show":       {"info", "license", "modelfile", "parameters", "system", "template"},
+	"/help":       {"set", "shortcuts", "show"},
+	"/?":          {"set", "shortcuts", "show"},
+}
+
+// completer completes the commands, parameter names, model names and image
+// paths of the interactive prompt
+type completer struct {
+	opts *runOptions
+
+	// models returns the names of the local models
+	models func() []string
+}
+
+func (c *completer) Complete(line []rune, pos int) ([]string, int) {
+	before := string(line[:pos])
+	word := lastWord(before)
+	args := strings.Fields(strings.TrimSuffix(before, word))
+	length := utf8.RuneCountInString(word)
+
+	var candidates []string
+	switch {
+	case len(args) == 0 && strings.HasPrefix(word, "/"):
+		candidates = matchPrefix(interactiveCommands, word)
+	case len(args) == 1 && args[0] == "/load":
+		candidates = matchPrefix(c.models(), word)
+	case len(args) == 1 && args[0] == "/sessions":
+		sessions, _ := listSessions()
+		for _, s := range sessions {
+			if strings.HasPrefix(s.Name, word) {
+				candidates = append(candidates, s.Name)
+			}
+		}
+	case len(args) == 2 && args[0] == "/set" && args[1] == "parameter":
+		candidates = matchPrefix(optionNames(), word)
+	case len(args) > 0 && len(args) <= 2:
+		candidates = matchPrefix(interactiveArgs[strings.Join(args, " ")], word)
+	}
+
+	if len(candidates) > 0 {
+		return candidates, length
+	}
+
+	switch {
+	case len(args) > 0 && args[0] == "/attach":
+		return completeFilePath(word, false)
+	case strings.HasPrefix(word, "@"):
+		return completeFilePath(word[1:], false)
+	case c.opts.MultiModal && filePathPrefix.MatchString(word):
+		return completeFilePath(word, true)
+	}
+
+	// a command which can't be completed rings the bell rather than taking
+	// Tab as spaces
+	if strings.HasPrefix(before, "/") {
+		return nil, length
+	}
+
+	return nil, 0
+}
+
+// lastWord returns the text after the last unescaped space in s
+func lastWord(s string) string {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == ' ' && (i == 0 || s[i-1] != '\\') {
+			return s[i+1:]
+		}
+	}
+
+	return s
+}
+
+func matchPrefix(ss []string, prefix string) []string {
+	var matches []string
+	for _, s := range ss {
+		if strings.HasPrefix(s, prefix) {
+			matches = append(matches, s)
+		}
+	}
+
+	return matches
+}
+
+// optionNames returns the names of the parameters which can be set, taken
+// from the JSON tags of api.Options
+func optionNames() []string {
+	var names []string
+
+	var walk func(reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if field.Anonymous {
+				walk(field.Type)
+				continue
+			}
+
+			if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	walk(reflect.TypeOf(api.Options{}))
+	slices.Sort(names)
+	return names
+}
+
+// filePathPrefix matches the start of the paths extractFileNames finds
+var filePathPrefix = regexp.MustCompile(`^(?:[a-zA-Z]:)?(?:\.{0,2}/|\.?\\)`)
+
+// completeFilePath completes the last element of the path p with the
+// directories and files, or only images, in its directory
+func completeFilePath(p string, images bool) ([]string, int) {
+	dir, base := "", p
+	if i := strings.LastIndexAny(p, "/"+string(filepath.Separator)); i >= 0 {
+		dir, base = p[:i+1], p[i+1:]
+	}
+
+	length := utf8.RuneCountInString(base)
+
+	entries, err := os.ReadDir(cmp.Or(normalizeFilePath(dir), "."))
+	if err != nil {
+		return nil, length
+	}
+
+	prefix := normalizeFilePath(base)
+	escape := strings.NewReplacer(" ", `\ `)
+
+	var candidates []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+
+		if fi, err := os.Stat(filepath.Join(normalizeFilePath(dir), name)); err == nil && fi.IsDir() {
+			candidates = append(candidates, escape.Replace(name)+string(filepath.Separator))
+		} else if !images || slices.Contains([]string{".jpg", ".jpeg", ".png"}, strings.ToLower(filepath.Ext(name))) {
+			candidates = append(candidates, escape.Replace(name))
+		}
+	}
+
+	return candidates, length
+}
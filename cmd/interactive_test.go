@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -105,3 +107,51 @@ MESSAGE assistant Yes it is true, I am half horse, half shark.
 		}
 	})
 }
+
+func TestCompleter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"cat.png", "cat.txt", "dog.jpg", "my pictures/bird.png"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &completer{
+		opts:   &runOptions{MultiModal: true},
+		models: func() []string { return []string{"llama3:latest", "llava:latest", "mistral:latest"} },
+	}
+
+	sep := string(filepath.Separator)
+	cases := []struct {
+		line       string
+		candidates []string
+		length     int
+	}{
+		{"/s", []string{"/save", "/sessions", "/set", "/show"}, 2},
+		{"/set p", []string{"parameter"}, 1},
+		{"/set parameter num_", []string{"num_batch", "num_ctx", "num_gpu", "num_keep", "num_predict", "num_thread"}, 4},
+		{"/set format ", []string{"json"}, 0},
+		{"/show mod", []string{"modelfile"}, 3},
+		{"/load ll", []string{"llama3:latest", "llava:latest"}, 2},
+		{"/set x", nil, 1},
+		{"hello wor", nil, 0},
+		{"what is in " + dir + sep + "c", []string{"cat.png"}, 1},
+		{"what is in " + dir + sep, []string{"cat.png", "dog.jpg", `my\ pictures` + sep}, 0},
+		{"what is in " + dir + sep + `my\ pictures` + sep, []string{"bird.png"}, 0},
+		{"explain @" + dir + sep + "cat", []string{"cat.png", "cat.txt"}, 3},
+		{"/attach " + dir + sep + "cat.t", []string{"cat.txt"}, 5},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.line, func(t *testing.T) {
+			candidates, length := c.Complete([]rune(tt.line), len([]rune(tt.line)))
+			assert.Equal(t, tt.candidates, candidates)
+			assert.Equal(t, tt.length, length)
+		})
+	}
+}
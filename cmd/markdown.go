@@ -0,0 +1,588 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+const (
+	mdReset   = "\x1b[0m"
+	mdBold    = "\x1b[1m"
+	mdItalic  = "\x1b[3m"
+	mdGrey    = "\x1b[38;5;245m"
+	mdCode    = "\x1b[38;5;180m"
+	mdHeading = "\x1b[1;38;5;75m"
+	mdKeyword = "\x1b[38;5;170m"
+	mdString  = "\x1b[38;5;114m"
+	mdNumber  = "\x1b[38;5;179m"
+)
+
+type markdownLine int
+
+const (
+	// markdownLineStart is a line which hasn't been seen enough of to know
+	// how to render it
+	markdownLineStart markdownLine = iota
+
+	// markdownLineProse is a line of text which is rendered as it streams in
+	markdownLineProse
+
+	// markdownLineBuffered is a line which is rendered once it's complete,
+	// such as a heading, table row or line of code
+	markdownLineBuffered
+)
+
+var orderedListItem = regexp.MustCompile(`^\d+[.)] `)
+
+// markdownRenderer renders markdown to a terminal as it streams in. Prose is
+// written a word at a time so it can be wrapped, while headings, tables and
+// code are written a line at a time.
+type markdownRenderer struct {
+	w io.Writer
+
+	// width is the column to wrap prose at, or 0 to not wrap
+	width int
+
+	kind markdownLine
+	line []rune
+
+	// the column of the cursor and the indent of wrapped prose
+	column int
+	indent int
+
+	// the word being written and its width
+	word      strings.Builder
+	wordWidth int
+	prev      rune
+
+	bold, italic, code bool
+
+	// star is set when a '*' has been seen and the next rune decides
+	// whether it's bold, italic or literal
+	star bool
+
+	// fence is the fence of the code block being written and lang its language
+	fence string
+	lang  string
+
+	table        [][]string
+	tableNewline bool
+}
+
+func newMarkdownRenderer(w io.Writer, width int) *markdownRenderer {
+	return &markdownRenderer{w: w, width: width}
+}
+
+// markdownWidth returns the column to wrap markdown written to stdout at, the
+// same as displayResponse
+func markdownWidth(wordWrap bool) int {
+	termWidth, _, _ := term.GetSize(int(os.Stdout.Fd()))
+	if !wordWrap || termWidth < 10 {
+		return 0
+	}
+
+	return termWidth - 5
+}
+
+// Write renders the next part of the markdown
+func (r *markdownRenderer) Write(s string) {
+	for _, c := range s {
+		switch r.kind {
+		case markdownLineStart:
+			if c == '\n' {
+				r.renderLine(string(r.line), true)
+				continue
+			}
+
+			r.line = append(r.line, c)
+			r.classify()
+		case markdownLineBuffered:
+			if c == '\n' {
+				r.renderLine(string(r.line), true)
+				continue
+			}
+
+			r.line = append(r.line, c)
+		case markdownLineProse:
+			if c == '\n' {
+				r.endProse(true)
+				continue
+			}
+
+			r.inline(c)
+		}
+	}
+}
+
+// Flush renders what's left of the markdown when the stream ends
+func (r *markdownRenderer) Flush() {
+	switch r.kind {
+	case markdownLineProse:
+		r.endProse(false)
+	default:
+		if len(r.line) > 0 {
+			r.renderLine(string(r.line), false)
+		}
+	}
+
+	r.flushTable()
+	r.fence, r.lang = "", ""
+}
+
+// classify decides how the line being written is rendered once enough of it
+// has been seen
+func (r *markdownRenderer) classify() {
+	trimmed := strings.TrimLeft(string(r.line), " \t")
+	if len([]rune(trimmed)) < 3 {
+		return
+	}
+
+	switch {
+	case r.fence != "",
+		strings.HasPrefix(trimmed, "```"),
+		strings.HasPrefix(trimmed, "~~~"),
+		strings.HasPrefix(trimmed, "#"),
+		strings.HasPrefix(trimmed, "|"),
+		strings.HasPrefix(trimmed, "---"),
+		strings.HasPrefix(trimmed, "***"),
+		strings.HasPrefix(trimmed, "___"):
+		r.kind = markdownLineBuffered
+	default:
+		r.startProse(string(r.line))
+	}
+}
+
+// renderLine renders a complete line, followed by a newline if it had one
+func (r *markdownRenderer) renderLine(line string, newline bool) {
+	r.kind, r.line = markdownLineStart, nil
+
+	trimmed := strings.TrimSpace(line)
+	if r.fence == "" && strings.HasPrefix(trimmed, "|") {
+		r.table = append(r.table, splitTableRow(trimmed))
+		r.tableNewline = newline
+		return
+	}
+
+	r.flushTable()
+
+	switch {
+	case r.fence != "":
+		if strings.HasPrefix(trimmed, r.fence) && strings.Trim(trimmed, r.fence[:1]) == "" {
+			fmt.Fprint(r.w, mdGrey+line+mdReset)
+			r.fence, r.lang = "", ""
+		} else {
+			fmt.Fprint(r.w, highlight(r.lang, line))
+		}
+	case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+		r.fence = trimmed[:3]
+		r.lang, _, _ = strings.Cut(strings.TrimSpace(trimmed[3:]), " ")
+		fmt.Fprint(r.w, mdGrey+line+mdReset)
+	case strings.HasPrefix(trimmed, "#"):
+		fmt.Fprint(r.w, mdHeading+strings.TrimSpace(strings.TrimLeft(trimmed, "#"))+mdReset)
+	case len(trimmed) >= 3 && strings.Count(trimmed, trimmed[:1]) == len(trimmed) && strings.Contains("-*_", trimmed[:1]):
+		fmt.Fprint(r.w, mdGrey+strings.Repeat("─", cmp.Or(r.width, 40))+mdReset)
+	case trimmed == "":
+	default:
+		r.startProse(line)
+		r.endProse(newline)
+		return
+	}
+
+	if newline {
+		fmt.Fprintln(r.w)
+	}
+}
+
+// startProse writes the start of a line of prose, replacing list markers
+// with bullets and quote markers with a bar
+func (r *markdownRenderer) startProse(line string) {
+	r.flushTable()
+	r.kind, r.line = markdownLineProse, nil
+
+	content := strings.TrimLeft(line, " \t")
+	prefix := line[:len(line)-len(content)]
+	width := runewidth.StringWidth(prefix)
+
+	switch {
+	case len(content) >= 2 && strings.ContainsRune("-*+", rune(content[0])) && content[1] == ' ':
+		prefix += "• "
+		width += 2
+		content = content[2:]
+	case strings.HasPrefix(content, ">"):
+		prefix += mdGrey + "│ " + mdReset
+		width += 2
+		content = strings.TrimPrefix(content[1:], " ")
+	case orderedListItem.MatchString(content):
+		marker := orderedListItem.FindString(content)
+		prefix += marker
+		width += len(marker)
+		content = content[len(marker):]
+	}
+
+	fmt.Fprint(r.w, prefix)
+	r.column, r.indent = width, width
+	r.prev = ' '
+
+	for _, c := range content {
+		r.inline(c)
+	}
+}
+
+// endProse finishes a line of prose. Inline styles don't carry over to the
+// next line.
+func (r *markdownRenderer) endProse(newline bool) {
+	if r.star {
+		r.star = false
+		r.emit('*')
+	}
+
+	r.flushWord()
+	if r.bold || r.italic || r.code {
+		fmt.Fprint(r.w, mdReset)
+		r.bold, r.italic, r.code = false, false, false
+	}
+
+	if newline {
+		fmt.Fprintln(r.w)
+	}
+
+	r.kind, r.line = markdownLineStart, nil
+	r.column, r.indent = 0, 0
+}
+
+// inline writes a rune of prose, turning emphasis and code spans into styles
+func (r *markdownRenderer) inline(c rune) {
+	if r.star {
+		r.star = false
+		if c == '*' {
+			r.bold = !r.bold
+			r.word.WriteString(mdReset + r.style())
+			return
+		}
+
+		// a '*' opens emphasis before a word and closes it after one
+		if (!r.italic && !unicode.IsSpace(c)) || (r.italic && !unicode.IsSpace(r.prev)) {
+			r.italic = !r.italic
+			r.word.WriteString(mdReset + r.style())
+		} else {
+			r.emit('*')
+		}
+	}
+
+	switch {
+	case c == '`':
+		r.code = !r.code
+		r.word.WriteString(mdReset + r.style())
+	case c == '*' && !r.code:
+		r.star = true
+	default:
+		r.emit(c)
+	}
+}
+
+func (r *markdownRenderer) style() string {
+	var sb strings.Builder
+	if r.bold {
+		sb.WriteString(mdBold)
+	}
+
+	if r.italic {
+		sb.WriteString(mdItalic)
+	}
+
+	if r.code {
+		sb.WriteString(mdCode)
+	}
+
+	return sb.String()
+}
+
+// emit adds a visible rune to the word being written, writing the word when
+// it ends
+func (r *markdownRenderer) emit(c rune) {
+	r.prev = c
+	if c == ' ' || c == '\t' {
+		r.flushWord()
+		if r.width > 0 && r.column >= r.width {
+			fmt.Fprint(r.w, "\n"+strings.Repeat(" ", r.indent))
+			r.column = r.indent
+		} else {
+			fmt.Fprint(r.w, string(c))
+			r.column += 1
+		}
+		return
+	}
+
+	r.word.WriteRune(c)
+	r.wordWidth += runewidth.RuneWidth(c)
+
+	// words too long for a line are broken
+	if r.width > 0 && r.wordWidth >= r.width-r.indent {
+		r.flushWord()
+	}
+}
+
+// flushWord writes the word being written, moving to the next line first if
+// it doesn't fit on this one
+func (r *markdownRenderer) flushWord() {
+	if r.word.Len() == 0 {
+		return
+	}
+
+	if r.width > 0 && r.wordWidth > 0 && r.column+r.wordWidth > r.width && r.column > r.indent {
+		fmt.Fprint(r.w, "\n"+strings.Repeat(" ", r.indent))
+		r.column = r.indent
+	}
+
+	fmt.Fprint(r.w, r.word.String())
+	r.column += r.wordWidth
+	r.word.Reset()
+	r.wordWidth = 0
+}
+
+func splitTableRow(row string) []string {
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+
+	var cells []string
+	for _, cell := range strings.Split(row, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+
+	return cells
+}
+
+// flushTable writes the rows of the table being written with their columns
+// aligned
+func (r *markdownRenderer) flushTable() {
+	if len(r.table) == 0 {
+		return
+	}
+
+	rows := slices.DeleteFunc(r.table, func(row []string) bool {
+		return strings.Trim(strings.Join(row, ""), "-: ") == ""
+	})
+	r.table = nil
+
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], runewidth.StringWidth(cell))
+		}
+	}
+
+	for i, row := range rows {
+		var cells []string
+		for j, cell := range row {
+			cells = append(cells, runewidth.FillRight(cell, widths[j]))
+		}
+
+		line := strings.TrimRight(strings.Join(cells, "  "), " ")
+		if i == 0 && len(rows) > 1 {
+			line = mdBold + line + mdReset
+		}
+
+		fmt.Fprint(r.w, line)
+		if i < len(rows)-1 || r.tableNewline {
+			fmt.Fprintln(r.w)
+		}
+	}
+}
+
+type language struct {
+	comment  string
+	quotes   string
+	keywords []string
+}
+
+var languages = map[string]language{
+	"go": {
+		comment: "//",
+		quotes:  "\"'`",
+		keywords: []string{
+			"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto",
+			"if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+			"nil", "true", "false", "iota",
+		},
+	},
+	"python": {
+		comment: "#",
+		quotes:  "\"'",
+		keywords: []string{
+			"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except",
+			"finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise",
+			"return", "try", "while", "with", "yield", "None", "True", "False", "self",
+		},
+	},
+	"javascript": {
+		comment: "//",
+		quotes:  "\"'`",
+		keywords: []string{
+			"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do", "else",
+			"export", "extends", "finally", "for", "from", "function", "if", "import", "in", "instanceof", "interface", "let",
+			"new", "of", "return", "switch", "this", "throw", "try", "type", "typeof", "var", "void", "while", "yield",
+			"null", "undefined", "true", "false",
+		},
+	},
+	"rust": {
+		comment: "//",
+		quotes:  "\"",
+		keywords: []string{
+			"as", "async", "await", "break", "const", "continue", "crate", "else", "enum", "extern", "fn", "for", "if", "impl",
+			"in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct",
+			"super", "trait", "type", "unsafe", "use", "where", "while", "true", "false", "Some", "None", "Ok", "Err",
+		},
+	},
+	"c": {
+		comment: "//",
+		quotes:  "\"'",
+		keywords: []string{
+			"auto", "bool", "break", "case", "catch", "char", "class", "const", "continue", "default", "delete", "do", "double",
+			"else", "enum", "extends", "extern", "final", "float", "for", "if", "implements", "import", "include", "int",
+			"long", "namespace", "new", "private", "protected", "public", "return", "short", "signed", "sizeof", "static",
+			"struct", "switch", "template", "this", "throw", "try", "typedef", "union", "unsigned", "using", "virtual",
+			"void", "volatile", "while", "true", "false", "null", "nullptr", "NULL",
+		},
+	},
+	"shell": {
+		comment: "#",
+		quotes:  "\"'",
+		keywords: []string{
+			"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if", "in", "local", "return",
+			"then", "until", "while",
+		},
+	},
+}
+
+var languageAliases = map[string]string{
+	"golang":     "go",
+	"py":         "python",
+	"python3":    "python",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "javascript",
+	"tsx":        "javascript",
+	"typescript": "javascript",
+	"rs":         "rust",
+	"cpp":        "c",
+	"c++":        "c",
+	"cc":         "c",
+	"h":          "c",
+	"java":       "c",
+	"cs":         "c",
+	"csharp":     "c",
+	"sh":         "shell",
+	"bash":       "shell",
+	"zsh":        "shell",
+	"console":    "shell",
+}
+
+// highlight colors the keywords, strings, numbers and comments of a line of
+// code. Lines in languages it doesn't know are returned unchanged.
+func highlight(lang, line string) string {
+	lang = strings.ToLower(lang)
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+
+	l, ok := languages[lang]
+	if !ok {
+		return line
+	}
+
+	var sb strings.Builder
+	rs := []rune(line)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case strings.HasPrefix(string(rs[i:]), l.comment):
+			sb.WriteString(mdGrey + string(rs[i:]) + mdReset)
+			i = len(rs)
+		case strings.ContainsRune(l.quotes, c):
+			j := i + 1
+			for j < len(rs) && rs[j] != c {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(rs))
+			sb.WriteString(mdString + string(rs[i:j]) + mdReset)
+			i = j
+		case unicode.IsDigit(c) && (i == 0 || !isIdentifier(rs[i-1])):
+			j := i
+			for j < len(rs) && (isIdentifier(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			sb.WriteString(mdNumber + string(rs[i:j]) + mdReset)
+			i = j
+		case isIdentifier(c):
+			j := i
+			for j < len(rs) && isIdentifier(rs[j]) {
+				j++
+			}
+
+			if word := string(rs[i:j]); slices.Contains(l.keywords, word) {
+				sb.WriteString(mdKeyword + word + mdReset)
+			} else {
+				sb.WriteString(word)
+			}
+			i = j
+		default:
+			sb.WriteRune(c)
+			i++
+		}
+	}
+
+	return sb.String()
+}
+
+func isIdentifier(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// lastCodeBlock returns the contents of the last fenced code block in
+// content, and whether there is one
+func lastCodeBlock(content string) (string, bool) {
+	var block []string
+	var fence string
+	var found bool
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			block = nil
+			found = true
+		case fence != "" && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "":
+			fence = ""
+		case fence != "":
+			block = append(block, line)
+		}
+	}
+
+	if !found {
+		return "", false
+	}
+
+	return strings.Join(block, "\n"), true
+}
+
+// copyToClipboard asks the terminal to put s on the clipboard with an OSC 52
+// escape sequence
+func copyToClipboard(w io.Writer, s string) {
+	fmt.Fprintf(w, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(s)))
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func renderMarkdown(width int, chunks ...string) string {
+	var sb strings.Builder
+	r := newMarkdownRenderer(&sb, width)
+	for _, chunk := range chunks {
+		r.Write(chunk)
+	}
+	r.Flush()
+	return sb.String()
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		width  int
+		expect string
+	}{
+		{
+			name:   "heading",
+			input:  "## Install\nRun it.",
+			expect: mdHeading + "Install" + mdReset + "\nRun it.",
+		},
+		{
+			name:   "emphasis",
+			input:  "a **bold** and *italic* `code` 5 * 3",
+			expect: "a " + mdReset + mdBold + "bold" + mdReset + " and " + mdReset + mdItalic + "italic" + mdReset + " " + mdReset + mdCode + "code" + mdReset + " 5 * 3",
+		},
+		{
+			name:   "lists",
+			input:  "- one\n  * two\n1. three\n> quote",
+			expect: "• one\n  • two\n1. three\n" + mdGrey + "│ " + mdReset + "quote",
+		},
+		{
+			name:   "code",
+			input:  "```go\nreturn \"x\", 1 // done\n```\n",
+			expect: mdGrey + "```go" + mdReset + "\n" + mdKeyword + "return" + mdReset + " " + mdString + "\"x\"" + mdReset + ", " + mdNumber + "1" + mdReset + " " + mdGrey + "// done" + mdReset + "\n" + mdGrey + "```" + mdReset + "\n",
+		},
+		{
+			name:   "unknown language",
+			input:  "```\n*not* markdown\n```",
+			expect: mdGrey + "```" + mdReset + "\n*not* markdown\n" + mdGrey + "```" + mdReset,
+		},
+		{
+			name:   "table",
+			input:  "| name | size |\n|---|---:|\n| llama3 | 4.7GB |\n\nAfter",
+			expect: mdBold + "name    size" + mdReset + "\nllama3  4.7GB\n\nAfter",
+		},
+		{
+			name:   "rule",
+			input:  "---\n",
+			width:  10,
+			expect: mdGrey + strings.Repeat("─", 10) + mdReset + "\n",
+		},
+		{
+			name:   "wrap",
+			input:  "- the quick brown fox jumps",
+			width:  12,
+			expect: "• the quick \n  brown fox \n  jumps",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.expect, renderMarkdown(tt.width, tt.input)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+
+			// the output is the same however the input is streamed
+			var runes []string
+			for _, r := range tt.input {
+				runes = append(runes, string(r))
+			}
+
+			if diff := cmp.Diff(tt.expect, renderMarkdown(tt.width, runes...)); diff != "" {
+				t.Errorf("streamed mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLastCodeBlock(t *testing.T) {
+	content := "First:\n```go\nfmt.Println(1)\n```\nThen:\n~~~python\nprint(2)\n\nprint(3)\n~~~\nDone."
+	block, ok := lastCodeBlock(content)
+	if !ok {
+		t.Fatal("expected a code block")
+	}
+
+	if diff := cmp.Diff("print(2)\n\nprint(3)", block); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, ok := lastCodeBlock("no code here"); ok {
+		t.Error("expected no code block")
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	cases := []struct {
+		opts runOptions
+		want bool
+	}{
+		{runOptions{Markdown: true}, true},
+		{runOptions{}, false},
+		{runOptions{Markdown: true, Format: "json"}, false},
+		{runOptions{Format: "json"}, false},
+	}
+
+	for _, tt := range cases {
+		if got := tt.opts.renderMarkdown(); got != tt.want {
+			t.Errorf("markdown %t, format %q: expected %t, got %t", tt.opts.Markdown, tt.opts.Format, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ollama/ollama/api"
+)
+
+var outputFormats = []string{"text", "json", "jsonl"}
+
+// applyRunFlags sets the options given by the flags of `ollama run` which
+// shape the request, such as the system message and model parameters
+func applyRunFlags(cmd *cobra.Command, opts *runOptions) error {
+	flags := cmd.Flags()
+
+	system, err := flags.GetString("system")
+	if err != nil {
+		return err
+	}
+	if system != "" {
+		opts.System = system
+	}
+
+	options, err := flags.GetStringArray("option")
+	if err != nil {
+		return err
+	}
+
+	params := make(map[string][]string)
+	for _, option := range options {
+		k, v, ok := strings.Cut(option, "=")
+		if !ok {
+			return fmt.Errorf("invalid option %q, expected key=value", option)
+		}
+
+		k = strings.TrimSpace(k)
+		params[k] = append(params[k], strings.TrimSpace(v))
+	}
+
+	if len(params) > 0 {
+		fp, err := api.FormatParams(params)
+		if err != nil {
+			return err
+		}
+
+		if opts.Options == nil {
+			opts.Options = map[string]any{}
+		}
+
+		for k, v := range fp {
+			opts.Options[k] = v
+		}
+	}
+
+	format, err := flags.GetString("format")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "":
+	case "json":
+		opts.Format = format
+	default:
+		// anything else is a JSON schema the response must match
+		bts, err := os.ReadFile(format)
+		if err != nil {
+			return fmt.Errorf("format must be json or a JSON schema file: %w", err)
+		}
+
+		if !json.Valid(bts) {
+			return fmt.Errorf("%s isn't a valid JSON schema", format)
+		}
+
+		opts.Format = "json"
+		opts.Schema = strings.TrimSpace(string(bts))
+	}
+
+	images, err := flags.GetStringArray("image")
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		data, err := getImageData(normalizeFilePath(image))
+		if err != nil {
+			return fmt.Errorf("couldn't read image %s: %w", image, err)
+		}
+
+		opts.Images = append(opts.Images, data)
+	}
+
+	messages, err := flags.GetString("messages")
+	if err != nil {
+		return err
+	}
+	if messages != "" {
+		msgs, err := readMessages(messages)
+		if err != nil {
+			return err
+		}
+
+		opts.Messages = append(opts.Messages, msgs...)
+	}
+
+	if opts.Output, err = flags.GetString("output"); err != nil {
+		return err
+	}
+	if !slices.Contains(outputFormats, opts.Output) {
+		return fmt.Errorf("output must be one of %s", strings.Join(outputFormats, ", "))
+	}
+
+	if opts.EachLine, err = flags.GetBool("each-line"); err != nil {
+		return err
+	}
+
+	if opts.Parallel, err = flags.GetInt("parallel"); err != nil {
+		return err
+	}
+	if opts.Parallel < 1 {
+		return errors.New("parallel must be at least 1")
+	}
+
+	return nil
+}
+
+// readMessages reads a conversation from a JSON file, either a list of
+// messages or an object with a messages list such as a chat request
+func readMessages(path string) ([]api.Message, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []api.Message
+	if err := json.Unmarshal(bts, &messages); err == nil {
+		return messages, nil
+	}
+
+	var req struct {
+		Messages []api.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(bts, &req); err != nil {
+		return nil, fmt.Errorf("couldn't read messages from %s: %w", path, err)
+	}
+
+	return req.Messages, nil
+}
+
+// withSchema adds the JSON schema the response must match to the prompt
+func withSchema(prompt, schema string) string {
+	if schema == "" {
+		return prompt
+	}
+
+	return fmt.Sprintf("%s\n\nRespond with JSON which matches this JSON schema:\n%s", prompt, schema)
+}
+
+// chatMessages returns the conversation to send to the model: the system
+// message if there isn't one already, the messages so far and the prompt
+func chatMessages(opts runOptions) []api.Message {
+	var messages []api.Message
+	if opts.System != "" && !slices.ContainsFunc(opts.Messages, func(m api.Message) bool { return m.Role == "system" }) {
+		messages = append(messages, api.Message{Role: "system", Content: opts.System})
+	}
+
+	messages = append(messages, opts.Messages...)
+	if opts.Prompt != "" || len(opts.Images) > 0 {
+		messages = append(messages, api.Message{Role: "user", Content: opts.Prompt, Images: opts.Images})
+	}
+
+	return messages
+}
+
+// request sends the prompt in opts to the model, as a chat if there's a
+// conversation to continue and otherwise as a generate request. fn is called
+// with each response and the reply is returned.
+func request(ctx context.Context, client *api.Client, opts runOptions, stream bool, fn func(any) error) (*api.Message, error) {
+	var sb strings.Builder
+	if opts.Session != "" || len(opts.Messages) > 0 {
+		req := &api.ChatRequest{
+			Model:     opts.Model,
+			Messages:  chatMessages(opts),
+			Format:    opts.Format,
+			Options:   opts.Options,
+			KeepAlive: opts.KeepAlive,
+			Stream:    &stream,
+		}
+
+		if err := client.Chat(ctx, req, func(resp api.ChatResponse) error {
+			sb.WriteString(resp.Message.Content)
+			return fn(resp)
+		}); err != nil {
+			return nil, err
+		}
+
+		return &api.Message{Role: "assistant", Content: sb.String()}, nil
+	}
+
+	req := &api.GenerateRequest{
+		Model:     opts.Model,
+		Prompt:    opts.Prompt,
+		System:    opts.System,
+		Images:    opts.Images,
+		Format:    opts.Format,
+		Options:   opts.Options,
+		KeepAlive: opts.KeepAlive,
+		Stream:    &stream,
+	}
+
+	if err := client.Generate(ctx, req, func(resp api.GenerateResponse) error {
+		sb.WriteString(resp.Response)
+		return fn(resp)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &api.Message{Role: "assistant", Content: sb.String()}, nil
+}
+
+// generateOutput runs the prompt and writes the full responses, including
+// their metrics, as JSON: a single response for json, or each streamed
+// response on its own line for jsonl
+func generateOutput(cmd *cobra.Command, opts runOptions) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if opts.Output == "json" {
+		enc.SetIndent("", "  ")
+	}
+
+	reply, err := request(cmd.Context(), client, opts, opts.Output == "jsonl", func(resp any) error {
+		return enc.Encode(resp)
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.Session != "" {
+		opts.Messages = append(chatMessages(opts), *reply)
+		return saveSession(opts)
+	}
+
+	return nil
+}
+
+// generateEachLine runs a prompt for each of the lines, followed by args,
+// running up to opts.Parallel at once. The replies are written in the order
+// of the lines, up to the first line which fails.
+func generateEachLine(cmd *cobra.Command, opts runOptions, lines, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	lines = slices.DeleteFunc(lines, func(line string) bool {
+		return strings.TrimSpace(line) == ""
+	})
+
+	results := make([]any, len(lines))
+	errs := make([]error, len(lines))
+	done := make([]chan struct{}, len(lines))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	// lines after one which fails are cancelled, but the lines before it
+	// still finish so their replies are written
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	var g errgroup.Group
+	g.SetLimit(opts.Parallel)
+
+	launched := make(chan struct{})
+	go func() {
+		defer close(launched)
+		for i, line := range lines {
+			lineOpts := opts
+			lineOpts.Prompt = withSchema(strings.Join(append([]string{line}, args...), " "), opts.Schema)
+
+			g.Go(func() error {
+				defer close(done[i])
+				if ctx.Err() != nil {
+					errs[i] = ctx.Err()
+					return nil
+				}
+
+				reply, err := request(ctx, client, lineOpts, false, func(resp any) error {
+					results[i] = resp
+					return nil
+				})
+				if err != nil {
+					errs[i] = err
+					return nil
+				}
+
+				if opts.Output == "text" {
+					results[i] = reply.Content
+				}
+
+				return nil
+			})
+		}
+	}()
+
+	wait := func() {
+		<-launched
+		g.Wait()
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for i := range lines {
+		<-done[i]
+		if errs[i] != nil {
+			cancel()
+			wait()
+			return errs[i]
+		}
+
+		switch opts.Output {
+		case "text":
+			fmt.Println(strings.TrimSpace(results[i].(string)))
+		case "jsonl":
+			if err := enc.Encode(results[i]); err != nil {
+				cancel()
+				wait()
+				return err
+			}
+		}
+	}
+
+	wait()
+
+	if opts.Output == "json" {
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	return nil
+}
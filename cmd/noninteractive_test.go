@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestApplyRunFlags(t *testing.T) {
+	dir := t.TempDir()
+	schema := filepath.Join(dir, "schema.json")
+	if err := os.WriteFile(schema, []byte(`{"type": "object"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := filepath.Join(dir, "messages.json")
+	if err := os.WriteFile(messages, []byte(`{"model": "llama3", "messages": [{"role": "user", "content": "hi"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		flags map[string][]string
+		want  runOptions
+		err   bool
+	}{
+		{
+			name: "defaults",
+			want: runOptions{Output: "text", Parallel: 4},
+		},
+		{
+			name: "options",
+			flags: map[string][]string{
+				"system": {"Be brief."},
+				"option": {"temperature=0.5", "stop=a", "stop = b", "num_ctx=4096"},
+				"output": {"jsonl"},
+			},
+			want: runOptions{
+				System:   "Be brief.",
+				Options:  map[string]any{"temperature": float32(0.5), "stop": []string{"a", "b"}, "num_ctx": int64(4096)},
+				Output:   "jsonl",
+				Parallel: 4,
+			},
+		},
+		{
+			name:  "schema",
+			flags: map[string][]string{"format": {schema}, "messages": {messages}, "each-line": {"true"}, "parallel": {"2"}},
+			want: runOptions{
+				Format:   "json",
+				Schema:   `{"type": "object"}`,
+				Messages: []api.Message{{Role: "user", Content: "hi"}},
+				Output:   "text",
+				EachLine: true,
+				Parallel: 2,
+			},
+		},
+		{name: "unknown option", flags: map[string][]string{"option": {"temprature=0.5"}}, err: true},
+		{name: "bad option", flags: map[string][]string{"option": {"temperature"}}, err: true},
+		{name: "bad format", flags: map[string][]string{"format": {filepath.Join(dir, "missing.json")}}, err: true},
+		{name: "bad output", flags: map[string][]string{"output": {"yaml"}}, err: true},
+		{name: "bad parallel", flags: map[string][]string{"parallel": {"0"}}, err: true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _, err := NewCLI().Find([]string{"run"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, values := range tt.flags {
+				for _, v := range values {
+					if err := cmd.Flags().Set(name, v); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			var opts runOptions
+			err = applyRunFlags(cmd, &opts)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, opts); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadMessages(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "messages.json")
+	if err := os.WriteFile(p, []byte(`[{"role": "system", "content": "Be brief."}, {"role": "user", "content": "hi"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := readMessages(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []api.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}
+	if diff := cmp.Diff(want, messages); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(p, []byte(`hi`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readMessages(p); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestChatMessages(t *testing.T) {
+	image := api.ImageData("\x89PNG\r\n")
+
+	cases := []struct {
+		name string
+		opts runOptions
+		want []api.Message
+	}{
+		{
+			name: "prompt",
+			opts: runOptions{System: "Be brief.", Prompt: "hi", Images: []api.ImageData{image}},
+			want: []api.Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "hi", Images: []api.ImageData{image}},
+			},
+		},
+		{
+			name: "existing system",
+			opts: runOptions{
+				System:   "Be brief.",
+				Messages: []api.Message{{Role: "system", Content: "Be verbose."}, {Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}},
+				Prompt:   "bye",
+			},
+			want: []api.Message{
+				{Role: "system", Content: "Be verbose."},
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: "hello"},
+				{Role: "user", Content: "bye"},
+			},
+		},
+		{
+			name: "no prompt",
+			opts: runOptions{System: "Be brief."},
+			want: []api.Message{{Role: "system", Content: "Be brief."}},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, chatMessages(tt.opts)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithSchema(t *testing.T) {
+	if got := withSchema("hi", ""); got != "hi" {
+		t.Errorf("expected %q, got %q", "hi", got)
+	}
+
+	want := "hi\n\nRespond with JSON which matches this JSON schema:\n{\"type\": \"object\"}"
+	if got := withSchema("hi", `{"type": "object"}`); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- b
+	}()
+
+	fn()
+	w.Close()
+	return string(<-out)
+}
+
+func TestGenerateEachLine(t *testing.T) {
+	// earlier lines take longer so their replies arrive out of order
+	delays := map[string]time.Duration{
+		"a": 60 * time.Millisecond,
+		"b": 30 * time.Millisecond,
+		"c": 0,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.GenerateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		line, _, _ := strings.Cut(req.Prompt, " ")
+		if line == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "failed " + req.Prompt})
+			return
+		}
+
+		time.Sleep(delays[line])
+		json.NewEncoder(w).Encode(api.GenerateResponse{Model: req.Model, Response: " reply to " + req.Prompt + "\n", Done: true})
+	}))
+	defer srv.Close()
+
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	run := func(t *testing.T, output string, lines []string) (string, error) {
+		t.Helper()
+
+		cmd := &cobra.Command{}
+		cmd.SetContext(context.Background())
+
+		var err error
+		out := captureStdout(t, func() {
+			err = generateEachLine(cmd, runOptions{Model: "test", Output: output, Parallel: 3}, lines, []string{"!"})
+		})
+
+		return out, err
+	}
+
+	lines := []string{"a", "", "b", "  ", "c"}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := run(t, "text", lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff("reply to a !\nreply to b !\nreply to c !\n", out); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		out, err := run(t, "jsonl", lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var replies []string
+		dec := json.NewDecoder(strings.NewReader(out))
+		for dec.More() {
+			var resp api.GenerateResponse
+			if err := dec.Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			replies = append(replies, resp.Response)
+		}
+
+		if diff := cmp.Diff([]string{" reply to a !\n", " reply to b !\n", " reply to c !\n"}, replies); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+
+		if strings.Count(out, "\n") != 3 {
+			t.Errorf("expected a response per line, got %q", out)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := run(t, "json", lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var resps []api.GenerateResponse
+		if err := json.Unmarshal([]byte(out), &resps); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resps) != 3 {
+			t.Fatalf("expected 3 responses, got %d", len(resps))
+		}
+
+		for i, line := range []string{"a", "b", "c"} {
+			if want := " reply to " + line + " !\n"; resps[i].Response != want || !resps[i].Done {
+				t.Errorf("expected %q, got %+v", want, resps[i])
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		for _, output := range []string{"text", "jsonl", "json"} {
+			t.Run(output, func(t *testing.T) {
+				// c finishes before the line which fails but isn't written
+				out, err := run(t, output, []string{"a", "fail", "c"})
+				if err == nil || !strings.Contains(err.Error(), "failed fail !") {
+					t.Fatalf("expected the failed line's error, got %v", err)
+				}
+
+				want := map[string]string{"text": "reply to a !\n", "jsonl": "reply to a !", "json": ""}[output]
+				if !strings.Contains(out, want) || strings.Contains(out, "reply to c") {
+					t.Errorf("expected only the replies before the failed line, got %q", out)
+				}
+
+				if output == "json" && out != "" {
+					t.Errorf("expected no output, got %q", out)
+				}
+			})
+		}
+	})
+}
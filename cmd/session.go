@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/format"
+)
+
+var errInvalidSessionName = errors.New("session names may only contain letters, numbers, '_', '-' and '.'")
+
+var sessionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// session is a conversation in `ollama run` which is saved as it goes so it
+// can be resumed later
+type session struct {
+	Name       string         `json:"-"`
+	Model      string         `json:"model"`
+	System     string         `json:"system,omitempty"`
+	Format     string         `json:"format,omitempty"`
+	Options    map[string]any `json:"options,omitempty"`
+	Messages   []api.Message  `json:"messages"`
+	ModifiedAt time.Time      `json:"modified_at"`
+}
+
+func sessionsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "sessions"), nil
+}
+
+func sessionPath(name string) (string, error) {
+	if !sessionNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%w: %q", errInvalidSessionName, name)
+	}
+
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// loadSession reads the session name. The error wraps os.ErrNotExist if
+// there's no such session.
+func loadSession(name string) (*session, error) {
+	p, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var s session
+	if err := json.Unmarshal(bts, &s); err != nil {
+		return nil, fmt.Errorf("couldn't read session %q: %w", name, err)
+	}
+
+	s.Name = name
+	return &s, nil
+}
+
+// saveSession writes the conversation in opts to its session
+func saveSession(opts runOptions) error {
+	p, err := sessionPath(opts.Session)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(session{
+		Model:      opts.Model,
+		System:     opts.System,
+		Format:     opts.Format,
+		Options:    opts.Options,
+		Messages:   opts.Messages,
+		ModifiedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file so an interrupted save doesn't lose the session
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(bts); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+// listSessions returns the saved sessions, most recently modified first
+func listSessions() ([]*session, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*session
+	for _, match := range matches {
+		s, err := loadSession(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if err != nil {
+			continue
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	slices.SortFunc(sessions, func(a, b *session) int {
+		return b.ModifiedAt.Compare(a.ModifiedAt)
+	})
+
+	return sessions, nil
+}
+
+// restore replaces the conversation in opts with the session's
+func (s *session) restore(opts *runOptions) {
+	opts.Session = s.Name
+	opts.Model = s.Model
+	opts.System = s.System
+	opts.Format = s.Format
+	opts.Options = s.Options
+	if opts.Options == nil {
+		opts.Options = map[string]any{}
+	}
+	opts.Messages = s.Messages
+}
+
+// lastUserMessage returns the index of the last message from the user, or -1
+func lastUserMessage(messages []api.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// showSessions prints a table of the saved sessions, marking the current one
+func showSessions(current string) error {
+	sessions, err := listSessions()
+	if err != nil {
+		return err
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No sessions have been saved.")
+		return nil
+	}
+
+	var data [][]string
+	for _, s := range sessions {
+		name := s.Name
+		if name == current {
+			name += " *"
+		}
+
+		data = append(data, []string{name, s.Model, strconv.Itoa(len(s.Messages)), format.HumanTime(s.ModifiedAt, "Never")})
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"NAME", "MODEL", "MESSAGES", "MODIFIED"})
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestSession(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if _, err := loadSession("work"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+	}
+
+	opts := runOptions{
+		Model:   "llava",
+		System:  "You are a helpful assistant.",
+		Options: map[string]any{"temperature": 0.5},
+		Messages: []api.Message{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "What is in this picture?", Images: []api.ImageData{[]byte("\x89PNG\r\n")}},
+			{Role: "assistant", Content: "A cat."},
+		},
+		Session: "work",
+	}
+
+	if err := saveSession(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadSession("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored runOptions
+	s.restore(&restored)
+	if diff := cmp.Diff(opts, restored); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// sessions are listed most recent first
+	opts.Session = "play"
+	opts.Messages = opts.Messages[:lastUserMessage(opts.Messages)]
+	time.Sleep(10 * time.Millisecond)
+	if err := saveSession(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := listSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, s := range sessions {
+		names = append(names, s.Name)
+	}
+
+	if diff := cmp.Diff([]string{"play", "work"}, names); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if len(sessions[0].Messages) != 1 {
+		t.Errorf("expected the undone session to have 1 message, got %d", len(sessions[0].Messages))
+	}
+
+	for _, name := range []string{"", "../escape", ".hidden", "a/b"} {
+		if _, err := loadSession(name); !errors.Is(err, errInvalidSessionName) {
+			t.Errorf("%q: expected %v, got %v", name, errInvalidSessionName, err)
+		}
+	}
+}
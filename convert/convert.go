@@ -118,6 +118,18 @@ type AdapterConverter interface {
 	writeFile(io.WriteSeeker, llm.KV, []llm.Tensor) error
 }
 
+type ProjectorConverter interface {
+	// KV maps parameters to LLM key-values
+	KV() llm.KV
+	// Tensors maps input tensors to LLM tensors. Projector specific modifications can be done here.
+	Tensors([]Tensor) []llm.Tensor
+	// Replacements returns a list of string pairs to replace in tensor names.
+	// See [strings.Replacer](https://pkg.go.dev/strings#Replacer) for details
+	Replacements() []string
+
+	writeFile(io.WriteSeeker, llm.KV, []llm.Tensor) error
+}
+
 func ConvertAdapter(fsys fs.FS, ws io.WriteSeeker, baseKV llm.KV) error {
 	bts, err := fs.ReadFile(fsys, "adapter_config.json")
 	if err != nil {
@@ -161,18 +173,62 @@ func ConvertAdapter(fsys fs.FS, ws io.WriteSeeker, baseKV llm.KV) error {
 // Supported input model formats include safetensors.
 // Supported input tokenizers files include tokenizer.json (preferred) and tokenizer.model.
 func ConvertModel(fsys fs.FS, ws io.WriteSeeker) error {
-	bts, err := fs.ReadFile(fsys, "config.json")
+	conv, kv, ts, err := parseModel(fsys)
+	if err != nil {
+		return err
+	}
+
+	return conv.writeFile(ws, kv, ts)
+}
+
+// ConvertQuantizedModel is like ConvertModel but quantizes tensors to the file type
+// named by quantization, e.g. Q4_K_M, while they're written rather than writing an
+// F16 model for a separate quantization pass. fn, if not nil, is called after each
+// tensor is written with the number of unquantized bytes written so far.
+func ConvertQuantizedModel(fsys fs.FS, ws io.WriteSeeker, quantization string, fn func(completed, total int64)) error {
+	ft, err := llm.ParseFileType(quantization)
+	if err != nil {
+		return err
+	}
+
+	conv, kv, ts, err := parseModel(fsys)
+	if err != nil {
+		return err
+	}
+
+	ts, err = llm.QuantizeTensors(kv, ts, ft, fn)
 	if err != nil {
 		return err
 	}
 
+	kv["general.file_type"] = ft.Value()
+	return conv.writeFile(ws, kv, ts)
+}
+
+// InspectModel returns the metadata and tensors the model in fsys will have
+// once it's converted, without converting it
+func InspectModel(fsys fs.FS) (*llm.GGML, error) {
+	_, kv, ts, err := parseModel(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return llm.NewGGUF(kv, ts), nil
+}
+
+func parseModel(fsys fs.FS) (ModelConverter, llm.KV, []llm.Tensor, error) {
+	bts, err := fs.ReadFile(fsys, "config.json")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	var p ModelParameters
 	if err := json.Unmarshal(bts, &p); err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
 	if len(p.Architectures) < 1 {
-		return errors.New("unknown architecture")
+		return nil, nil, nil, errors.New("unknown architecture")
 	}
 
 	var conv ModelConverter
@@ -187,25 +243,33 @@ func ConvertModel(fsys fs.FS, ws io.WriteSeeker) error {
 		conv = &gemma2Model{}
 	case "Phi3ForCausalLM":
 		conv = &phi3Model{}
+	case "Qwen2ForCausalLM":
+		conv = &qwen2Model{}
+	case "Starcoder2ForCausalLM":
+		conv = &starcoder2Model{}
+	case "GPTNeoXForCausalLM":
+		conv = &gptneoxModel{}
 	case "BertModel":
 		conv = &bertModel{}
+	case "LlavaForConditionalGeneration", "LlavaNextForConditionalGeneration":
+		conv = &llavaModel{}
 	default:
-		return errors.New("unsupported architecture")
+		return nil, nil, nil, errors.New("unsupported architecture")
 	}
 
 	if err := json.Unmarshal(bts, conv); err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
 	if t, ok := conv.(moreParser); ok {
 		if err := t.parseMore(fsys); err != nil {
-			return err
+			return nil, nil, nil, err
 		}
 	}
 
 	t, err := parseTokenizer(fsys, conv.specialTokenTypes())
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
 	if vocabSize := int(p.VocabSize); vocabSize > len(t.Vocabulary.Tokens) {
@@ -219,10 +283,56 @@ func ConvertModel(fsys fs.FS, ws io.WriteSeeker) error {
 		slog.Debug("vocabulary", "size", len(t.Vocabulary.Tokens))
 	}
 
+	ts, err := parseTensors(fsys, strings.NewReplacer(conv.Replacements()...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return conv, conv.KV(t), conv.Tensors(ts), nil
+}
+
+// ErrNoProjector is returned by ConvertProjector when the model is text-only.
+var ErrNoProjector = errors.New("model does not have a vision projector")
+
+// ConvertProjector writes the vision encoder and multimodal projector of a model to
+// the provided io.WriteSeeker. The language model is converted separately by ConvertModel.
+func ConvertProjector(fsys fs.FS, ws io.WriteSeeker) error {
+	bts, err := fs.ReadFile(fsys, "config.json")
+	if err != nil {
+		return err
+	}
+
+	var p ModelParameters
+	if err := json.Unmarshal(bts, &p); err != nil {
+		return err
+	}
+
+	if len(p.Architectures) < 1 {
+		return errors.New("unknown architecture")
+	}
+
+	var conv ProjectorConverter
+	switch p.Architectures[0] {
+	case "LlavaForConditionalGeneration", "LlavaNextForConditionalGeneration":
+		conv = &llavaProjector{}
+	default:
+		return ErrNoProjector
+	}
+
+	if err := json.Unmarshal(bts, conv); err != nil {
+		return err
+	}
+
+	if t, ok := conv.(moreParser); ok {
+		if err := t.parseMore(fsys); err != nil {
+			return err
+		}
+	}
+
 	ts, err := parseTensors(fsys, strings.NewReplacer(conv.Replacements()...))
 	if err != nil {
 		return err
 	}
 
-	return conv.writeFile(ws, conv.KV(t), conv.Tensors(ts))
+	return conv.writeFile(ws, conv.KV(), conv.Tensors(ts))
 }
@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type gptneoxModel struct {
+	ModelParameters
+	MaxPositionEmbeddings uint32  `json:"max_position_embeddings"`
+	HiddenSize            uint32  `json:"hidden_size"`
+	HiddenLayers          uint32  `json:"num_hidden_layers"`
+	IntermediateSize      uint32  `json:"intermediate_size"`
+	NumAttentionHeads     uint32  `json:"num_attention_heads"`
+	RotaryPct             float32 `json:"rotary_pct"`
+	RotaryEmbBase         float32 `json:"rotary_emb_base"`
+	LayerNormEPS          float32 `json:"layer_norm_eps"`
+	UseParallelResidual   *bool   `json:"use_parallel_residual"`
+}
+
+var (
+	_ ModelConverter = (*gptneoxModel)(nil)
+	_ moreParser     = (*gptneoxModel)(nil)
+)
+
+func (p *gptneoxModel) parseMore(fs.FS) error {
+	if p.NumAttentionHeads == 0 {
+		return errors.New("gptneox: num_attention_heads is required")
+	}
+
+	// transformers' GPTNeoXConfig defaults rotary_pct to 0.25
+	p.RotaryPct = cmp.Or(p.RotaryPct, 0.25)
+	return nil
+}
+
+func (p *gptneoxModel) KV(t *Tokenizer) llm.KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "gptneox"
+	kv["gptneox.context_length"] = p.MaxPositionEmbeddings
+	kv["gptneox.embedding_length"] = p.HiddenSize
+	kv["gptneox.block_count"] = p.HiddenLayers
+	kv["gptneox.feed_forward_length"] = p.IntermediateSize
+	kv["gptneox.attention.head_count"] = p.NumAttentionHeads
+	kv["gptneox.attention.layer_norm_epsilon"] = p.LayerNormEPS
+	kv["gptneox.rope.dimension_count"] = uint32(p.RotaryPct * float32(p.HiddenSize/p.NumAttentionHeads))
+	// transformers defaults use_parallel_residual to true
+	kv["gptneox.use_parallel_residual"] = p.UseParallelResidual == nil || *p.UseParallelResidual
+
+	if p.RotaryEmbBase > 0 {
+		kv["gptneox.rope.freq_base"] = p.RotaryEmbBase
+	}
+
+	return kv
+}
+
+func (p *gptneoxModel) Tensors(ts []Tensor) []llm.Tensor {
+	var out []llm.Tensor
+	for _, t := range ts {
+		// older checkpoints include attention masks and rotary buffers
+		if strings.HasSuffix(t.Name(), ".attention.bias") ||
+			strings.HasSuffix(t.Name(), ".attention.masked_bias") ||
+			strings.HasSuffix(t.Name(), ".rotary_emb.inv_freq") {
+			continue
+		}
+
+		if strings.Contains(t.Name(), "attn_qkv.") {
+			t.SetRepacker(p.repack)
+		}
+
+		out = append(out, llm.Tensor{
+			Name:     t.Name(),
+			Kind:     t.Kind(),
+			Shape:    t.Shape(),
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *gptneoxModel) Replacements() []string {
+	return []string{
+		"gpt_neox.embed_in", "token_embd",
+		"gpt_neox.layers", "blk",
+		"gpt_neox.final_layer_norm", "output_norm",
+		"embed_out", "output",
+		"input_layernorm", "attn_norm",
+		"attention.query_key_value", "attn_qkv",
+		"attention.dense", "attn_output",
+		"post_attention_layernorm", "ffn_norm",
+		"mlp.dense_h_to_4h", "ffn_up",
+		"mlp.dense_4h_to_h", "ffn_down",
+	}
+}
+
+// repack reorders the fused qkv projection from per-head interleaved
+// [q, k, v] blocks into contiguous q, k and v blocks
+func (p *gptneoxModel) repack(name string, data []float32, shape []uint64) ([]float32, error) {
+	heads := int(p.NumAttentionHeads)
+	if heads == 0 || int(shape[0])%(3*heads) != 0 {
+		return nil, fmt.Errorf("invalid shape for repack: %s %v", name, shape)
+	}
+
+	stride := len(data) / int(shape[0])
+	headDim := int(shape[0]) / heads / 3
+
+	f32s := make([]float32, 0, len(data))
+	for qkv := range 3 {
+		for head := range heads {
+			start := (head*3 + qkv) * headDim * stride
+			f32s = append(f32s, data[start:start+headDim*stride]...)
+		}
+	}
+
+	return f32s, nil
+}
@@ -0,0 +1,247 @@
+package convert
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// llavaModel is the language model half of a LLaVA checkpoint. The vision
+// tower and multimodal projector are converted separately by llavaProjector.
+type llavaModel struct {
+	ModelParameters
+	TextConfig llamaModel `json:"text_config"`
+}
+
+var (
+	_ ModelConverter = (*llavaModel)(nil)
+	_ moreParser     = (*llavaModel)(nil)
+)
+
+func (p *llavaModel) parseMore(fs.FS) error {
+	// text_config only lists values which differ from the transformers
+	// LlamaConfig defaults
+	p.TextConfig.VocabSize = cmp.Or(p.TextConfig.VocabSize, p.VocabSize)
+	p.TextConfig.NumHiddenLayers = cmp.Or(p.TextConfig.NumHiddenLayers, 32)
+	p.TextConfig.MaxPositionEmbeddings = cmp.Or(p.TextConfig.MaxPositionEmbeddings, 2048)
+	p.TextConfig.HiddenSize = cmp.Or(p.TextConfig.HiddenSize, 4096)
+	p.TextConfig.IntermediateSize = cmp.Or(p.TextConfig.IntermediateSize, 11008)
+	p.TextConfig.NumAttentionHeads = cmp.Or(p.TextConfig.NumAttentionHeads, 32)
+	p.TextConfig.RopeTheta = cmp.Or(p.TextConfig.RopeTheta, 10000)
+	p.TextConfig.RMSNormEPS = cmp.Or(p.TextConfig.RMSNormEPS, 1e-6)
+	return nil
+}
+
+func (p *llavaModel) KV(t *Tokenizer) llm.KV {
+	return p.TextConfig.KV(t)
+}
+
+func (p *llavaModel) Tensors(ts []Tensor) []llm.Tensor {
+	var text []Tensor
+	for _, t := range ts {
+		if !isLlavaVisionTensor(t.Name()) {
+			text = append(text, t)
+		}
+	}
+
+	return p.TextConfig.Tensors(text)
+}
+
+func (p *llavaModel) Replacements() []string {
+	return append([]string{"language_model.", ""}, p.TextConfig.Replacements()...)
+}
+
+// isLlavaVisionTensor reports whether a LLaVA tensor belongs to the projector
+// rather than the language model
+func isLlavaVisionTensor(name string) bool {
+	return strings.HasPrefix(name, "vision_tower.") ||
+		strings.HasPrefix(name, "multi_modal_projector.") ||
+		strings.HasPrefix(name, "image_newline") ||
+		strings.HasPrefix(name, "v.") ||
+		strings.HasPrefix(name, "mm.") ||
+		strings.HasPrefix(name, "model.image_newline")
+}
+
+// llavaProjector is the CLIP vision tower and multimodal projector of a LLaVA
+// checkpoint. It is written in the layout expected by llama.cpp's clip
+// implementation.
+type llavaProjector struct {
+	ModelParameters
+	VisionConfig struct {
+		HiddenSize        uint32  `json:"hidden_size"`
+		ImageSize         uint32  `json:"image_size"`
+		IntermediateSize  uint32  `json:"intermediate_size"`
+		NumAttentionHeads uint32  `json:"num_attention_heads"`
+		NumHiddenLayers   uint32  `json:"num_hidden_layers"`
+		PatchSize         uint32  `json:"patch_size"`
+		ProjectionDim     uint32  `json:"projection_dim"`
+		LayerNormEPS      float32 `json:"layer_norm_eps"`
+		HiddenAct         string  `json:"hidden_act"`
+	} `json:"vision_config"`
+	VisionFeatureLayer *int32    `json:"vision_feature_layer"`
+	ImageGridPinpoints [][]int32 `json:"image_grid_pinpoints"`
+
+	ImageMean []float32 `json:"-"`
+	ImageStd  []float32 `json:"-"`
+}
+
+var (
+	_ ProjectorConverter = (*llavaProjector)(nil)
+	_ moreParser         = (*llavaProjector)(nil)
+)
+
+func (p *llavaProjector) parseMore(fsys fs.FS) error {
+	// vision_config only lists values which differ from the transformers
+	// CLIPVisionConfig defaults
+	p.VisionConfig.HiddenSize = cmp.Or(p.VisionConfig.HiddenSize, 768)
+	p.VisionConfig.ImageSize = cmp.Or(p.VisionConfig.ImageSize, 224)
+	p.VisionConfig.IntermediateSize = cmp.Or(p.VisionConfig.IntermediateSize, 3072)
+	p.VisionConfig.NumAttentionHeads = cmp.Or(p.VisionConfig.NumAttentionHeads, 12)
+	p.VisionConfig.NumHiddenLayers = cmp.Or(p.VisionConfig.NumHiddenLayers, 12)
+	p.VisionConfig.PatchSize = cmp.Or(p.VisionConfig.PatchSize, 32)
+	p.VisionConfig.ProjectionDim = cmp.Or(p.VisionConfig.ProjectionDim, 512)
+	p.VisionConfig.LayerNormEPS = cmp.Or(p.VisionConfig.LayerNormEPS, 1e-5)
+
+	// OpenAI CLIP normalization is used when the preprocessor doesn't specify one
+	p.ImageMean = []float32{0.48145466, 0.4578275, 0.40821073}
+	p.ImageStd = []float32{0.26862954, 0.26130258, 0.27577711}
+
+	bts, err := fs.ReadFile(fsys, "preprocessor_config.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var pp struct {
+		ImageMean          []float32 `json:"image_mean"`
+		ImageStd           []float32 `json:"image_std"`
+		ImageGridPinpoints [][]int32 `json:"image_grid_pinpoints"`
+	}
+
+	if err := json.Unmarshal(bts, &pp); err != nil {
+		return err
+	}
+
+	if len(pp.ImageMean) > 0 {
+		p.ImageMean = pp.ImageMean
+	}
+
+	if len(pp.ImageStd) > 0 {
+		p.ImageStd = pp.ImageStd
+	}
+
+	if len(p.ImageGridPinpoints) == 0 {
+		p.ImageGridPinpoints = pp.ImageGridPinpoints
+	}
+
+	return nil
+}
+
+// blockCount returns the number of vision encoder layers needed to produce
+// the features selected by vision_feature_layer
+func (p *llavaProjector) blockCount() uint32 {
+	featureLayer := int32(-2)
+	if p.VisionFeatureLayer != nil {
+		featureLayer = *p.VisionFeatureLayer
+	}
+
+	if featureLayer < 0 {
+		return uint32(int32(p.VisionConfig.NumHiddenLayers) + featureLayer + 1)
+	}
+
+	return uint32(featureLayer)
+}
+
+func (p *llavaProjector) KV() llm.KV {
+	kv := llm.KV{
+		"general.architecture":     "clip",
+		"general.file_type":        uint32(1),
+		"clip.has_text_encoder":    false,
+		"clip.has_vision_encoder":  true,
+		"clip.has_llava_projector": true,
+		"clip.projector_type":      "mlp",
+		"clip.use_gelu":            p.VisionConfig.HiddenAct == "gelu",
+	}
+
+	kv["clip.vision.image_size"] = p.VisionConfig.ImageSize
+	kv["clip.vision.patch_size"] = p.VisionConfig.PatchSize
+	kv["clip.vision.embedding_length"] = p.VisionConfig.HiddenSize
+	kv["clip.vision.feed_forward_length"] = p.VisionConfig.IntermediateSize
+	kv["clip.vision.projection_dim"] = p.VisionConfig.ProjectionDim
+	kv["clip.vision.attention.head_count"] = p.VisionConfig.NumAttentionHeads
+	kv["clip.vision.attention.layer_norm_epsilon"] = p.VisionConfig.LayerNormEPS
+	kv["clip.vision.block_count"] = p.blockCount()
+	kv["clip.vision.image_mean"] = p.ImageMean
+	kv["clip.vision.image_std"] = p.ImageStd
+
+	if len(p.ImageGridPinpoints) > 0 {
+		var pinpoints []int32
+		for _, pinpoint := range p.ImageGridPinpoints {
+			pinpoints = append(pinpoints, pinpoint...)
+		}
+
+		kv["clip.vision.image_grid_pinpoints"] = pinpoints
+		kv["clip.vision.mm_patch_merge_type"] = "spatial_unpad"
+		kv["clip.vision.image_aspect_ratio"] = "anyres"
+	}
+
+	return kv
+}
+
+func (p *llavaProjector) Tensors(ts []Tensor) []llm.Tensor {
+	blockCount := p.blockCount()
+
+	var out []llm.Tensor
+	for _, t := range ts {
+		name := t.Name()
+		if !isLlavaVisionTensor(name) || strings.HasSuffix(name, "position_ids") {
+			continue
+		}
+
+		// layers after the selected feature layer are never evaluated
+		var block uint32
+		if _, err := fmt.Sscanf(name, "v.blk.%d.", &block); err == nil && block >= blockCount {
+			continue
+		} else if strings.HasPrefix(name, "v.post_ln") && blockCount < p.VisionConfig.NumHiddenLayers {
+			continue
+		}
+
+		out = append(out, llm.Tensor{
+			Name:     name,
+			Kind:     t.Kind(),
+			Shape:    t.Shape(),
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *llavaProjector) Replacements() []string {
+	return []string{
+		"vision_tower.vision_model.embeddings.class_embedding", "v.class_embd",
+		"vision_tower.vision_model.embeddings.patch_embedding", "v.patch_embd",
+		"vision_tower.vision_model.embeddings.position_embedding", "v.position_embd",
+		"vision_tower.vision_model.pre_layrnorm", "v.pre_ln",
+		"vision_tower.vision_model.post_layernorm", "v.post_ln",
+		"vision_tower.vision_model.encoder.layers", "v.blk",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.out_proj", "attn_out",
+		"layer_norm1", "ln1",
+		"layer_norm2", "ln2",
+		"mlp.fc1", "ffn_down",
+		"mlp.fc2", "ffn_up",
+		"multi_modal_projector.linear_1", "mm.0",
+		"multi_modal_projector.linear_2", "mm.2",
+		"image_newline", "model.image_newline",
+	}
+}
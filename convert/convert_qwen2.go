@@ -0,0 +1,85 @@
+package convert
+
+import (
+	"github.com/ollama/ollama/llm"
+)
+
+type qwen2Model struct {
+	ModelParameters
+	MaxPositionEmbeddings uint32  `json:"max_position_embeddings"`
+	HiddenSize            uint32  `json:"hidden_size"`
+	HiddenLayers          uint32  `json:"num_hidden_layers"`
+	IntermediateSize      uint32  `json:"intermediate_size"`
+	NumAttentionHeads     uint32  `json:"num_attention_heads"`
+	NumKeyValueHeads      uint32  `json:"num_key_value_heads"`
+	RopeTheta             float32 `json:"rope_theta"`
+	RopeScaling           struct {
+		Type                          string  `json:"type"`
+		Factor                        float32 `json:"factor"`
+		OriginalMaxPositionEmbeddings uint32  `json:"original_max_position_embeddings"`
+	} `json:"rope_scaling"`
+	RMSNormEPS float32 `json:"rms_norm_eps"`
+}
+
+var _ ModelConverter = (*qwen2Model)(nil)
+
+func (p *qwen2Model) KV(t *Tokenizer) llm.KV {
+	kv := p.ModelParameters.KV(t)
+	kv["general.architecture"] = "qwen2"
+	kv["qwen2.context_length"] = p.MaxPositionEmbeddings
+	kv["qwen2.embedding_length"] = p.HiddenSize
+	kv["qwen2.block_count"] = p.HiddenLayers
+	kv["qwen2.feed_forward_length"] = p.IntermediateSize
+	kv["qwen2.attention.head_count"] = p.NumAttentionHeads
+	kv["qwen2.attention.head_count_kv"] = p.NumKeyValueHeads
+	kv["qwen2.attention.layer_norm_rms_epsilon"] = p.RMSNormEPS
+
+	if p.RopeTheta > 0 {
+		kv["qwen2.rope.freq_base"] = p.RopeTheta
+	}
+
+	switch p.RopeScaling.Type {
+	case "":
+		// no scaling
+	case "yarn", "linear":
+		kv["qwen2.rope.scaling.type"] = p.RopeScaling.Type
+		kv["qwen2.rope.scaling.factor"] = p.RopeScaling.Factor
+		if p.RopeScaling.OriginalMaxPositionEmbeddings > 0 {
+			kv["qwen2.rope.scaling.original_context_length"] = p.RopeScaling.OriginalMaxPositionEmbeddings
+		}
+	}
+
+	return kv
+}
+
+func (p *qwen2Model) Tensors(ts []Tensor) []llm.Tensor {
+	var out []llm.Tensor
+	for _, t := range ts {
+		out = append(out, llm.Tensor{
+			Name:     t.Name(),
+			Kind:     t.Kind(),
+			Shape:    t.Shape(),
+			WriterTo: t,
+		})
+	}
+
+	return out
+}
+
+func (p *qwen2Model) Replacements() []string {
+	return []string{
+		"lm_head", "output",
+		"model.embed_tokens", "token_embd",
+		"model.layers", "blk",
+		"input_layernorm", "attn_norm",
+		"self_attn.q_proj", "attn_q",
+		"self_attn.k_proj", "attn_k",
+		"self_attn.v_proj", "attn_v",
+		"self_attn.o_proj", "attn_output",
+		"mlp.down_proj", "ffn_down",
+		"mlp.gate_proj", "ffn_gate",
+		"mlp.up_proj", "ffn_up",
+		"post_attention_layernorm", "ffn_norm",
+		"model.norm", "output_norm",
+	}
+}
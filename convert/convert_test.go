@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"golang.org/x/exp/maps"
@@ -446,3 +448,615 @@ func generateLoraTestData(t *testing.T, tempDir string) {
 		t.Fatal(err)
 	}
 }
+
+// generateSafetensors writes a safetensors file with F32 tensors of the given
+// shapes. Tensor values are their element index so that repacking is observable.
+func generateSafetensors(t *testing.T, path string, shapes map[string][]int) {
+	t.Helper()
+
+	type tensorData struct {
+		Offsets []int  `json:"data_offsets"`
+		Type    string `json:"dtype"`
+		Shape   []int  `json:"shape"`
+	}
+
+	keys := maps.Keys(shapes)
+	slices.Sort(keys)
+
+	var offset int
+	var data []float32
+	td := map[string]*tensorData{}
+	for _, k := range keys {
+		n := 1
+		for _, dim := range shapes[k] {
+			n *= dim
+		}
+
+		for i := range n {
+			data = append(data, float32(i))
+		}
+
+		td[k] = &tensorData{Offsets: []int{offset, offset + n*4}, Type: "F32", Shape: shapes[k]}
+		offset += n * 4
+	}
+
+	bts, err := json.Marshal(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := binary.Write(f, binary.LittleEndian, int64(len(bts))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write(bts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := binary.Write(f, binary.LittleEndian, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertLlava(t *testing.T) {
+	tempDir := t.TempDir()
+
+	shapes := map[string][]int{
+		"language_model.model.embed_tokens.weight":                           {4, 8},
+		"language_model.model.norm.weight":                                   {8},
+		"language_model.lm_head.weight":                                      {4, 8},
+		"language_model.model.layers.0.self_attn.q_proj.weight":              {8, 8},
+		"language_model.model.layers.0.self_attn.k_proj.weight":              {8, 8},
+		"language_model.model.layers.0.input_layernorm.weight":               {8},
+		"vision_tower.vision_model.embeddings.class_embedding":               {8},
+		"vision_tower.vision_model.embeddings.patch_embedding.weight":        {8, 3, 2, 2},
+		"vision_tower.vision_model.embeddings.position_embedding.weight":     {5, 8},
+		"vision_tower.vision_model.pre_layrnorm.weight":                      {8},
+		"vision_tower.vision_model.post_layernorm.weight":                    {8},
+		"vision_tower.vision_model.encoder.layers.0.self_attn.q_proj.weight": {8, 8},
+		"vision_tower.vision_model.encoder.layers.0.mlp.fc1.weight":          {16, 8},
+		"vision_tower.vision_model.encoder.layers.1.self_attn.q_proj.weight": {8, 8},
+		"multi_modal_projector.linear_1.weight":                              {8, 8},
+		"multi_modal_projector.linear_2.weight":                              {8, 8},
+		"image_newline":                                                      {8},
+	}
+
+	generateSafetensors(t, filepath.Join(tempDir, "model.safetensors"), shapes)
+
+	files := map[string]string{
+		"config.json": `{
+			"architectures": ["LlavaNextForConditionalGeneration"],
+			"vocab_size": 4,
+			"image_grid_pinpoints": [[4, 8], [8, 4], [8, 8]],
+			"text_config": {
+				"hidden_size": 8,
+				"intermediate_size": 16,
+				"num_attention_heads": 2,
+				"num_hidden_layers": 1,
+				"max_position_embeddings": 32
+			},
+			"vision_config": {
+				"hidden_size": 8,
+				"image_size": 4,
+				"intermediate_size": 16,
+				"num_attention_heads": 2,
+				"num_hidden_layers": 2,
+				"patch_size": 2
+			}
+		}`,
+		"tokenizer.json":           `{}`,
+		"preprocessor_config.json": `{"image_mean": [0.5, 0.5, 0.5], "image_std": [0.5, 0.5, 0.5]}`,
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("model", func(t *testing.T) {
+		_, kv, tensors := convertFull(t, os.DirFS(tempDir))
+		if arch := kv.Architecture(); arch != "llama" {
+			t.Errorf("unexpected architecture: %s", arch)
+		}
+
+		if n := kv.BlockCount(); n != 1 {
+			t.Errorf("unexpected block count: %d", n)
+		}
+
+		var names []string
+		for _, tensor := range tensors.Items {
+			names = append(names, tensor.Name)
+		}
+		slices.Sort(names)
+
+		expect := []string{"blk.0.attn_k.weight", "blk.0.attn_norm.weight", "blk.0.attn_q.weight", "output.weight", "output_norm.weight", "token_embd.weight"}
+		if !slices.Equal(names, expect) {
+			t.Errorf("unexpected tensors: want %v, got %v", expect, names)
+		}
+	})
+
+	t.Run("projector", func(t *testing.T) {
+		f, err := os.CreateTemp(t.TempDir(), "projector")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := ConvertProjector(os.DirFS(tempDir), f); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _, err := llm.DecodeGGML(f, math.MaxInt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kv := m.KV()
+		if arch := kv.Architecture(); arch != "clip" {
+			t.Errorf("unexpected architecture: %s", arch)
+		}
+
+		if n := kv["clip.vision.block_count"]; n != uint32(1) {
+			t.Errorf("unexpected block count: %v", n)
+		}
+
+		if merge := kv.PatchMergeType(); merge != "spatial_unpad" {
+			t.Errorf("unexpected patch merge type: %s", merge)
+		}
+
+		if tiles := kv.ImageTiles(); tiles != 5 {
+			t.Errorf("unexpected tiles: %d", tiles)
+		}
+
+		var names []string
+		for _, tensor := range m.Tensors().Items {
+			names = append(names, tensor.Name)
+		}
+		slices.Sort(names)
+
+		expect := []string{
+			"mm.0.weight",
+			"mm.2.weight",
+			"model.image_newline",
+			"v.blk.0.attn_q.weight",
+			"v.blk.0.ffn_down.weight",
+			"v.class_embd",
+			"v.patch_embd.weight",
+			"v.position_embd.weight",
+			"v.pre_ln.weight",
+		}
+		if !slices.Equal(names, expect) {
+			t.Errorf("unexpected tensors: want %v, got %v", expect, names)
+		}
+	})
+
+	t.Run("text only", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"architectures": ["LlamaForCausalLM"]}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.CreateTemp(t.TempDir(), "projector")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := ConvertProjector(os.DirFS(dir), f); !errors.Is(err, ErrNoProjector) {
+			t.Errorf("expected ErrNoProjector, got %v", err)
+		}
+	})
+}
+
+func TestConvertSynthetic(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  string
+		shapes  map[string][]int
+		kv      map[string]any
+		tensors []string
+	}{
+		{
+			name: "qwen2",
+			config: `{
+				"architectures": ["Qwen2ForCausalLM"],
+				"vocab_size": 4,
+				"hidden_size": 8,
+				"intermediate_size": 16,
+				"num_attention_heads": 4,
+				"num_key_value_heads": 2,
+				"num_hidden_layers": 1,
+				"max_position_embeddings": 32,
+				"rms_norm_eps": 1e-6,
+				"rope_theta": 1000000.0
+			}`,
+			shapes: map[string][]int{
+				"model.embed_tokens.weight":                      {4, 8},
+				"model.norm.weight":                              {8},
+				"model.layers.0.input_layernorm.weight":          {8},
+				"model.layers.0.self_attn.q_proj.weight":         {8, 8},
+				"model.layers.0.self_attn.q_proj.bias":           {8},
+				"model.layers.0.self_attn.k_proj.weight":         {4, 8},
+				"model.layers.0.self_attn.k_proj.bias":           {4},
+				"model.layers.0.self_attn.v_proj.weight":         {4, 8},
+				"model.layers.0.self_attn.v_proj.bias":           {4},
+				"model.layers.0.self_attn.o_proj.weight":         {8, 8},
+				"model.layers.0.mlp.gate_proj.weight":            {16, 8},
+				"model.layers.0.mlp.up_proj.weight":              {16, 8},
+				"model.layers.0.mlp.down_proj.weight":            {8, 16},
+				"model.layers.0.post_attention_layernorm.weight": {8},
+			},
+			kv: map[string]any{
+				"general.architecture":          "qwen2",
+				"qwen2.block_count":             uint32(1),
+				"qwen2.attention.head_count":    uint32(4),
+				"qwen2.attention.head_count_kv": uint32(2),
+				"qwen2.rope.freq_base":          float32(1000000),
+			},
+			tensors: []string{
+				"blk.0.attn_k.bias",
+				"blk.0.attn_k.weight",
+				"blk.0.attn_norm.weight",
+				"blk.0.attn_output.weight",
+				"blk.0.attn_q.bias",
+				"blk.0.attn_q.weight",
+				"blk.0.attn_v.bias",
+				"blk.0.attn_v.weight",
+				"blk.0.ffn_down.weight",
+				"blk.0.ffn_gate.weight",
+				"blk.0.ffn_norm.weight",
+				"blk.0.ffn_up.weight",
+				"output_norm.weight",
+				"token_embd.weight",
+			},
+		},
+		{
+			name: "starcoder2",
+			config: `{
+				"architectures": ["Starcoder2ForCausalLM"],
+				"vocab_size": 4,
+				"hidden_size": 8,
+				"intermediate_size": 16,
+				"num_attention_heads": 4,
+				"num_key_value_heads": 2,
+				"num_hidden_layers": 1,
+				"max_position_embeddings": 32,
+				"norm_epsilon": 1e-5
+			}`,
+			shapes: map[string][]int{
+				"model.embed_tokens.weight":                      {4, 8},
+				"model.norm.weight":                              {8},
+				"model.norm.bias":                                {8},
+				"model.layers.0.input_layernorm.weight":          {8},
+				"model.layers.0.self_attn.q_proj.weight":         {8, 8},
+				"model.layers.0.self_attn.k_proj.weight":         {4, 8},
+				"model.layers.0.self_attn.v_proj.weight":         {4, 8},
+				"model.layers.0.self_attn.o_proj.weight":         {8, 8},
+				"model.layers.0.mlp.c_fc.weight":                 {16, 8},
+				"model.layers.0.mlp.c_proj.weight":               {8, 16},
+				"model.layers.0.post_attention_layernorm.weight": {8},
+			},
+			kv: map[string]any{
+				"general.architecture":                    "starcoder2",
+				"starcoder2.block_count":                  uint32(1),
+				"starcoder2.attention.head_count_kv":      uint32(2),
+				"starcoder2.attention.layer_norm_epsilon": float32(1e-5),
+			},
+			tensors: []string{
+				"blk.0.attn_k.weight",
+				"blk.0.attn_norm.weight",
+				"blk.0.attn_output.weight",
+				"blk.0.attn_q.weight",
+				"blk.0.attn_v.weight",
+				"blk.0.ffn_down.weight",
+				"blk.0.ffn_norm.weight",
+				"blk.0.ffn_up.weight",
+				"output_norm.bias",
+				"output_norm.weight",
+				"token_embd.weight",
+			},
+		},
+		{
+			name: "gptneox",
+			config: `{
+				"architectures": ["GPTNeoXForCausalLM"],
+				"vocab_size": 4,
+				"hidden_size": 8,
+				"intermediate_size": 32,
+				"num_attention_heads": 2,
+				"num_hidden_layers": 1,
+				"max_position_embeddings": 32,
+				"rotary_pct": 0.25,
+				"layer_norm_eps": 1e-5,
+				"use_parallel_residual": false
+			}`,
+			shapes: map[string][]int{
+				"gpt_neox.embed_in.weight":                           {4, 8},
+				"gpt_neox.final_layer_norm.weight":                   {8},
+				"gpt_neox.layers.0.input_layernorm.weight":           {8},
+				"gpt_neox.layers.0.attention.query_key_value.weight": {24, 8},
+				"gpt_neox.layers.0.attention.query_key_value.bias":   {24},
+				"gpt_neox.layers.0.attention.dense.weight":           {8, 8},
+				"gpt_neox.layers.0.attention.rotary_emb.inv_freq":    {2},
+				"gpt_neox.layers.0.post_attention_layernorm.weight":  {8},
+				"gpt_neox.layers.0.mlp.dense_h_to_4h.weight":         {32, 8},
+				"gpt_neox.layers.0.mlp.dense_4h_to_h.weight":         {8, 32},
+				"embed_out.weight":                                   {4, 8},
+			},
+			kv: map[string]any{
+				"general.architecture":          "gptneox",
+				"gptneox.block_count":           uint32(1),
+				"gptneox.rope.dimension_count":  uint32(1),
+				"gptneox.use_parallel_residual": false,
+			},
+			tensors: []string{
+				"blk.0.attn_norm.weight",
+				"blk.0.attn_output.weight",
+				"blk.0.attn_qkv.bias",
+				"blk.0.attn_qkv.weight",
+				"blk.0.ffn_down.weight",
+				"blk.0.ffn_norm.weight",
+				"blk.0.ffn_up.weight",
+				"output.weight",
+				"output_norm.weight",
+				"token_embd.weight",
+			},
+		},
+		{
+			name: "gptneox defaults",
+			config: `{
+				"architectures": ["GPTNeoXForCausalLM"],
+				"vocab_size": 4,
+				"hidden_size": 8,
+				"intermediate_size": 32,
+				"num_attention_heads": 2,
+				"num_hidden_layers": 1,
+				"max_position_embeddings": 32,
+				"layer_norm_eps": 1e-5
+			}`,
+			shapes: map[string][]int{
+				"gpt_neox.embed_in.weight":                           {4, 8},
+				"gpt_neox.final_layer_norm.weight":                   {8},
+				"gpt_neox.layers.0.input_layernorm.weight":           {8},
+				"gpt_neox.layers.0.attention.query_key_value.weight": {24, 8},
+				"gpt_neox.layers.0.attention.dense.weight":           {8, 8},
+				"gpt_neox.layers.0.post_attention_layernorm.weight":  {8},
+				"gpt_neox.layers.0.mlp.dense_h_to_4h.weight":         {32, 8},
+				"gpt_neox.layers.0.mlp.dense_4h_to_h.weight":         {8, 32},
+				"embed_out.weight":                                   {4, 8},
+			},
+			kv: map[string]any{
+				"general.architecture":          "gptneox",
+				"gptneox.rope.dimension_count":  uint32(1),
+				"gptneox.use_parallel_residual": true,
+			},
+			tensors: []string{
+				"blk.0.attn_norm.weight",
+				"blk.0.attn_output.weight",
+				"blk.0.attn_qkv.weight",
+				"blk.0.ffn_down.weight",
+				"blk.0.ffn_norm.weight",
+				"blk.0.ffn_up.weight",
+				"output.weight",
+				"output_norm.weight",
+				"token_embd.weight",
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			generateSafetensors(t, filepath.Join(tempDir, "model.safetensors"), tt.shapes)
+
+			if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(filepath.Join(tempDir, "tokenizer.json"), []byte(`{}`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, kv, tensors := convertFull(t, os.DirFS(tempDir))
+			for k, v := range tt.kv {
+				if kv[k] != v {
+					t.Errorf("unexpected %s: want %v, got %v", k, v, kv[k])
+				}
+			}
+
+			var names []string
+			for _, tensor := range tensors.Items {
+				names = append(names, tensor.Name)
+			}
+			slices.Sort(names)
+
+			if !slices.Equal(names, tt.tensors) {
+				t.Errorf("unexpected tensors: want %v, got %v", tt.tensors, names)
+			}
+		})
+	}
+}
+
+func TestGPTNeoXNoHeads(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(`{
+		"architectures": ["GPTNeoXForCausalLM"],
+		"hidden_size": 8,
+		"num_hidden_layers": 1
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := parseModel(os.DirFS(tempDir)); err == nil || !strings.Contains(err.Error(), "num_attention_heads") {
+		t.Errorf("expected num_attention_heads error, got %v", err)
+	}
+}
+
+func TestGPTNeoXRepack(t *testing.T) {
+	p := gptneoxModel{NumAttentionHeads: 2}
+
+	// two heads of size one, interleaved as [q0, k0, v0, q1, k1, v1]
+	f32s, err := p.repack("blk.0.attn_qkv.bias", []float32{0, 1, 2, 3, 4, 5}, []uint64{6})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []float32{0, 3, 1, 4, 2, 5}; !slices.Equal(f32s, expect) {
+		t.Errorf("unexpected repack: want %v, got %v", expect, f32s)
+	}
+}
+
+func TestConvertQuantizedModel(t *testing.T) {
+	tempDir := t.TempDir()
+	generateSafetensors(t, filepath.Join(tempDir, "model.safetensors"), map[string][]int{
+		"model.embed_tokens.weight":                      {4, 32},
+		"model.norm.weight":                              {32},
+		"model.layers.0.input_layernorm.weight":          {32},
+		"model.layers.0.self_attn.q_proj.weight":         {32, 32},
+		"model.layers.0.self_attn.k_proj.weight":         {32, 32},
+		"model.layers.0.self_attn.v_proj.weight":         {32, 32},
+		"model.layers.0.self_attn.o_proj.weight":         {32, 32},
+		"model.layers.0.mlp.gate_proj.weight":            {64, 32},
+		"model.layers.0.mlp.up_proj.weight":              {64, 32},
+		"model.layers.0.mlp.down_proj.weight":            {32, 64},
+		"model.layers.0.post_attention_layernorm.weight": {32},
+	})
+
+	if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(`{
+		"architectures": ["LlamaForCausalLM"],
+		"vocab_size": 4,
+		"hidden_size": 32,
+		"intermediate_size": 64,
+		"num_attention_heads": 4,
+		"num_key_value_heads": 4,
+		"num_hidden_layers": 1,
+		"max_position_embeddings": 32,
+		"rms_norm_eps": 1e-6
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "tokenizer.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "q8_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var completed, total int64
+	if err := ConvertQuantizedModel(os.DirFS(tempDir), f, "Q8_0", func(c, t int64) {
+		completed, total = c, t
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if completed == 0 || completed != total {
+		t.Errorf("unexpected progress: %d/%d", completed, total)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err := llm.DecodeGGML(f, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ft := m.KV().FileType().String(); ft != "Q8_0" {
+		t.Errorf("unexpected file type: want Q8_0, got %s", ft)
+	}
+
+	for _, tensor := range m.Tensors().Items {
+		want := uint32(8)
+		if len(tensor.Shape) < 2 {
+			want = 0
+		}
+
+		if tensor.Kind != want {
+			t.Errorf("unexpected kind for %s: want %d, got %d", tensor.Name, want, tensor.Kind)
+		}
+	}
+
+	if err := ConvertQuantizedModel(os.DirFS(tempDir), f, "Q1_0", nil); err == nil {
+		t.Error("expected error for unknown quantization")
+	}
+}
+
+func TestInspectModel(t *testing.T) {
+	tempDir := t.TempDir()
+	generateSafetensors(t, filepath.Join(tempDir, "model.safetensors"), map[string][]int{
+		"model.embed_tokens.weight":                      {4, 32},
+		"model.norm.weight":                              {32},
+		"model.layers.0.input_layernorm.weight":          {32},
+		"model.layers.0.self_attn.q_proj.weight":         {32, 32},
+		"model.layers.0.self_attn.k_proj.weight":         {32, 32},
+		"model.layers.0.self_attn.v_proj.weight":         {32, 32},
+		"model.layers.0.self_attn.o_proj.weight":         {32, 32},
+		"model.layers.0.mlp.gate_proj.weight":            {64, 32},
+		"model.layers.0.mlp.up_proj.weight":              {64, 32},
+		"model.layers.0.mlp.down_proj.weight":            {32, 64},
+		"model.layers.0.post_attention_layernorm.weight": {32},
+	})
+
+	if err := os.WriteFile(filepath.Join(tempDir, "config.json"), []byte(`{
+		"architectures": ["LlamaForCausalLM"],
+		"vocab_size": 4,
+		"hidden_size": 32,
+		"intermediate_size": 64,
+		"num_attention_heads": 4,
+		"num_key_value_heads": 4,
+		"num_hidden_layers": 1,
+		"max_position_embeddings": 32,
+		"rms_norm_eps": 1e-6
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "tokenizer.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := InspectModel(os.DirFS(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if arch := m.KV().Architecture(); arch != "llama" {
+		t.Errorf("unexpected architecture: want llama, got %s", arch)
+	}
+
+	if n := m.KV().BlockCount(); n != 1 {
+		t.Errorf("unexpected block count: want 1, got %d", n)
+	}
+
+	// 4*32 + 32 + 32 + 4*32*32 + 3*64*32 + 32
+	if n := m.KV().ParameterCount(); n != 10464 {
+		t.Errorf("unexpected parameter count: want 10464, got %d", n)
+	}
+
+	for _, tensor := range m.Tensors().Items {
+		want := "F16"
+		if len(tensor.Shape) < 2 {
+			want = "F32"
+		}
+
+		if tensor.Type() != want {
+			t.Errorf("unexpected type for %s: want %s, got %s", tensor.Name, want, tensor.Type())
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"os"
 	"slices"
+	"strings"
 
 	"golang.org/x/exp/maps"
 )
@@ -60,7 +61,20 @@ func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error)
 			addedTokens[t.Content] = t
 		}
 
-		t.Merges = tt.Model.Merges
+		if len(tt.Model.Merges) > 0 {
+			var merges []string
+			// newer tokenizers store merges as pairs rather than space separated strings
+			var pairs [][]string
+			if err := json.Unmarshal(tt.Model.Merges, &merges); err == nil {
+				t.Merges = merges
+			} else if err := json.Unmarshal(tt.Model.Merges, &pairs); err == nil {
+				for _, pair := range pairs {
+					t.Merges = append(t.Merges, strings.Join(pair, " "))
+				}
+			} else {
+				return nil, fmt.Errorf("invalid merges: %w", err)
+			}
+		}
 
 		sha256sum := sha256.New()
 		for _, pt := range tt.PreTokenizer.PreTokenizers {
@@ -81,8 +95,16 @@ func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error)
 			t.Pre = "deepseek-llm"
 		case "21cde974d587f0d54dc8d56b183cc1e6239600172035c68fbd6d4b9f8da0576e":
 			t.Pre = "deepseek-coder"
+		case "1ff7f41064896984db5d1bb6ff64fa4bc29007d08c1b439e505b7392777a319e":
+			t.Pre = "qwen2"
 		case "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855":
-			// noop, empty pretokenizer
+			// no Split pretokenizers so identify the pretokenizer by its other parts
+			switch {
+			case tt.PreTokenizer.hasIndividualDigits():
+				t.Pre = "starcoder"
+			case tt.PreTokenizer.Type == "ByteLevel":
+				t.Pre = "gpt-2"
+			}
 		default:
 			slog.Warn("unknown pretokenizer, using default", "digest", digest)
 		}
@@ -156,19 +178,33 @@ func parseTokenizer(fsys fs.FS, specialTokenTypes []string) (*Tokenizer, error)
 type tokenizer struct {
 	AddedTokens []token `json:"added_tokens"`
 	Model       struct {
-		Type   string         `json:"type"`
-		Vocab  map[string]int `json:"vocab"`
-		Merges []string       `json:"merges"`
+		Type   string          `json:"type"`
+		Vocab  map[string]int  `json:"vocab"`
+		Merges json.RawMessage `json:"merges"`
 	} `json:"model"`
 
-	PreTokenizer struct {
-		PreTokenizers []struct {
-			Type    string `json:"type"`
-			Pattern struct {
-				Regex string `json:"Regex"`
-			} `json:"pattern"`
-		} `json:"pretokenizers"`
-	} `json:"pre_tokenizer"`
+	PreTokenizer preTokenizer `json:"pre_tokenizer"`
+}
+
+type preTokenizer struct {
+	Type          string `json:"type"`
+	PreTokenizers []struct {
+		Type    string `json:"type"`
+		Pattern struct {
+			Regex string `json:"Regex"`
+		} `json:"pattern"`
+		IndividualDigits bool `json:"individual_digits"`
+	} `json:"pretokenizers"`
+}
+
+func (p preTokenizer) hasIndividualDigits() bool {
+	for _, pt := range p.PreTokenizers {
+		if pt.Type == "Digits" && pt.IndividualDigits {
+			return true
+		}
+	}
+
+	return false
 }
 
 type token struct {
@@ -12,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ollama/ollama/format"
 )
 
 // Host returns the scheme and host. Host can be configured via the OLLAMA_HOST environment variable.
@@ -82,9 +84,67 @@ func Origins() (origins []string) {
 }
 
 // Models returns the path to the models directory. Models directory can be configured via the OLLAMA_MODELS environment variable.
+// If OLLAMA_MODELS lists several directories, Models is the first.
 // Default is $HOME/.ollama/models
 func Models() string {
-	if s := Var("OLLAMA_MODELS"); s != "" {
+	return ModelStores()[0]
+}
+
+// ModelStores returns the model directories in priority order. Several directories can be configured by separating them
+// in OLLAMA_MODELS with the path list separator, e.g. /mnt/nvme/models:/mnt/hdd/models. Models are looked up in every
+// directory and written to the first unless another is chosen.
+// Default is $HOME/.ollama/models
+func ModelStores() []string {
+	if stores := pathList("OLLAMA_MODELS"); len(stores) > 0 {
+		return stores
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return []string{filepath.Join(home, ".ollama", "models")}
+}
+
+// BaseModels returns the read-only models directories shared by every user. Base models directories can be configured
+// via the OLLAMA_BASE_MODELS environment variable as a list like OLLAMA_MODELS. Models are looked up in them after the
+// directories in OLLAMA_MODELS but never written to or removed from them.
+func BaseModels() []string {
+	return pathList("OLLAMA_BASE_MODELS")
+}
+
+// pathList returns the non-empty paths in the path list in the environment variable key
+func pathList(key string) []string {
+	var paths []string
+	for _, s := range filepath.SplitList(Var(key)) {
+		if s = strings.TrimSpace(s); s != "" {
+			paths = append(paths, s)
+		}
+	}
+
+	return paths
+}
+
+// Registries returns the path to the registries configuration file. Registries can be configured via the OLLAMA_REGISTRIES environment variable.
+// Default is $HOME/.ollama/registries.toml
+func Registries() string {
+	if s := Var("OLLAMA_REGISTRIES"); s != "" {
+		return s
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	return filepath.Join(home, ".ollama", "registries.toml")
+}
+
+// TrustPolicy returns the path to the file listing the keys trusted to sign models. TrustPolicy can be configured via the OLLAMA_TRUST_POLICY environment variable.
+// Default is $HOME/.ollama/trust.toml
+func TrustPolicy() string {
+	if s := Var("OLLAMA_TRUST_POLICY"); s != "" {
 		return s
 	}
 
@@ -93,7 +153,7 @@ func Models() string {
 		panic(err)
 	}
 
-	return filepath.Join(home, ".ollama", "models")
+	return filepath.Join(home, ".ollama", "trust.toml")
 }
 
 // KeepAlive returns the duration that models stay loaded in memory. KeepAlive can be configured via the OLLAMA_KEEP_ALIVE environment variable.
@@ -140,6 +200,8 @@ var (
 	NoHistory = Bool("OLLAMA_NOHISTORY")
 	// NoPrune disables pruning of model blobs on startup.
 	NoPrune = Bool("OLLAMA_NOPRUNE")
+	// PromoteModels moves models to the first model directory when they're loaded.
+	PromoteModels = Bool("OLLAMA_PROMOTE_MODELS")
 	// SchedSpread allows scheduling models across all GPUs.
 	SchedSpread = Bool("OLLAMA_SCHED_SPREAD")
 	// IntelGPU enables experimental Intel GPU detection.
@@ -155,6 +217,13 @@ func String(s string) func() string {
 var (
 	LLMLibrary = String("OLLAMA_LLM_LIBRARY")
 	TmpDir     = String("OLLAMA_TMPDIR")
+	// PullStore is the model directory pulled models are written to. Default is the first model directory.
+	PullStore = String("OLLAMA_PULL_STORE")
+	// KvCacheType is the type the K and V caches are stored as unless a model sets cache_type_k or cache_type_v. Default is f16.
+	KvCacheType = String("OLLAMA_KV_CACHE_TYPE")
+	// RegistryAuth is the username:password clients push to `ollama serve --registry --registry-push` with.
+	// It's left out of AsMap so it isn't logged.
+	RegistryAuth = String("OLLAMA_REGISTRY_AUTH")
 
 	CudaVisibleDevices    = String("CUDA_VISIBLE_DEVICES")
 	HipVisibleDevices     = String("HIP_VISIBLE_DEVICES")
@@ -235,6 +304,22 @@ var (
 	MaxVRAM = Uint("OLLAMA_MAX_VRAM", 0)
 )
 
+// MaxDownloadRate returns the maximum combined rate of all downloads in bytes per second, e.g. 50MB. MaxDownloadRate can be configured via the OLLAMA_MAX_DOWNLOAD_RATE environment variable.
+// Default is 0, which is unlimited.
+func MaxDownloadRate() int64 {
+	if s := Var("OLLAMA_MAX_DOWNLOAD_RATE"); s != "" {
+		n, err := format.ParseBytes(s)
+		if err != nil {
+			slog.Warn("invalid environment variable, using default", "key", "OLLAMA_MAX_DOWNLOAD_RATE", "value", s, "default", 0)
+			return 0
+		}
+
+		return n
+	}
+
+	return 0
+}
+
 type EnvVar struct {
 	Name        string
 	Value       any
@@ -247,17 +332,24 @@ func AsMap() map[string]EnvVar {
 		"OLLAMA_FLASH_ATTENTION":   {"OLLAMA_FLASH_ATTENTION", FlashAttention(), "Enabled flash attention"},
 		"OLLAMA_HOST":              {"OLLAMA_HOST", Host(), "IP Address for the ollama server (default 127.0.0.1:11434)"},
 		"OLLAMA_KEEP_ALIVE":        {"OLLAMA_KEEP_ALIVE", KeepAlive(), "The duration that models stay loaded in memory (default \"5m\")"},
+		"OLLAMA_KV_CACHE_TYPE":     {"OLLAMA_KV_CACHE_TYPE", KvCacheType(), "Type of the K and V caches, e.g. q8_0 (default \"f16\")"},
 		"OLLAMA_LLM_LIBRARY":       {"OLLAMA_LLM_LIBRARY", LLMLibrary(), "Set LLM library to bypass autodetection"},
+		"OLLAMA_MAX_DOWNLOAD_RATE": {"OLLAMA_MAX_DOWNLOAD_RATE", MaxDownloadRate(), "Maximum combined rate of model downloads, e.g. 50MB (per second)"},
 		"OLLAMA_MAX_LOADED_MODELS": {"OLLAMA_MAX_LOADED_MODELS", MaxRunners(), "Maximum number of loaded models per GPU"},
 		"OLLAMA_MAX_QUEUE":         {"OLLAMA_MAX_QUEUE", MaxQueue(), "Maximum number of queued requests"},
-		"OLLAMA_MODELS":            {"OLLAMA_MODELS", Models(), "The path to the models directory"},
+		"OLLAMA_MODELS":            {"OLLAMA_MODELS", ModelStores(), "The path to the models directory, or a list of them in priority order"},
+		"OLLAMA_BASE_MODELS":       {"OLLAMA_BASE_MODELS", BaseModels(), "Read-only models directories shared by every user"},
 		"OLLAMA_NOHISTORY":         {"OLLAMA_NOHISTORY", NoHistory(), "Do not preserve readline history"},
 		"OLLAMA_NOPRUNE":           {"OLLAMA_NOPRUNE", NoPrune(), "Do not prune model blobs on startup"},
 		"OLLAMA_NUM_PARALLEL":      {"OLLAMA_NUM_PARALLEL", NumParallel(), "Maximum number of parallel requests"},
 		"OLLAMA_ORIGINS":           {"OLLAMA_ORIGINS", Origins(), "A comma separated list of allowed origins"},
+		"OLLAMA_PROMOTE_MODELS":    {"OLLAMA_PROMOTE_MODELS", PromoteModels(), "Move models to the first models directory after they're used"},
+		"OLLAMA_PULL_STORE":        {"OLLAMA_PULL_STORE", PullStore(), "The models directory pulled models are written to"},
+		"OLLAMA_REGISTRIES":        {"OLLAMA_REGISTRIES", Registries(), "The path to the registry mirrors configuration"},
 		"OLLAMA_RUNNERS_DIR":       {"OLLAMA_RUNNERS_DIR", RunnersDir(), "Location for runners"},
 		"OLLAMA_SCHED_SPREAD":      {"OLLAMA_SCHED_SPREAD", SchedSpread(), "Always schedule model across all GPUs"},
 		"OLLAMA_TMPDIR":            {"OLLAMA_TMPDIR", TmpDir(), "Location for temporary files"},
+		"OLLAMA_TRUST_POLICY":      {"OLLAMA_TRUST_POLICY", TrustPolicy(), "The path to the model signature trust policy"},
 	}
 	if runtime.GOOS != "darwin" {
 		ret["CUDA_VISIBLE_DEVICES"] = EnvVar{"CUDA_VISIBLE_DEVICES", CudaVisibleDevices(), "Set which NVIDIA devices are visible"}
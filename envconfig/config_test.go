@@ -2,6 +2,7 @@ package envconfig
 
 import (
 	"math"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -214,6 +215,33 @@ func TestKeepAlive(t *testing.T) {
 	}
 }
 
+func TestModelStores(t *testing.T) {
+	sep := string(filepath.ListSeparator)
+	cases := map[string][]string{
+		"/models":                            {"/models"},
+		"/nvme/models" + sep + "/hdd/models": {"/nvme/models", "/hdd/models"},
+		"/nvme/models" + sep + sep + " ":     {"/nvme/models"},
+	}
+
+	for tt, expect := range cases {
+		t.Run(tt, func(t *testing.T) {
+			t.Setenv("OLLAMA_MODELS", tt)
+			if actual := ModelStores(); !cmp.Equal(actual, expect) {
+				t.Errorf("%s: expected %v, got %v", tt, expect, actual)
+			}
+
+			if actual := Models(); actual != expect[0] {
+				t.Errorf("%s: expected %s, got %s", tt, expect[0], actual)
+			}
+
+			t.Setenv("OLLAMA_BASE_MODELS", tt)
+			if actual := BaseModels(); !cmp.Equal(actual, expect) {
+				t.Errorf("%s: expected %v, got %v", tt, expect, actual)
+			}
+		})
+	}
+}
+
 func TestVar(t *testing.T) {
 	cases := map[string]string{
 		"value":       "value",
@@ -3,6 +3,8 @@ package format
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -63,3 +65,39 @@ func HumanBytes2(b uint64) string {
 		return fmt.Sprintf("%d B", b)
 	}
 }
+
+var byteUnits = map[string]int64{
+	"":    Byte,
+	"B":   Byte,
+	"KB":  KiloByte,
+	"MB":  MegaByte,
+	"GB":  GigaByte,
+	"TB":  TeraByte,
+	"KIB": KibiByte,
+	"MIB": MebiByte,
+	"GIB": GibiByte,
+}
+
+// ParseBytes parses a size such as 512, 50MB or 1.5GiB into bytes. Units are
+// case insensitive.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, strings.TrimSpace(s[i:]))
+	}
+
+	return int64(value * float64(unit)), nil
+}
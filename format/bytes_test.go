@@ -0,0 +1,37 @@
+package format
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"0":       0,
+		"512":     512,
+		"512B":    512,
+		"50MB":    50 * MegaByte,
+		"50 mb":   50 * MegaByte,
+		"1.5GiB":  3 * GibiByte / 2,
+		"2KiB":    2 * KibiByte,
+		" 10kb  ": 10 * KiloByte,
+	}
+
+	for s, want := range cases {
+		t.Run(s, func(t *testing.T) {
+			got, err := ParseBytes(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != want {
+				t.Errorf("expected %d, got %d", want, got)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "MB", "-1", "10XB", "1.2.3"} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := ParseBytes(s); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -50,6 +50,7 @@
 #include <chrono>
 #include <condition_variable>
 #include <atomic>
+#include <unordered_map>
 #include <signal.h>
 
 using json = nlohmann::json;
@@ -2726,6 +2727,124 @@ static bool update_load_progress(float progress, void *data)
     return true;
 }
 
+// imatrix_sums are the sums of the squared inputs of a weight over the rows
+// evaluated
+struct imatrix_sums {
+    std::vector<float> sums;
+    int64_t rows = 0;
+};
+
+struct imatrix_collector {
+    std::unordered_map<std::string, imatrix_sums> weights;
+    std::vector<float> activations;
+};
+
+// imatrix_collect is the graph evaluation callback. It sums the squared inputs
+// of matrix multiplications against the weights of each layer and the output.
+static bool imatrix_collect(struct ggml_tensor *t, bool ask, void *user_data)
+{
+    const struct ggml_tensor *weight = t->src[0];
+    const struct ggml_tensor *input = t->src[1];
+
+    if (ask)
+    {
+        return t->op == GGML_OP_MUL_MAT &&
+               input->type == GGML_TYPE_F32 &&
+               ggml_is_contiguous(input) &&
+               (strncmp(weight->name, "blk.", 4) == 0 || strcmp(weight->name, "output.weight") == 0);
+    }
+
+    imatrix_collector *c = static_cast<imatrix_collector *>(user_data);
+    imatrix_sums &s = c->weights[weight->name];
+    if (s.sums.empty())
+    {
+        s.sums.resize(input->ne[0]);
+    }
+    else if (s.sums.size() != (size_t)input->ne[0])
+    {
+        // a weight used with inputs of different widths can't be scored
+        return true;
+    }
+
+    c->activations.resize(ggml_nbytes(input) / sizeof(float));
+    ggml_backend_tensor_get(input, c->activations.data(), 0, ggml_nbytes(input));
+
+    int64_t rows = ggml_nrows(input);
+    for (int64_t row = 0; row < rows; row++)
+    {
+        const float *x = c->activations.data() + row * input->ne[0];
+        for (int64_t i = 0; i < input->ne[0]; i++)
+        {
+            s.sums[i] += x[i] * x[i];
+        }
+    }
+
+    s.rows += rows;
+    return true;
+}
+
+// compute_imatrix evaluates model over tokens in chunks of n_ctx tokens, in a
+// context of its own so requests to the runner aren't disturbed, and sets
+// imatrix to the mean squared input of each weight
+static bool compute_imatrix(llama_model *model, std::vector<llama_token> tokens, uint32_t n_ctx, json &imatrix)
+{
+    imatrix_collector collector;
+
+    llama_context_params params = llama_context_default_params();
+    params.n_ctx = n_ctx;
+    params.n_batch = n_ctx;
+    params.cb_eval = imatrix_collect;
+    params.cb_eval_user_data = &collector;
+
+    llama_context *ctx = llama_new_context_with_model(model, params);
+    if (ctx == nullptr)
+    {
+        return false;
+    }
+
+    // every chunk is evaluated as a separate sequence so each starts with BOS
+    // if the model adds one
+    const llama_token bos = llama_token_bos(model);
+    const bool add_bos = !tokens.empty() && tokens[0] == bos;
+
+    bool ok = true;
+    for (size_t start = 0; start < tokens.size(); start += n_ctx)
+    {
+        std::vector<llama_token> chunk(tokens.begin() + start, tokens.begin() + std::min(tokens.size(), start + n_ctx));
+        if (add_bos)
+        {
+            chunk[0] = bos;
+        }
+
+        llama_kv_cache_clear(ctx);
+        if (llama_decode(ctx, llama_batch_get_one(chunk.data(), (int32_t)chunk.size(), 0, 0)) != 0)
+        {
+            ok = false;
+            break;
+        }
+    }
+
+    llama_free(ctx);
+    if (!ok)
+    {
+        return false;
+    }
+
+    imatrix = json::object();
+    for (const auto &it : collector.weights)
+    {
+        std::vector<float> mean(it.second.sums.size());
+        for (size_t i = 0; i < mean.size(); i++)
+        {
+            mean[i] = it.second.sums[i] / it.second.rows;
+        }
+
+        imatrix[it.first] = mean;
+    }
+
+    return true;
+}
+
 #if defined(_WIN32)
 char* wchar_to_char(const wchar_t* wstr) {
     if (wstr == nullptr) return nullptr;
@@ -3211,6 +3330,27 @@ int main(int argc, char **argv) {
                 return res.set_content(result.result_json.dump(), "application/json; charset=utf-8");
             });
 
+    svr.Post("/imatrix", [&llama](const httplib::Request &req, httplib::Response &res)
+            {
+                res.set_header("Access-Control-Allow-Origin", req.get_header_value("Origin"));
+                const json body = json::parse(req.body);
+                std::vector<llama_token> tokens;
+                if (body.count("content") != 0)
+                {
+                    tokens = llama.tokenize(body["content"], true);
+                }
+
+                const uint32_t n_ctx = json_value(body, "n_ctx", 512);
+                json imatrix;
+                if (tokens.empty() || !compute_imatrix(llama.model, tokens, n_ctx, imatrix))
+                {
+                    res.status = 500;
+                    return res.set_content(json{{"error", "failed to compute importance matrix"}}.dump(), "application/json; charset=utf-8");
+                }
+
+                return res.set_content(json{{"imatrix", imatrix}}.dump(), "application/json; charset=utf-8");
+            });
+
     // GG: if I put the main loop inside a thread, it crashes on the first request when build in Debug!?
     //     "Bus error: 10" - this is on macOS, it does not crash on Linux
     //std::thread t2([&]()
@@ -1,6 +1,7 @@
 package llm
 
 import (
+	"cmp"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -120,6 +121,167 @@ func (kv KV) ChatTemplate() string {
 	return s
 }
 
+func (kv KV) uints(key string) []uint64 {
+	a, ok := kv[key].(*array)
+	if !ok {
+		return nil
+	}
+
+	var u64s []uint64
+	for _, v := range a.values {
+		switch v := v.(type) {
+		case int32:
+			u64s = append(u64s, uint64(v))
+		case uint32:
+			u64s = append(u64s, uint64(v))
+		case int64:
+			u64s = append(u64s, uint64(v))
+		case uint64:
+			u64s = append(u64s, v)
+		}
+	}
+
+	return u64s
+}
+
+func (kv KV) floats(key string) []float32 {
+	a, ok := kv[key].(*array)
+	if !ok {
+		return nil
+	}
+
+	var f32s []float32
+	for _, v := range a.values {
+		switch v := v.(type) {
+		case float32:
+			f32s = append(f32s, v)
+		case float64:
+			f32s = append(f32s, float32(v))
+		}
+	}
+
+	return f32s
+}
+
+// ProjectorType returns the type of the multimodal projector, e.g. mlp or ldp.
+func (kv KV) ProjectorType() string {
+	if s, ok := kv["clip.projector_type"].(string); ok {
+		return s
+	}
+
+	return "mlp"
+}
+
+// ImageSize is the width and height, in pixels, of a single image tile.
+func (kv KV) ImageSize() uint64 {
+	return kv.u64("clip.vision.image_size")
+}
+
+// PatchSize is the width and height, in pixels, of a single image patch.
+func (kv KV) PatchSize() uint64 {
+	return kv.u64("clip.vision.patch_size")
+}
+
+func (kv KV) ImageMean() []float32 {
+	return kv.floats("clip.vision.image_mean")
+}
+
+func (kv KV) ImageStd() []float32 {
+	return kv.floats("clip.vision.image_std")
+}
+
+// ImageGridPinpoints returns the width and height pairs an image may be
+// resized to before it is split into tiles. Models without tiling, such as
+// LLaVA 1.5, return nil.
+func (kv KV) ImageGridPinpoints() [][2]uint64 {
+	u64s := kv.uints("clip.vision.image_grid_pinpoints")
+
+	var pinpoints [][2]uint64
+	for i := 0; i+1 < len(u64s); i += 2 {
+		pinpoints = append(pinpoints, [2]uint64{u64s[i], u64s[i+1]})
+	}
+
+	return pinpoints
+}
+
+func (kv KV) PatchMergeType() string {
+	if s, ok := kv["clip.vision.mm_patch_merge_type"].(string); ok {
+		return s
+	}
+
+	return "flat"
+}
+
+// ImagePatches returns the number of embeddings the projector produces for a
+// single image tile.
+func (kv KV) ImagePatches() uint64 {
+	imageSize, patchSize := kv.ImageSize(), kv.PatchSize()
+	if imageSize == 0 || patchSize == 0 {
+		return 0
+	}
+
+	patches := (imageSize / patchSize) * (imageSize / patchSize)
+	switch kv.ProjectorType() {
+	case "ldp", "ldpv2":
+		patches /= 4
+	case "resampler":
+		if kv.u64("clip.minicpmv_version") == 3 {
+			patches = 64
+		} else {
+			patches = 96
+		}
+	}
+
+	return patches
+}
+
+// ImageTiles returns the maximum number of tiles, including the base image,
+// an image is split into before it is encoded.
+func (kv KV) ImageTiles() uint64 {
+	imageSize := kv.ImageSize()
+	if imageSize == 0 {
+		return 1
+	}
+
+	var tiles uint64
+	for _, pinpoint := range kv.ImageGridPinpoints() {
+		tiles = max(tiles, (pinpoint[0]/imageSize)*(pinpoint[1]/imageSize))
+	}
+
+	return 1 + tiles
+}
+
+// ImageTokens returns the maximum number of context tokens a single image
+// occupies, or 0 if the projector metadata doesn't describe it.
+func (kv KV) ImageTokens() uint64 {
+	patches := kv.ImagePatches()
+	if patches == 0 {
+		return 0
+	}
+
+	pinpoints := kv.ImageGridPinpoints()
+	if len(pinpoints) == 0 {
+		return patches
+	}
+
+	imageSize, patchSize := kv.ImageSize(), kv.PatchSize()
+	side := imageSize / patchSize
+
+	var tokens uint64
+	for _, pinpoint := range pinpoints {
+		w, h := pinpoint[0]/imageSize, pinpoint[1]/imageSize
+		if kv.PatchMergeType() == "spatial_unpad" {
+			// the base image followed by the grid features with a newline
+			// embedding at the end of each row
+			tokens = max(tokens, patches+(h*side)*(w*side+1))
+		} else {
+			tokens = max(tokens, patches*(1+w*h))
+		}
+	}
+
+	return tokens
+}
+
 type Tensors struct {
 	Items  []*Tensor
 	Offset uint64
@@ -249,6 +411,22 @@ func (t Tensor) typeSize() uint64 {
 	}
 }
 
+// Type returns the name of the tensor's GGML type, such as F16 or Q4_K
+func (t Tensor) Type() string {
+	types := []string{
+		"F32", "F16", "Q4_0", "Q4_1", "Q4_2", "Q4_3", "Q5_0", "Q5_1", "Q8_0", "Q8_1",
+		"Q2_K", "Q3_K", "Q4_K", "Q5_K", "Q6_K", "Q8_K",
+		"IQ2_XXS", "IQ2_XS", "IQ3_XXS", "IQ1_S", "IQ4_NL", "IQ3_S", "IQ2_S", "IQ4_XS",
+		"I8", "I16", "I32", "I64", "F64", "IQ1_M", "BF16",
+	}
+
+	if int(t.Kind) < len(types) {
+		return types[t.Kind]
+	}
+
+	return fmt.Sprintf("unknown(%d)", t.Kind)
+}
+
 func (t Tensor) parameters() uint64 {
 	var count uint64 = 1
 	for _, n := range t.Shape {
@@ -347,7 +525,43 @@ func DecodeGGML(rs io.ReadSeeker, maxArraySize int) (*GGML, int64, error) {
 	}, offset, nil
 }
 
-func (llm GGML) GraphSize(context, batch uint64) (partialOffload, fullOffload uint64) {
+// VisionGraphSize estimates the compute buffer a projector needs to encode a
+// single image tile. Tiles are encoded one at a time so this does not scale
+// with ImageTiles.
+func (llm GGML) VisionGraphSize() uint64 {
+	kv := llm.KV()
+
+	imageSize, patchSize := kv.ImageSize(), kv.PatchSize()
+	if imageSize == 0 || patchSize == 0 {
+		return 0
+	}
+
+	embedding := kv.u64("clip.vision.embedding_length")
+	heads := kv.u64("clip.vision.attention.head_count")
+
+	// patch embeddings plus the class embedding
+	positions := (imageSize/patchSize)*(imageSize/patchSize) + 1
+	return 4 * (heads*positions*positions + 4*positions*embedding + 3*imageSize*imageSize)
+}
+
+// kvCacheTypeSizes is the size in bytes of an element of each type the K and
+// V caches can be stored as. The quantized types are stored in blocks of 32
+// elements with an fp16 scale, and an fp16 minimum for q4_1 and q5_1.
+var kvCacheTypeSizes = map[string]float64{
+	"f32":    4,
+	"f16":    2,
+	"q8_0":   34.0 / 32,
+	"q5_1":   24.0 / 32,
+	"q5_0":   22.0 / 32,
+	"iq4_nl": 18.0 / 32,
+	"q4_1":   20.0 / 32,
+	"q4_0":   18.0 / 32,
+}
+
+// GraphSize returns the size of the K and V caches for the context stored as
+// cacheTypeK and cacheTypeV, and the size of the compute graph when the model
+// is partially and fully offloaded
+func (llm GGML) GraphSize(context, batch uint64, cacheTypeK, cacheTypeV string) (kv, partialOffload, fullOffload uint64) {
 	embedding := llm.KV().EmbeddingLength()
 	heads := llm.KV().HeadCount()
 	headsKV := llm.KV().HeadCountKV()
@@ -355,6 +569,12 @@ func (llm GGML) GraphSize(context, batch uint64) (partialOffload, fullOffload ui
 
 	embeddingHeads := llm.KV().EmbeddingHeadCount()
 	embeddingHeadsK := llm.KV().EmbeddingHeadCountK()
+	embeddingHeadsV := llm.KV().EmbeddingHeadCountV()
+
+	// k = sizeof(k element) * n_ctx * n_layer * n_embd_head_k * n_head_kv, and likewise for v
+	elements := float64(context * llm.KV().BlockCount() * headsKV)
+	kv = uint64(elements*float64(embeddingHeadsK)*cmp.Or(kvCacheTypeSizes[cacheTypeK], 2) +
+		elements*float64(embeddingHeadsV)*cmp.Or(kvCacheTypeSizes[cacheTypeV], 2))
 
 	layers := llm.Tensors().Layers()
 
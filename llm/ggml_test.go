@@ -1 +1,89 @@
 package llm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImageTokens(t *testing.T) {
+	cases := []struct {
+		name   string
+		kv     KV
+		tiles  uint64
+		tokens uint64
+	}{
+		{
+			name: "llava",
+			kv: KV{
+				"general.architecture":   "clip",
+				"clip.projector_type":    "mlp",
+				"clip.vision.image_size": uint32(336),
+				"clip.vision.patch_size": uint32(14),
+			},
+			tiles:  1,
+			tokens: 576,
+		},
+		{
+			name: "llava next",
+			kv: KV{
+				"general.architecture":             "clip",
+				"clip.projector_type":              "mlp",
+				"clip.vision.image_size":           uint32(336),
+				"clip.vision.patch_size":           uint32(14),
+				"clip.vision.mm_patch_merge_type":  "spatial_unpad",
+				"clip.vision.image_grid_pinpoints": []int32{336, 672, 672, 336, 672, 672, 1008, 336, 336, 1008},
+			},
+			tiles:  5,
+			tokens: 2928,
+		},
+		{
+			name: "ldp",
+			kv: KV{
+				"general.architecture":   "clip",
+				"clip.projector_type":    "ldp",
+				"clip.vision.image_size": uint32(336),
+				"clip.vision.patch_size": uint32(14),
+			},
+			tiles:  1,
+			tokens: 144,
+		},
+		{
+			name: "missing metadata",
+			kv: KV{
+				"general.architecture": "clip",
+			},
+			tiles:  1,
+			tokens: 0,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.CreateTemp(t.TempDir(), "projector")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if err := WriteGGUF(f, tt.kv, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			ggml, err := LoadModel(f.Name(), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			kv := ggml.KV()
+			if diff := cmp.Diff(tt.tiles, kv.ImageTiles()); diff != "" {
+				t.Errorf("tiles mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.tokens, kv.ImageTokens()); diff != "" {
+				t.Errorf("tokens mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
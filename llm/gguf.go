@@ -506,6 +506,23 @@ func writeGGUFArray[S ~[]E, E any](w io.Writer, t uint32, s S) error {
 	return binary.Write(w, binary.LittleEndian, s)
 }
 
+// NewGGUF returns a GGUF model with the metadata kv and tensors ts without
+// reading or writing a file, such as a model which is yet to be converted
+func NewGGUF(kv KV, ts []Tensor) *GGML {
+	llm := newGGUF(&containerGGUF{ByteOrder: binary.LittleEndian, Version: 3})
+	for k, v := range kv {
+		llm.kv[k] = v
+	}
+
+	for _, t := range ts {
+		llm.tensors = append(llm.tensors, &t)
+		llm.parameters += t.parameters()
+	}
+
+	llm.kv["general.parameter_count"] = llm.parameters
+	return &GGML{container: llm.containerGGUF, model: llm}
+}
+
 func WriteGGUF(ws io.WriteSeeker, kv KV, ts []Tensor) error {
 	if err := binary.Write(ws, binary.LittleEndian, []byte("GGUF")); err != nil {
 		return err
@@ -542,16 +559,17 @@ func WriteGGUF(ws io.WriteSeeker, kv KV, ts []Tensor) error {
 		}
 	})
 
+	var alignment int64 = 32
 	var s uint64
 	for _, t := range ts {
-		t.Offset = s
+		// tensor data is aligned so offsets must include the padding
+		t.Offset = s + uint64(ggufPadding(int64(s), alignment))
 		if err := ggufWriteTensorInfo(ws, t); err != nil {
 			return err
 		}
-		s += t.Size()
+		s = t.Offset + t.Size()
 	}
 
-	var alignment int64 = 32
 	for _, t := range ts {
 		if err := ggufWriteTensor(ws, t, alignment); err != nil {
 			return err
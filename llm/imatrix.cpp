@@ -0,0 +1,45 @@
+#include "imatrix.h"
+
+#include <string>
+#include <unordered_map>
+#include <vector>
+
+struct imatrix {
+    // llama_model_quantize casts its imatrix parameter to this map
+    std::unordered_map<std::string, std::vector<float>> values;
+    std::vector<std::string> names;
+};
+
+struct imatrix *imatrix_new(void) {
+    return new imatrix;
+}
+
+void imatrix_free(struct imatrix *m) {
+    delete m;
+}
+
+void imatrix_set(struct imatrix *m, const char *name, const float *values, size_t n) {
+    if (m->values.find(name) == m->values.end()) {
+        m->names.push_back(name);
+    }
+
+    m->values[name] = std::vector<float>(values, values + n);
+}
+
+size_t imatrix_len(const struct imatrix *m) {
+    return m->names.size();
+}
+
+const char *imatrix_name(const struct imatrix *m, size_t i) {
+    return m->names[i].c_str();
+}
+
+const float *imatrix_values(const struct imatrix *m, size_t i, size_t *n) {
+    const std::vector<float> &values = m->values.at(m->names[i]);
+    *n = values.size();
+    return values.data();
+}
+
+void *imatrix_data(struct imatrix *m) {
+    return &m->values;
+}
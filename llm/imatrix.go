@@ -0,0 +1,139 @@
+package llm
+
+// #include <stdlib.h>
+// #include "imatrix.h"
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"unsafe"
+
+	"golang.org/x/exp/maps"
+)
+
+// Imatrix is an importance matrix. It maps the name of a weight to the mean
+// squared activation of each of its input columns. Quantizing with an
+// importance matrix preserves the weights which contribute most to a model's
+// outputs and is required for the lowest bit IQ types.
+type Imatrix map[string][]float32
+
+// ReadImatrix reads an importance matrix in the format written by llama.cpp's
+// imatrix tool.
+func ReadImatrix(r io.Reader) (Imatrix, error) {
+	var n int32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+
+	if n <= 0 {
+		return nil, errors.New("invalid imatrix: no entries")
+	}
+
+	m := make(Imatrix)
+	for range n {
+		var length int32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return nil, err
+		}
+
+		if length <= 0 || length > 1<<10 {
+			return nil, fmt.Errorf("invalid imatrix: name length %d", length)
+		}
+
+		name := make([]byte, length)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, err
+		}
+
+		var ncall, nval int32
+		if err := binary.Read(r, binary.LittleEndian, &ncall); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(r, binary.LittleEndian, &nval); err != nil {
+			return nil, err
+		}
+
+		if nval <= 0 || nval > 1<<20 {
+			return nil, fmt.Errorf("invalid imatrix: %s has %d values", name, nval)
+		}
+
+		values := make([]float32, nval)
+		if err := binary.Read(r, binary.LittleEndian, values); err != nil {
+			return nil, err
+		}
+
+		// values are stored multiplied by the number of evaluations
+		if ncall > 0 {
+			for i := range values {
+				values[i] /= float32(ncall)
+			}
+		}
+
+		m[string(name)] = values
+	}
+
+	// the number of chunks and dataset name which follow aren't needed
+	return m, nil
+}
+
+// WriteTo writes m in the format read by ReadImatrix.
+func (m Imatrix) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(v any) error {
+		n += int64(binary.Size(v))
+		return binary.Write(w, binary.LittleEndian, v)
+	}
+
+	if err := write(int32(len(m))); err != nil {
+		return n, err
+	}
+
+	names := maps.Keys(m)
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := write(int32(len(name))); err != nil {
+			return n, err
+		}
+
+		if err := write([]byte(name)); err != nil {
+			return n, err
+		}
+
+		// ncall
+		if err := write(int32(1)); err != nil {
+			return n, err
+		}
+
+		if err := write(int32(len(m[name]))); err != nil {
+			return n, err
+		}
+
+		if err := write(m[name]); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// c returns m as a C imatrix. It must be freed with imatrix_free.
+func (m Imatrix) c() *C.struct_imatrix {
+	cm := C.imatrix_new()
+	for name, values := range m {
+		if len(values) == 0 {
+			continue
+		}
+
+		cname := C.CString(name)
+		C.imatrix_set(cm, cname, (*C.float)(unsafe.Pointer(&values[0])), C.size_t(len(values)))
+		C.free(unsafe.Pointer(cname))
+	}
+
+	return cm
+}
@@ -0,0 +1,29 @@
+#ifndef OLLAMA_IMATRIX_H
+#define OLLAMA_IMATRIX_H
+
+#include <stddef.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+// imatrix is an importance matrix: the mean squared activation of each input
+// column of a weight, keyed by the weight's name
+struct imatrix;
+
+struct imatrix *imatrix_new(void);
+void imatrix_free(struct imatrix *m);
+
+void imatrix_set(struct imatrix *m, const char *name, const float *values, size_t n);
+size_t imatrix_len(const struct imatrix *m);
+const char *imatrix_name(const struct imatrix *m, size_t i);
+const float *imatrix_values(const struct imatrix *m, size_t i, size_t *n);
+
+// imatrix_data returns m in the form llama_model_quantize_params.imatrix expects
+void *imatrix_data(struct imatrix *m);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif // OLLAMA_IMATRIX_H
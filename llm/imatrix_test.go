@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImatrix(t *testing.T) {
+	want := Imatrix{
+		"blk.0.attn_q.weight": {1, 2, 3, 4},
+		"output.weight":       {0.5, 0.25},
+	}
+
+	var b bytes.Buffer
+	if _, err := want.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadImatrix(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("imatrix mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadImatrix(t *testing.T) {
+	t.Run("llama.cpp", func(t *testing.T) {
+		var b bytes.Buffer
+		for _, v := range []any{
+			int32(1),
+			int32(len("blk.0.ffn_down.weight")), []byte("blk.0.ffn_down.weight"),
+			int32(4), int32(2), []float32{8, 2},
+			// last chunk and dataset
+			int32(10), int32(len("wiki.train.raw")), []byte("wiki.train.raw"),
+		} {
+			if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		m, err := ReadImatrix(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(Imatrix{"blk.0.ffn_down.weight": {2, 0.5}}, m); diff != "" {
+			t.Errorf("imatrix mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := ReadImatrix(bytes.NewReader(nil)); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		if _, err := ReadImatrix(bytes.NewReader([]byte("the quick brown fox jumps over the lazy dog"))); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package llm
 
 // #cgo CFLAGS: -Illama.cpp -Illama.cpp/include -Illama.cpp/ggml/include
+// #cgo CXXFLAGS: -std=c++11 -Illama.cpp -Illama.cpp/include -Illama.cpp/ggml/include
 // #cgo LDFLAGS: -lllama -lggml -lstdc++ -lpthread
 // #cgo darwin,arm64 LDFLAGS: -L${SRCDIR}/build/darwin/arm64_static -L${SRCDIR}/build/darwin/arm64_static/src -L${SRCDIR}/build/darwin/arm64_static/ggml/src -framework Accelerate -framework Metal
 // #cgo darwin,amd64 LDFLAGS: -L${SRCDIR}/build/darwin/x86_64_static -L${SRCDIR}/build/darwin/x86_64_static/src -L${SRCDIR}/build/darwin/x86_64_static/ggml/src
@@ -10,6 +11,7 @@ package llm
 // #cgo linux,arm64 LDFLAGS: -L${SRCDIR}/build/linux/arm64_static -L${SRCDIR}/build/linux/arm64_static/src -L${SRCDIR}/build/linux/arm64_static/ggml/src
 // #include <stdlib.h>
 // #include "llama.h"
+// #include "imatrix.h"
 import "C"
 
 import (
@@ -22,7 +24,9 @@ func SystemInfo() string {
 	return C.GoString(C.llama_print_system_info())
 }
 
-func Quantize(infile, outfile string, ftype fileType) error {
+// Quantize quantizes the model at infile to ftype. imatrix, if not nil, is used to
+// decide which weights to preserve.
+func Quantize(infile, outfile string, ftype fileType, imatrix Imatrix) error {
 	cinfile := C.CString(infile)
 	defer C.free(unsafe.Pointer(cinfile))
 
@@ -33,9 +37,34 @@ func Quantize(infile, outfile string, ftype fileType) error {
 	params.nthread = -1
 	params.ftype = ftype.Value()
 
+	if imatrix != nil {
+		cm := imatrix.c()
+		defer C.imatrix_free(cm)
+
+		params.imatrix = C.imatrix_data(cm)
+	}
+
 	if rc := C.llama_model_quantize(cinfile, coutfile, &params); rc != 0 {
 		return errors.New("failed to quantize model. This model architecture may not be supported, or you may need to upgrade Ollama to the latest version")
 	}
 
 	return nil
 }
+
+// quantizeRows quantizes rows of n elements from src to dst. start is the
+// index of the first element to quantize and must be a multiple of n.
+func quantizeRows(kind uint32, src []float32, dst []byte, start, rows, n int) {
+	C.ggml_quantize_chunk(
+		C.enum_ggml_type(kind),
+		(*C.float)(unsafe.Pointer(&src[0])),
+		unsafe.Pointer(&dst[0]),
+		C.int64_t(start),
+		C.int64_t(rows),
+		C.int64_t(n),
+		nil,
+	)
+}
+
+func requiresImatrix(kind uint32) bool {
+	return bool(C.ggml_quantize_requires_imatrix(C.enum_ggml_type(kind)))
+}
@@ -1,12 +1,15 @@
 package llm
 
 import (
+	"cmp"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/gpu"
 )
@@ -51,12 +54,14 @@ type MemoryEstimate struct {
 	// For multi-GPU scenarios, this is the size in bytes per GPU
 	GPUSizes []uint64
 
+	// The size of the KV cache for the context length
+	KV uint64
+
 	// internal fields for logging purposes
 	inferenceLibrary    string
 	layersRequested     int
 	layersModel         int
 	availableList       []string
-	kv                  uint64
 	allocationsList     []string
 	memoryWeights       uint64
 	memoryLayerOutput   uint64
@@ -67,12 +72,6 @@ type MemoryEstimate struct {
 // Given a model and one or more GPU targets, predict how many layers and bytes we can load, and the total size
 // The GPUs provided must all be the same Library
 func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts api.Options) MemoryEstimate {
-	// Graph size for a partial offload, applies to all GPUs
-	var graphPartialOffload uint64
-
-	// Graph size when all layers are offloaded, applies to all GPUs
-	var graphFullOffload uint64
-
 	// Final graph offload once we know full or partial
 	var graphOffload uint64
 
@@ -115,13 +114,12 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 		slog.Warn("model missing blk.0 layer size")
 	}
 
-	// fp16 k,v = sizeof(float16) * n_ctx * n_layer * (n_embd_head_k + n_embd_head_v) * n_head_kv
-	var kv uint64 = 2 * uint64(opts.NumCtx) * ggml.KV().BlockCount() * (ggml.KV().EmbeddingHeadCountK() + ggml.KV().EmbeddingHeadCountV()) * ggml.KV().HeadCountKV()
+	cacheTypeK, cacheTypeV := kvCacheTypes(opts, gpus)
+	kv, graphPartialOffload, graphFullOffload := ggml.GraphSize(uint64(opts.NumCtx), uint64(min(opts.NumCtx, opts.NumBatch)), cacheTypeK, cacheTypeV)
 
 	// KV is proportional to the number of layers
 	layerSize += kv / ggml.KV().BlockCount()
 
-	graphPartialOffload, graphFullOffload = ggml.GraphSize(uint64(opts.NumCtx), uint64(min(opts.NumCtx, opts.NumBatch)))
 	if graphPartialOffload == 0 {
 		graphPartialOffload = ggml.KV().GQA() * kv / 6
 	}
@@ -280,8 +278,8 @@ func EstimateGPULayers(gpus []gpu.GpuInfo, ggml *GGML, projectors []string, opts
 		inferenceLibrary:    gpus[0].Library,
 		layersRequested:     opts.NumGPU,
 		layersModel:         int(ggml.KV().BlockCount()) + 1,
+		KV:                  kv,
 		availableList:       availableList,
-		kv:                  kv,
 		allocationsList:     allocationsList,
 		memoryWeights:       memoryWeights,
 		memoryLayerOutput:   memoryLayerOutput,
@@ -330,7 +328,7 @@ func (m MemoryEstimate) log() {
 				// memory required to offload layers.estimate layers
 				"partial", format.HumanBytes2(m.VRAMSize),
 				// memory of KV cache
-				"kv", format.HumanBytes2(m.kv),
+				"kv", format.HumanBytes2(m.KV),
 				// Allocations across the GPUs
 				"allocations", m.allocationsList,
 			),
@@ -353,3 +351,50 @@ func (m MemoryEstimate) log() {
 		),
 	)
 }
+
+// KVCacheTypes returns the types the K and V caches are stored as with opts.
+// They default to OLLAMA_KV_CACHE_TYPE and then to f16, or to f32 when f16_kv
+// is disabled.
+func KVCacheTypes(opts api.Options) (k, v string) {
+	def := "f16"
+	if t := envconfig.KvCacheType(); slices.Contains(api.CacheTypes, t) {
+		def = t
+	} else if t != "" {
+		slog.Warn("invalid OLLAMA_KV_CACHE_TYPE, using the default", "type", t, "default", def)
+	}
+
+	if !opts.F16KV {
+		def = "f32"
+	}
+
+	return cmp.Or(opts.CacheTypeK, def), cmp.Or(opts.CacheTypeV, def)
+}
+
+// kvCacheTypes returns the types the K and V caches are stored as when the
+// model is loaded on gpus. The V cache can only be quantized with flash
+// attention, so it falls back to f16 without it.
+func kvCacheTypes(opts api.Options, gpus gpu.GpuInfoList) (k, v string) {
+	k, v = KVCacheTypes(opts)
+	if v != "f16" && v != "f32" && !flashAttention(gpus) {
+		v = "f16"
+	}
+
+	return k, v
+}
+
+// flashAttention reports whether flash attention is enabled and supported
+// by all the GPUs
+func flashAttention(gpus gpu.GpuInfoList) bool {
+	if !envconfig.FlashAttention() {
+		return false
+	}
+
+	for _, g := range gpus {
+		// only cuda (compute capability 7+) and metal support flash attention
+		if g.Library != "metal" && (g.Library != "cuda" || g.DriverMajor < 7) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -125,4 +125,60 @@ func TestEstimateGPULayers(t *testing.T) {
 			}
 		})
 	}
+	t.Run("kv cache types", func(t *testing.T) {
+		gpus := []gpu.GpuInfo{{Library: "cuda", DriverMajor: 8}}
+
+		// k,v = elements * n_ctx * n_layer * n_embd_head * n_head_kv
+		elements := uint64(opts.NumCtx) * uint64(inputLayerCount) * (4096 / 32) * 32
+		f16 := EstimateGPULayers(gpus, ggml, projectors, opts)
+		assert.Equal(t, 2*2*elements, f16.KV)
+
+		opts := opts
+		opts.CacheTypeK, opts.CacheTypeV = "q8_0", "q8_0"
+
+		// the V cache isn't quantized without flash attention
+		t.Setenv("OLLAMA_FLASH_ATTENTION", "0")
+		estimate := EstimateGPULayers(gpus, ggml, projectors, opts)
+		assert.Equal(t, elements*34/32+2*elements, estimate.KV)
+
+		t.Setenv("OLLAMA_FLASH_ATTENTION", "1")
+		estimate = EstimateGPULayers(gpus, ggml, projectors, opts)
+		assert.Equal(t, 2*elements*34/32, estimate.KV)
+
+		opts.F16KV = false
+		opts.CacheTypeK, opts.CacheTypeV = "", ""
+		estimate = EstimateGPULayers(gpus, ggml, projectors, opts)
+		assert.Equal(t, 2*4*elements, estimate.KV)
+	})
+}
+
+func TestKVCacheTypes(t *testing.T) {
+	cases := []struct {
+		env          string
+		f16KV        bool
+		k, v         string
+		wantK, wantV string
+	}{
+		{"", true, "", "", "f16", "f16"},
+		{"", false, "", "", "f32", "f32"},
+		{"q8_0", true, "", "", "q8_0", "q8_0"},
+		{"q8_0", true, "q4_0", "", "q4_0", "q8_0"},
+		{"q8_0", false, "", "", "f32", "f32"},
+		{"q3_k", true, "", "", "f16", "f16"},
+		{"", true, "q8_0", "q4_0", "q8_0", "q4_0"},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("%+v", tt), func(t *testing.T) {
+			t.Setenv("OLLAMA_KV_CACHE_TYPE", tt.env)
+
+			opts := api.DefaultOptions()
+			opts.F16KV = tt.f16KV
+			opts.CacheTypeK, opts.CacheTypeV = tt.k, tt.v
+
+			k, v := KVCacheTypes(opts)
+			assert.Equal(t, tt.wantK, k)
+			assert.Equal(t, tt.wantV, v)
+		})
+	}
 }
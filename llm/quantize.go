@@ -0,0 +1,332 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/x448/float16"
+)
+
+// tensor kinds as defined by ggml_type
+const (
+	kindF32    uint32 = 0
+	kindF16    uint32 = 1
+	kindQ4_0   uint32 = 2
+	kindQ4_1   uint32 = 3
+	kindQ5_0   uint32 = 6
+	kindQ5_1   uint32 = 7
+	kindQ8_0   uint32 = 8
+	kindQ2_K   uint32 = 10
+	kindQ3_K   uint32 = 11
+	kindQ4_K   uint32 = 12
+	kindQ5_K   uint32 = 13
+	kindQ6_K   uint32 = 14
+	kindIQ2XXS uint32 = 16
+	kindIQ2XS  uint32 = 17
+	kindIQ3XXS uint32 = 18
+	kindIQ1S   uint32 = 19
+	kindIQ4NL  uint32 = 20
+	kindIQ3S   uint32 = 21
+	kindIQ2S   uint32 = 22
+	kindIQ4XS  uint32 = 23
+	kindIQ1M   uint32 = 29
+	kindBF16   uint32 = 30
+)
+
+// kind returns the tensor kind used for most weights of a model of file type t
+func (t fileType) kind() uint32 {
+	switch t {
+	case fileTypeF32:
+		return kindF32
+	case fileTypeF16:
+		return kindF16
+	case fileTypeBF16:
+		return kindBF16
+	case fileTypeQ4_0:
+		return kindQ4_0
+	case fileTypeQ4_1:
+		return kindQ4_1
+	case fileTypeQ5_0:
+		return kindQ5_0
+	case fileTypeQ5_1:
+		return kindQ5_1
+	case fileTypeQ8_0:
+		return kindQ8_0
+	case fileTypeQ2_K, fileTypeQ2_K_S:
+		return kindQ2_K
+	case fileTypeQ3_K_S, fileTypeQ3_K_M, fileTypeQ3_K_L:
+		return kindQ3_K
+	case fileTypeQ4_K_S, fileTypeQ4_K_M:
+		return kindQ4_K
+	case fileTypeQ5_K_S, fileTypeQ5_K_M:
+		return kindQ5_K
+	case fileTypeQ6_K:
+		return kindQ6_K
+	case fileTypeIQ2_XXS:
+		return kindIQ2XXS
+	case fileTypeIQ2_XS:
+		return kindIQ2XS
+	case fileTypeIQ3_XXS:
+		return kindIQ3XXS
+	case fileTypeIQ1_S:
+		return kindIQ1S
+	case fileTypeIQ1_M:
+		return kindIQ1M
+	case fileTypeIQ4_NL:
+		return kindIQ4NL
+	case fileTypeIQ3_S, fileTypeIQ3_XS:
+		return kindIQ3S
+	case fileTypeIQ2_S, fileTypeIQ2_M:
+		return kindIQ2S
+	case fileTypeIQ4_XS:
+		return kindIQ4XS
+	default:
+		return kindF16
+	}
+}
+
+// useMoreBits reports whether layer i of n should be quantized with more bits.
+// The first and last eighth of the layers, and every third layer in between,
+// are the most sensitive to quantization.
+func useMoreBits(i, n int) bool {
+	return i < n/8 || i >= 7*n/8 || (i-n/8)%3 == 2
+}
+
+// tensorKind returns the kind t quantizes the named tensor to. It follows the
+// rules llama.cpp's llama_model_quantize uses so models quantized while they're
+// converted match models quantized from an F16 file.
+func (t fileType) tensorKind(name string, shape []uint64, blocks int, tied bool) uint32 {
+	// vectors such as norms and biases aren't quantized
+	if len(shape) < 2 || !strings.HasSuffix(name, ".weight") {
+		return kindF32
+	}
+
+	kind := t.kind()
+	switch kind {
+	case kindF32, kindF16, kindBF16:
+		return kind
+	}
+
+	var block int
+	if _, err := fmt.Sscanf(name, "blk.%d.", &block); err != nil {
+		block = -1
+	}
+
+	switch {
+	case name == "output.weight" || (tied && name == "token_embd.weight"):
+		if kind != kindQ8_0 {
+			kind = kindQ6_K
+		}
+	case strings.HasSuffix(name, "attn_v.weight"):
+		switch t {
+		case fileTypeQ2_K:
+			kind = kindQ3_K
+		case fileTypeQ3_K_M:
+			if block < 2 {
+				kind = kindQ5_K
+			} else {
+				kind = kindQ4_K
+			}
+		case fileTypeQ3_K_L:
+			kind = kindQ5_K
+		case fileTypeQ4_K_M, fileTypeQ5_K_M:
+			if useMoreBits(block, blocks) {
+				kind = kindQ6_K
+			}
+		case fileTypeQ4_K_S:
+			if block < 4 {
+				kind = kindQ5_K
+			}
+		}
+	case strings.HasSuffix(name, "ffn_down.weight"):
+		switch t {
+		case fileTypeQ2_K:
+			kind = kindQ3_K
+		case fileTypeQ3_K_M:
+			if block < blocks/16 {
+				kind = kindQ5_K
+			} else {
+				kind = kindQ4_K
+			}
+		case fileTypeQ3_K_L:
+			kind = kindQ5_K
+		case fileTypeQ4_K_M, fileTypeQ5_K_M:
+			if useMoreBits(block, blocks) {
+				kind = kindQ6_K
+			}
+		case fileTypeQ4_K_S:
+			if block < blocks/8 {
+				kind = kindQ5_K
+			}
+		}
+	case strings.HasSuffix(name, "attn_output.weight"):
+		switch t {
+		case fileTypeQ3_K_M:
+			kind = kindQ4_K
+		case fileTypeQ3_K_L:
+			kind = kindQ5_K
+		}
+	case strings.HasSuffix(name, "attn_qkv.weight"):
+		switch t {
+		case fileTypeQ3_K_M, fileTypeQ3_K_L:
+			kind = kindQ4_K
+		case fileTypeQ4_K_M:
+			kind = kindQ5_K
+		case fileTypeQ5_K_M:
+			kind = kindQ6_K
+		}
+	}
+
+	// rows must be a whole number of blocks so fall back to a type with
+	// smaller blocks when they're not
+	if n := shape[len(shape)-1]; n%(Tensor{Kind: kind}).blockSize() != 0 {
+		switch kind {
+		case kindQ2_K, kindQ3_K, kindIQ4XS:
+			kind = kindIQ4NL
+		case kindQ4_K:
+			kind = kindQ5_0
+		case kindQ5_K:
+			kind = kindQ5_1
+		case kindQ6_K:
+			kind = kindQ8_0
+		}
+
+		if n%(Tensor{Kind: kind}).blockSize() != 0 {
+			kind = kindF16
+		}
+	}
+
+	return kind
+}
+
+// QuantizeTensors returns ts with each tensor quantized to the kind file type
+// ft calls for as it is written. Tensors must be written in F32 or F16. fn, if
+// not nil, is called after each tensor is written with the number of source
+// bytes written so far.
+func QuantizeTensors(kv KV, ts []Tensor, ft fileType, fn func(completed, total int64)) ([]Tensor, error) {
+	tied := !slices.ContainsFunc(ts, func(t Tensor) bool {
+		return t.Name == "output.weight"
+	})
+
+	var completed, total int64
+	for _, t := range ts {
+		total += int64(t.Size())
+	}
+
+	out := make([]Tensor, len(ts))
+	for i, t := range ts {
+		kind := ft.tensorKind(t.Name, t.Shape, int(kv.BlockCount()), tied)
+		if t.Kind == kindF32 {
+			// tensors such as expert routers are kept in full precision
+			kind = kindF32
+		} else if requiresImatrix(kind) {
+			return nil, fmt.Errorf("quantizing %s to %s requires an importance matrix", t.Name, ft)
+		}
+
+		out[i] = t
+		out[i].Kind = kind
+		out[i].WriterTo = &quantizer{
+			src:  t,
+			kind: kind,
+			fn: func() {
+				completed += int64(t.Size())
+				if fn != nil {
+					fn(completed, total)
+				}
+			},
+		}
+	}
+
+	return out, nil
+}
+
+// quantizer writes src quantized to kind. src is written in its original
+// encoding then decoded so any converter can be quantized.
+type quantizer struct {
+	src  Tensor
+	kind uint32
+	fn   func()
+}
+
+func (q *quantizer) WriteTo(w io.Writer) (int64, error) {
+	defer q.fn()
+
+	// tensors which keep their kind, e.g. F16 to F16, are passed through
+	// without being decoded
+	if q.kind == q.src.Kind {
+		return q.src.WriteTo(w)
+	}
+
+	var b bytes.Buffer
+	if _, err := q.src.WriteTo(&b); err != nil {
+		return 0, err
+	}
+
+	var f32s []float32
+	switch q.src.Kind {
+	case kindF32:
+		f32s = make([]float32, b.Len()/4)
+		if err := binary.Read(&b, binary.LittleEndian, f32s); err != nil {
+			return 0, err
+		}
+	case kindF16:
+		u16s := make([]uint16, b.Len()/2)
+		if err := binary.Read(&b, binary.LittleEndian, u16s); err != nil {
+			return 0, err
+		}
+
+		f32s = make([]float32, len(u16s))
+		for i := range u16s {
+			f32s[i] = float16.Frombits(u16s[i]).Float32()
+		}
+	default:
+		return 0, fmt.Errorf("cannot quantize %s from kind %d", q.src.Name, q.src.Kind)
+	}
+
+	dst := Tensor{Kind: q.kind, Shape: q.src.Shape}
+	switch q.kind {
+	case kindF32:
+		if err := binary.Write(w, binary.LittleEndian, f32s); err != nil {
+			return 0, err
+		}
+
+		return int64(binary.Size(f32s)), nil
+	case kindF16:
+		u16s := make([]uint16, len(f32s))
+		for i := range f32s {
+			u16s[i] = float16.Fromfloat32(f32s[i]).Bits()
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, u16s); err != nil {
+			return 0, err
+		}
+
+		return int64(binary.Size(u16s)), nil
+	}
+
+	n := int(q.src.Shape[len(q.src.Shape)-1])
+	rows := len(f32s) / n
+	bts := make([]byte, dst.Size())
+
+	// quantize chunks of rows in parallel
+	chunk := max(1, rows/runtime.NumCPU())
+
+	var wg sync.WaitGroup
+	for start := 0; start < rows; start += chunk {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			quantizeRows(q.kind, f32s, bts, start*n, min(chunk, rows-start), n)
+		}()
+	}
+	wg.Wait()
+
+	written, err := w.Write(bts)
+	return int64(written), err
+}
@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/x448/float16"
+)
+
+func TestTensorKind(t *testing.T) {
+	cases := []struct {
+		name     string
+		fileType fileType
+		tensor   string
+		shape    []uint64
+		tied     bool
+		kind     uint32
+	}{
+		{"norm", fileTypeQ4_K_M, "blk.0.attn_norm.weight", []uint64{4096}, false, kindF32},
+		{"bias", fileTypeQ4_K_M, "blk.0.attn_q.bias", []uint64{4096, 1}, false, kindF32},
+		{"f16", fileTypeF16, "blk.0.attn_q.weight", []uint64{4096, 4096}, false, kindF16},
+		{"default", fileTypeQ4_K_M, "blk.10.attn_q.weight", []uint64{4096, 4096}, false, kindQ4_K},
+		{"output", fileTypeQ4_K_M, "output.weight", []uint64{32000, 4096}, false, kindQ6_K},
+		{"output q8_0", fileTypeQ8_0, "output.weight", []uint64{32000, 4096}, false, kindQ8_0},
+		{"tied embeddings", fileTypeQ4_K_M, "token_embd.weight", []uint64{32000, 4096}, true, kindQ6_K},
+		{"untied embeddings", fileTypeQ4_K_M, "token_embd.weight", []uint64{32000, 4096}, false, kindQ4_K},
+		{"attn_v first layer", fileTypeQ4_K_M, "blk.0.attn_v.weight", []uint64{1024, 4096}, false, kindQ6_K},
+		{"attn_v middle layer", fileTypeQ4_K_M, "blk.10.attn_v.weight", []uint64{1024, 4096}, false, kindQ4_K},
+		{"attn_v third layer", fileTypeQ4_K_M, "blk.9.attn_v.weight", []uint64{1024, 4096}, false, kindQ6_K},
+		{"ffn_down q3_k_m", fileTypeQ3_K_M, "blk.10.ffn_down.weight", []uint64{4096, 11008}, false, kindQ4_K},
+		{"attn_output q3_k_l", fileTypeQ3_K_L, "blk.10.attn_output.weight", []uint64{4096, 4096}, false, kindQ5_K},
+		{"attn_qkv q4_k_m", fileTypeQ4_K_M, "blk.10.attn_qkv.weight", []uint64{12288, 4096}, false, kindQ5_K},
+		{"q4_k fallback", fileTypeQ4_K_M, "blk.10.attn_q.weight", []uint64{4096, 4000}, false, kindQ5_0},
+		{"q6_k fallback", fileTypeQ6_K, "blk.10.attn_q.weight", []uint64{4096, 4000}, false, kindQ8_0},
+		{"f16 fallback", fileTypeQ4_K_M, "blk.10.attn_q.weight", []uint64{4096, 100}, false, kindF16},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := tt.fileType.tensorKind(tt.tensor, tt.shape, 32, tt.tied); kind != tt.kind {
+				t.Errorf("want kind %d, got %d", tt.kind, kind)
+			}
+		})
+	}
+}
+
+func TestQuantizerWriteTo(t *testing.T) {
+	f32s := []float32{1, -2, 0.5, 4}
+
+	var f32 bytes.Buffer
+	if err := binary.Write(&f32, binary.LittleEndian, f32s); err != nil {
+		t.Fatal(err)
+	}
+
+	var f16 bytes.Buffer
+	for _, f := range f32s {
+		if err := binary.Write(&f16, binary.LittleEndian, float16.Fromfloat32(f).Bits()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		src, dst uint32
+		in, out  []byte
+	}{
+		{"f32 to f32", kindF32, kindF32, f32.Bytes(), f32.Bytes()},
+		{"f16 to f16", kindF16, kindF16, f16.Bytes(), f16.Bytes()},
+		{"f32 to f16", kindF32, kindF16, f32.Bytes(), f16.Bytes()},
+		{"f16 to f32", kindF16, kindF32, f16.Bytes(), f32.Bytes()},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			q := quantizer{
+				src:  Tensor{Name: "blk.0.attn_q.weight", Kind: tt.src, Shape: []uint64{4}, WriterTo: bytes.NewReader(tt.in)},
+				kind: tt.dst,
+				fn:   func() {},
+			}
+
+			var b bytes.Buffer
+			n, err := q.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n != int64(b.Len()) {
+				t.Errorf("expected %d bytes written, got %d", b.Len(), n)
+			}
+
+			if !bytes.Equal(b.Bytes(), tt.out) {
+				t.Errorf("expected %v, got %v", tt.out, b.Bytes())
+			}
+		})
+	}
+}
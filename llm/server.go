@@ -34,6 +34,7 @@ type LlamaServer interface {
 	WaitUntilRunning(ctx context.Context) error
 	Completion(ctx context.Context, req CompletionRequest, fn func(CompletionResponse)) error
 	Embedding(ctx context.Context, input string) ([]float32, error)
+	Imatrix(ctx context.Context, calibration string) (Imatrix, error)
 	Tokenize(ctx context.Context, content string) ([]int, error)
 	Detokenize(ctx context.Context, tokens []int) (string, error)
 	Close() error
@@ -219,18 +220,20 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--threads", strconv.Itoa(opts.NumThread))
 	}
 
-	if !opts.F16KV {
-		params = append(params, "--memory-f32")
+	cacheTypeK, cacheTypeV := kvCacheTypes(opts, gpus)
+	if _, v := KVCacheTypes(opts); v != cacheTypeV {
+		slog.Warn("quantized V cache requires flash attention, using f16", "cache_type_v", v)
 	}
 
-	flashAttnEnabled := envconfig.FlashAttention()
+	if cacheTypeK != "f16" {
+		params = append(params, "--cache-type-k", cacheTypeK)
+	}
 
-	for _, g := range gpus {
-		// only cuda (compute capability 7+) and metal support flash attention
-		if g.Library != "metal" && (g.Library != "cuda" || g.DriverMajor < 7) {
-			flashAttnEnabled = false
-		}
+	if cacheTypeV != "f16" {
+		params = append(params, "--cache-type-v", cacheTypeV)
+	}
 
+	for _, g := range gpus {
 		// mmap has issues with partial offloading on metal
 		if g.Library == "metal" &&
 			uint64(opts.NumGPU) > 0 &&
@@ -240,7 +243,7 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		}
 	}
 
-	if flashAttnEnabled {
+	if flashAttention(gpus) {
 		params = append(params, "--flash-attn")
 	}
 
@@ -270,6 +273,11 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 
 	params = append(params, "--parallel", strconv.Itoa(numParallel))
 
+	params = append(params, ropeParams(opts)...)
+	if numCtx, trained := opts.NumCtx/max(numParallel, 1), ggml.KV().ContextLength(); trained > 0 && uint64(numCtx) > trained && !ropeScaled(opts) {
+		slog.Warn("num_ctx is longer than the model was trained with and RoPE scaling isn't set, which may degrade responses", "num_ctx", numCtx, "trained", trained)
+	}
+
 	if estimate.TensorSplit != "" {
 		params = append(params, "--tensor-split", estimate.TensorSplit)
 	}
@@ -462,7 +470,7 @@ func projectorMemoryRequirements(filename string) uint64 {
 		mem += layer.size()
 	}
 
-	return mem
+	return mem + ggml.VisionGraphSize()
 }
 
 type ServerStatus int
@@ -939,6 +947,79 @@ func (s *llmServer) Embedding(ctx context.Context, input string) ([]float32, err
 	return e.Embedding, nil
 }
 
+// imatrixContext is the number of tokens evaluated at a time when computing an
+// importance matrix
+const imatrixContext = 512
+
+type ImatrixRequest struct {
+	Content string `json:"content"`
+	NumCtx  int    `json:"n_ctx"`
+}
+
+type ImatrixResponse struct {
+	Imatrix Imatrix `json:"imatrix"`
+}
+
+// Imatrix computes an importance matrix for the model by evaluating it over
+// calibration text.
+func (s *llmServer) Imatrix(ctx context.Context, calibration string) (Imatrix, error) {
+	if calibration == "" {
+		return nil, errors.New("calibration text is empty")
+	}
+
+	if err := s.sem.Acquire(ctx, 1); err != nil {
+		slog.Error("Failed to acquire semaphore", "error", err)
+		return nil, err
+	}
+	defer s.sem.Release(1)
+
+	// Make sure the server is ready
+	status, err := s.getServerStatusRetry(ctx)
+	if err != nil {
+		return nil, err
+	} else if status != ServerStatusReady {
+		return nil, fmt.Errorf("unexpected server status: %s", status.ToString())
+	}
+
+	data, err := json.Marshal(ImatrixRequest{Content: calibration, NumCtx: imatrixContext})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling imatrix data: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/imatrix", s.port), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating imatrix request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("do imatrix request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading imatrix response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		log.Printf("llm imatrix error: %s", body)
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	var i ImatrixResponse
+	if err := json.Unmarshal(body, &i); err != nil {
+		return nil, fmt.Errorf("unmarshal imatrix response: %w", err)
+	}
+
+	if len(i.Imatrix) == 0 {
+		return nil, errors.New("failed to compute importance matrix: no weights were evaluated")
+	}
+
+	return i.Imatrix, nil
+}
+
 type TokenizeRequest struct {
 	Content string `json:"content"`
 }
@@ -1086,3 +1167,47 @@ func parseDurationMs(ms float64) time.Duration {
 
 	return dur
 }
+
+// ropeParams returns the runner flags for the RoPE scaling options which are
+// set. Unset options are loaded from the model.
+func ropeParams(opts api.Options) []string {
+	var params []string
+	if opts.RopeScalingType != "" {
+		params = append(params, "--rope-scaling", opts.RopeScalingType)
+	}
+
+	for _, p := range []struct {
+		flag  string
+		value float32
+	}{
+		{"--rope-freq-base", opts.RopeFrequencyBase},
+		{"--rope-freq-scale", opts.RopeFrequencyScale},
+		{"--yarn-attn-factor", opts.YarnAttnFactor},
+		{"--yarn-beta-fast", opts.YarnBetaFast},
+		{"--yarn-beta-slow", opts.YarnBetaSlow},
+	} {
+		if p.value > 0 {
+			params = append(params, p.flag, strconv.FormatFloat(float64(p.value), 'f', -1, 32))
+		}
+	}
+
+	// an extrapolation mix of 0 is full interpolation
+	if opts.YarnExtFactor >= 0 {
+		params = append(params, "--yarn-ext-factor", strconv.FormatFloat(float64(opts.YarnExtFactor), 'f', -1, 32))
+	}
+
+	return params
+}
+
+// ropeScaled reports whether opts scale RoPE to extend the context past the
+// length the model was trained with
+func ropeScaled(opts api.Options) bool {
+	switch {
+	case opts.RopeScalingType == "linear", opts.RopeScalingType == "yarn":
+		return true
+	case opts.RopeFrequencyScale > 0 && opts.RopeFrequencyScale != 1:
+		return true
+	default:
+		return opts.RopeFrequencyBase > 0
+	}
+}
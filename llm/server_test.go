@@ -0,0 +1,37 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestRopeParams(t *testing.T) {
+	opts := api.DefaultOptions()
+	assert.Empty(t, ropeParams(opts))
+	assert.False(t, ropeScaled(opts))
+
+	opts.RopeScalingType = "yarn"
+	opts.RopeFrequencyScale = 0.25
+	opts.YarnExtFactor = 0
+	opts.YarnBetaFast = 32
+	assert.Equal(t, []string{
+		"--rope-scaling", "yarn",
+		"--rope-freq-scale", "0.25",
+		"--yarn-beta-fast", "32",
+		"--yarn-ext-factor", "0",
+	}, ropeParams(opts))
+	assert.True(t, ropeScaled(opts))
+
+	opts = api.DefaultOptions()
+	opts.RopeFrequencyBase = 1e6
+	assert.Equal(t, []string{"--rope-freq-base", "1000000"}, ropeParams(opts))
+	assert.True(t, ropeScaled(opts))
+
+	opts = api.DefaultOptions()
+	opts.RopeScalingType = "none"
+	opts.RopeFrequencyScale = 1
+	assert.False(t, ropeScaled(opts))
+}
@@ -163,6 +163,25 @@ func TestParseFileFrom(t *testing.T) {
 	}
 }
 
+func TestParseFileLabels(t *testing.T) {
+	input := `
+FROM foo
+LABEL owner=search-team
+label stage = "canary release"
+`
+
+	modelfile, err := ParseFile(strings.NewReader(input))
+	require.NoError(t, err)
+
+	expectedCommands := []Command{
+		{Name: "model", Args: "foo"},
+		{Name: "label", Args: "owner=search-team"},
+		{Name: "label", Args: `stage = "canary release"`},
+	}
+
+	assert.Equal(t, expectedCommands, modelfile.Commands)
+}
+
 func TestParseFileParametersMissingValue(t *testing.T) {
 	input := `
 FROM foo
@@ -441,6 +460,13 @@ func TestParseFileParameters(t *testing.T) {
 		"main_gpu 1":                   {"main_gpu", "1"},
 		"low_vram true":                {"low_vram", "true"},
 		"f16_kv true":                  {"f16_kv", "true"},
+		"rope_scaling_type yarn":       {"rope_scaling_type", "yarn"},
+		"rope_frequency_base 1e6":      {"rope_frequency_base", "1e6"},
+		"rope_frequency_scale 0.5":     {"rope_frequency_scale", "0.5"},
+		"yarn_ext_factor 1.0":          {"yarn_ext_factor", "1.0"},
+		"yarn_attn_factor 1.0":         {"yarn_attn_factor", "1.0"},
+		"yarn_beta_fast 32.0":          {"yarn_beta_fast", "32.0"},
+		"yarn_beta_slow 1.0":           {"yarn_beta_slow", "1.0"},
 		"logits_all true":              {"logits_all", "true"},
 		"vocab_only true":              {"vocab_only", "true"},
 		"use_mmap true":                {"use_mmap", "true"},
@@ -562,6 +588,11 @@ MESSAGE assistant Hello, I want to parse all the things!
 		`
 FROM foo
 SYSTEM ""
+`,
+		`
+FROM foo
+LABEL owner=search-team
+LABEL "description=answers questions about the docs "
 `,
 	}
 
@@ -0,0 +1,105 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Completer completes the word before the cursor when Tab is pressed.
+type Completer interface {
+	// Complete returns the candidates for the word ending at pos in line and
+	// the number of runes before pos each candidate replaces. It returns no
+	// candidates and a length of zero when there's nothing to complete, in
+	// which case Tab is inserted as spaces.
+	Complete(line []rune, pos int) (candidates []string, length int)
+}
+
+// CompleterFunc adapts a function to a Completer.
+type CompleterFunc func(line []rune, pos int) ([]string, int)
+
+func (f CompleterFunc) Complete(line []rune, pos int) ([]string, int) {
+	return f(line, pos)
+}
+
+// complete replaces the word before the cursor with the only candidate or the
+// prefix all candidates share. If that doesn't change the word, the
+// candidates are listed below the line and the line is redrawn.
+func (i *Instance) complete(buf *Buffer) *Buffer {
+	line := []rune(buf.String())
+	candidates, length := i.Completer.Complete(line, buf.Pos)
+	switch {
+	case len(candidates) == 0 && length == 0:
+		for range 8 {
+			buf.Add(' ')
+		}
+		return buf
+	case len(candidates) == 0:
+		fmt.Print(string(rune(CharBell)))
+		return buf
+	}
+
+	word := string(line[buf.Pos-length : buf.Pos])
+	replacement := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(replacement, "/") && !strings.HasSuffix(replacement, `\`) {
+		replacement += " "
+	}
+
+	if replacement != word && strings.HasPrefix(replacement, word) {
+		for _, r := range strings.TrimPrefix(replacement, word) {
+			buf.Add(r)
+		}
+		return buf
+	}
+
+	pos := buf.Pos
+	buf.MoveToEnd()
+	fmt.Println()
+	printColumns(candidates, buf.Width)
+
+	// redraw the line below the candidates with the cursor where it was
+	buf, _ = NewBuffer(i.Prompt)
+	fmt.Print(i.Prompt.prompt())
+	for _, r := range line {
+		buf.Add(r)
+	}
+
+	for range len(line) - pos {
+		buf.MoveLeft()
+	}
+
+	return buf
+}
+
+// commonPrefix returns the longest prefix shared by every string in ss
+func commonPrefix(ss []string) string {
+	prefix := []rune(ss[0])
+	for _, s := range ss[1:] {
+		rs := []rune(s)
+		n := 0
+		for n < len(prefix) && n < len(rs) && prefix[n] == rs[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+
+	return string(prefix)
+}
+
+// printColumns prints ss in as many columns as fit in width
+func printColumns(ss []string, width int) {
+	var cellWidth int
+	for _, s := range ss {
+		cellWidth = max(cellWidth, runewidth.StringWidth(s)+2)
+	}
+
+	columns := max(width/cellWidth, 1)
+	for n, s := range ss {
+		if n%columns == columns-1 || n == len(ss)-1 {
+			fmt.Println(s)
+		} else {
+			fmt.Print(runewidth.FillRight(s, cellWidth))
+		}
+	}
+}
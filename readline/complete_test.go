@@ -0,0 +1,27 @@
+package readline
+
+import "testing"
+
+func TestCommonPrefix(t *testing.T) {
+	cases := []struct {
+		ss   []string
+		want string
+	}{
+		{[]string{"/show"}, "/show"},
+		{[]string{"/set", "/show"}, "/s"},
+		{[]string{"/show", "/show info"}, "/show"},
+		{[]string{"/show info", "/show"}, "/show"},
+		{[]string{"/set", "/show", "/bye"}, "/"},
+		{[]string{"abc", "xyz"}, ""},
+		{[]string{"", "abc"}, ""},
+		// runes aren't split
+		{[]string{"héllo", "hélp"}, "hél"},
+		{[]string{"é", "è"}, ""},
+	}
+
+	for _, tt := range cases {
+		if got := commonPrefix(tt.ss); got != tt.want {
+			t.Errorf("commonPrefix(%q): expected %q, got %q", tt.ss, tt.want, got)
+		}
+	}
+}
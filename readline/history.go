@@ -121,6 +121,24 @@ func (h *History) Next() []rune {
 	return line
 }
 
+// Search returns the index of the most recent line before the index before
+// which contains query, or -1 if there's none
+func (h *History) Search(query string, before int) int {
+	for n := min(before, h.Size()) - 1; n >= 0; n-- {
+		if strings.Contains(string(h.get(n)), query) {
+			return n
+		}
+	}
+
+	return -1
+}
+
+func (h *History) get(n int) []rune {
+	v, _ := h.Buf.Get(n)
+	line, _ := v.([]rune)
+	return line
+}
+
 func (h *History) Size() int {
 	return h.Buf.Size()
 }
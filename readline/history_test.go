@@ -0,0 +1,50 @@
+package readline
+
+import (
+	"testing"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+)
+
+// newTestHistory returns a history of lines which isn't saved
+func newTestHistory(lines ...string) *History {
+	h := &History{Buf: arraylist.New(), Limit: 100}
+	for _, line := range lines {
+		h.Add([]rune(line))
+	}
+
+	return h
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := newTestHistory("pull llama3", "run llama3", "show mistral", "run mistral")
+
+	cases := []struct {
+		query  string
+		before int
+		want   int
+	}{
+		{"run", 4, 3},
+		{"run", 3, 1},
+		{"run", 2, 1},
+		{"run", 1, -1},
+		{"llama3", 4, 1},
+		{"pull", 4, 0},
+		{"missing", 4, -1},
+		{"", 4, 3},
+		// before is clamped to the history
+		{"run", 100, 3},
+		{"pull", 0, -1},
+		{"pull", -1, -1},
+	}
+
+	for _, tt := range cases {
+		if got := h.Search(tt.query, tt.before); got != tt.want {
+			t.Errorf("Search(%q, %d): expected %d, got %d", tt.query, tt.before, tt.want, got)
+		}
+	}
+
+	if got := newTestHistory().Search("", 0); got != -1 {
+		t.Errorf("expected -1 for an empty history, got %d", got)
+	}
+}
@@ -36,10 +36,11 @@ type Terminal struct {
 }
 
 type Instance struct {
-	Prompt   *Prompt
-	Terminal *Terminal
-	History  *History
-	Pasting  bool
+	Prompt    *Prompt
+	Terminal  *Terminal
+	History   *History
+	Completer Completer
+	Pasting   bool
 }
 
 func New(prompt Prompt) (*Instance, error) {
@@ -93,6 +94,9 @@ func (i *Instance) Readline() (string, error) {
 
 	var currentLineBuf []rune
 
+	// keys which ended a history search are handled before reading more
+	var pending []rune
+
 	for {
 		// don't show placeholder when pasting unless we're in multiline mode
 		showPlaceholder := !i.Pasting || i.Prompt.UseAlt
@@ -101,7 +105,13 @@ func (i *Instance) Readline() (string, error) {
 			fmt.Print(ColorGrey + ph + CursorLeftN(len(ph)) + ColorDefault)
 		}
 
-		r, err := i.Terminal.Read()
+		var r rune
+		var err error
+		if len(pending) > 0 {
+			r, pending = pending[0], pending[1:]
+		} else {
+			r, err = i.Terminal.Read()
+		}
 
 		if buf.IsEmpty() {
 			fmt.Print(ClearToEOL)
@@ -196,10 +206,20 @@ func (i *Instance) Readline() (string, error) {
 		case CharBackspace, CharCtrlH:
 			buf.Remove()
 		case CharTab:
+			if i.Completer != nil && !i.Pasting {
+				buf = i.complete(buf)
+				continue
+			}
+
 			// todo: convert back to real tabs
 			for range 8 {
 				buf.Add(' ')
 			}
+		case CharBckSearch:
+			pending, err = i.search(buf)
+			if err != nil {
+				return "", io.EOF
+			}
 		case CharDelete:
 			if buf.DisplaySize() > 0 {
 				buf.Delete()
@@ -0,0 +1,84 @@
+package readline
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// search runs an incremental reverse search of the history, showing the most
+// recent line which contains what's been typed so far. Ctrl-R finds the next
+// older match and Ctrl-G cancels the search. Any other key accepts the match
+// and is returned to be handled as usual.
+func (i *Instance) search(buf *Buffer) ([]rune, error) {
+	original := []rune(buf.String())
+	buf.Replace(nil)
+
+	var query []rune
+	match := -1
+	var failed bool
+
+	// find searches the lines before the match, or before and including it
+	find := func(including bool) {
+		before := i.History.Size()
+		if match >= 0 {
+			before = match
+			if including {
+				before++
+			}
+		}
+
+		if n := i.History.Search(string(query), before); n >= 0 {
+			match, failed = n, false
+		} else {
+			failed = true
+		}
+	}
+
+	line := func() []rune {
+		if match < 0 {
+			return original
+		}
+		return i.History.get(match)
+	}
+
+	for {
+		status := "(reverse-i-search)"
+		if failed {
+			status = "(failed reverse-i-search)"
+		}
+
+		status += fmt.Sprintf("'%s': %s", string(query), string(line()))
+		fmt.Print(CursorBOL + ClearToEOL + runewidth.Truncate(status, buf.Width-1, ""))
+
+		r, err := i.Terminal.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case r == CharBckSearch:
+			if len(query) > 0 {
+				find(false)
+			}
+		case r == CharBackspace || r == CharCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match, failed = -1, false
+				if len(query) > 0 {
+					find(false)
+				}
+			}
+		case r == CharBell:
+			buf.Replace(original)
+			return nil, nil
+		case r >= CharSpace:
+			query = append(query, r)
+			// the current match is kept if it still matches
+			find(true)
+		default:
+			buf.Replace(line())
+			return []rune{r}, nil
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package readline
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// newTestTerminal returns a terminal which reads keys and then io.EOF
+func newTestTerminal(keys ...rune) *Terminal {
+	ch := make(chan rune, len(keys))
+	for _, r := range keys {
+		ch <- r
+	}
+	close(ch)
+
+	return &Terminal{outchan: ch}
+}
+
+func TestSearch(t *testing.T) {
+	search := func(t *testing.T, line string, keys ...rune) (string, []rune, error) {
+		t.Helper()
+
+		i := &Instance{
+			Prompt:   &Prompt{Prompt: ">>> "},
+			Terminal: newTestTerminal(keys...),
+			History:  newTestHistory("pull llama3", "run llama3", "show mistral", "run mistral"),
+		}
+
+		buf, err := NewBuffer(i.Prompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range line {
+			buf.Add(r)
+		}
+
+		pending, err := i.search(buf)
+		return buf.String(), pending, err
+	}
+
+	cases := []struct {
+		name    string
+		line    string
+		keys    []rune
+		want    string
+		pending []rune
+	}{
+		{
+			name:    "most recent",
+			keys:    []rune{'r', 'u', 'n', CharEnter},
+			want:    "run mistral",
+			pending: []rune{CharEnter},
+		},
+		{
+			name:    "narrowed",
+			keys:    []rune{'r', 'u', 'n', ' ', 'l', CharEnter},
+			want:    "run llama3",
+			pending: []rune{CharEnter},
+		},
+		{
+			name:    "ctrl-r",
+			keys:    []rune{'r', 'u', 'n', CharBckSearch, CharEnter},
+			want:    "run llama3",
+			pending: []rune{CharEnter},
+		},
+		{
+			// the last match is kept when there are no older ones
+			name:    "ctrl-r past the oldest",
+			keys:    []rune{'r', 'u', 'n', CharBckSearch, CharBckSearch, CharBckSearch, CharEnter},
+			want:    "run llama3",
+			pending: []rune{CharEnter},
+		},
+		{
+			name:    "ctrl-r without a query",
+			line:    "draft",
+			keys:    []rune{CharBckSearch, CharEnter},
+			want:    "draft",
+			pending: []rune{CharEnter},
+		},
+		{
+			// the match is found again from the most recent line
+			name:    "backspace",
+			keys:    []rune{'r', 'u', 'n', CharBckSearch, CharBackspace, CharEnter},
+			want:    "run mistral",
+			pending: []rune{CharEnter},
+		},
+		{
+			name:    "ctrl-h",
+			keys:    []rune{'p', 'u', 'l', 'x', CharCtrlH, CharEnter},
+			want:    "pull llama3",
+			pending: []rune{CharEnter},
+		},
+		{
+			name:    "backspace to an empty query",
+			line:    "draft",
+			keys:    []rune{'r', CharBackspace, CharBackspace, CharEnter},
+			want:    "draft",
+			pending: []rune{CharEnter},
+		},
+		{
+			name:    "no match",
+			line:    "draft",
+			keys:    []rune{'z', 'z', CharEnter},
+			want:    "draft",
+			pending: []rune{CharEnter},
+		},
+		{
+			name: "ctrl-g",
+			line: "draft",
+			keys: []rune{'r', 'u', 'n', CharBckSearch, CharBell},
+			want: "draft",
+		},
+		{
+			// keys such as arrows are handled by the line editor
+			name:    "escape",
+			keys:    []rune{'s', 'h', 'o', 'w', CharEsc, '[', 'D'},
+			want:    "show mistral",
+			pending: []rune{CharEsc},
+		},
+		{
+			name:    "tab",
+			keys:    []rune{'m', 'i', 's', CharTab},
+			want:    "run mistral",
+			pending: []rune{CharTab},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, pending, err := search(t, tt.line, tt.keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+
+			if !slices.Equal(pending, tt.pending) {
+				t.Errorf("expected pending %q, got %q", tt.pending, pending)
+			}
+		})
+	}
+
+	t.Run("eof", func(t *testing.T) {
+		if _, _, err := search(t, "", 'r', 'u'); !errors.Is(err, io.EOF) {
+			t.Errorf("expected %v, got %v", io.EOF, err)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errAliasTarget = errors.New("an alias can't point to another alias")
+	errAliasModel  = errors.New("a model with that name already exists")
+	errAliased     = errors.New("model is used by aliases")
+)
+
+// modelAlias is a name which points to another model. Aliases are kept in
+// the aliases directory of the model store, separate from manifests, so
+// switching one to another model is a single rename.
+type modelAlias struct {
+	Target string `json:"target"`
+
+	modTime time.Time
+}
+
+func aliasPath(n model.Name) string {
+	return findInStores("aliases", n.Filepath())
+}
+
+// readAlias returns the model the alias n points to
+func readAlias(n model.Name) (model.Name, error) {
+	if !n.IsFullyQualified() {
+		return model.Name{}, model.Unqualified(n)
+	}
+
+	bts, err := os.ReadFile(aliasPath(n))
+	if err != nil {
+		return model.Name{}, err
+	}
+
+	var a modelAlias
+	if err := json.Unmarshal(bts, &a); err != nil {
+		return model.Name{}, err
+	}
+
+	target := model.ParseName(a.Target)
+	if !target.IsFullyQualified() {
+		return model.Name{}, model.Unqualified(target)
+	}
+
+	return target, nil
+}
+
+// resolveAlias returns the model the alias n points to if there's no model
+// named n, and whether n is an alias
+func resolveAlias(n model.Name) (model.Name, bool) {
+	if _, err := os.Stat(findInStores("manifests", n.Filepath())); errors.Is(err, os.ErrNotExist) {
+		if target, err := readAlias(n); err == nil {
+			return target, true
+		}
+	}
+
+	return n, false
+}
+
+// resolveManifestPath returns the path of the manifest of n, or of the model
+// it points to if it's an alias
+func resolveManifestPath(n model.Name) string {
+	n, _ = resolveAlias(n)
+	return findInStores("manifests", n.Filepath())
+}
+
+// setAlias points the alias n to target, replacing what it pointed to
+func setAlias(n, target model.Name) error {
+	if !n.IsFullyQualified() {
+		return model.Unqualified(n)
+	}
+
+	if _, err := os.Stat(findInStores("manifests", n.Filepath())); err == nil {
+		return fmt.Errorf("%w: %s", errAliasModel, n.DisplayShortest())
+	}
+
+	if _, err := readAlias(target); err == nil {
+		return errAliasTarget
+	}
+
+	if _, err := ParseNamedManifest(target); err != nil {
+		return err
+	}
+
+	// an alias in a base model store is overridden rather than changed
+	p := aliasPath(n)
+	if isBaseStore(p) {
+		p = filepath.Join(envconfig.Models(), "aliases", n.Filepath())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(modelAlias{Target: target.String()})
+	if err != nil {
+		return err
+	}
+
+	// the temporary file isn't a valid name so it's never listed
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(bts); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+// removeAlias removes the alias n, leaving the model it points to
+func removeAlias(n model.Name) error {
+	p := aliasPath(n)
+	if isBaseStore(p) {
+		return errReadOnlyStore
+	}
+
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+
+	return PruneDirectory(filepath.Join(storeOf(p), "aliases"))
+}
+
+// aliases returns every alias and the model it points to
+func aliases() (map[model.Name]*modelAlias, error) {
+	as := make(map[model.Name]*modelAlias)
+	for _, store := range allStores() {
+		matches, err := filepath.Glob(filepath.Join(store, "aliases", "*", "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			rel, err := filepath.Rel(filepath.Join(store, "aliases"), match)
+			if err != nil {
+				continue
+			}
+
+			n := model.ParseNameFromFilepath(rel)
+			if !n.IsValid() {
+				continue
+			}
+
+			if _, ok := as[n]; ok {
+				continue
+			}
+
+			fi, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+
+			target, err := readAlias(n)
+			if err != nil {
+				slog.Warn("bad alias", "path", match, "error", err)
+				continue
+			}
+
+			as[n] = &modelAlias{Target: target.String(), modTime: fi.ModTime()}
+		}
+	}
+
+	return as, nil
+}
+
+// aliasesOf returns the aliases which point to n, leaving out those hidden by
+// a model
+func aliasesOf(n model.Name) ([]string, error) {
+	as, err := aliases()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for alias := range as {
+		if target, ok := resolveAlias(alias); ok && strings.EqualFold(target.String(), n.String()) {
+			names = append(names, alias.DisplayShortest())
+		}
+	}
+
+	slices.Sort(names)
+	return names, nil
+}
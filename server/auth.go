@@ -7,8 +7,10 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -20,6 +22,9 @@ import (
 )
 
 type registryChallenge struct {
+	// Scheme is the authentication scheme the registry expects, either
+	// "basic" or "bearer"
+	Scheme  string
 	Realm   string
 	Service string
 	Scope   string
@@ -93,3 +98,132 @@ func getAuthorizationToken(ctx context.Context, challenge registryChallenge) (st
 
 	return token.Token, nil
 }
+
+// tokenURL returns the URL a token is requested from with credentials
+func (r registryChallenge) tokenURL() (*url.URL, error) {
+	tokenURL, err := url.Parse(r.Realm)
+	if err != nil {
+		return nil, err
+	}
+
+	values := tokenURL.Query()
+	if r.Service != "" {
+		values.Add("service", r.Service)
+	}
+
+	for _, s := range strings.Fields(r.Scope) {
+		values.Add("scope", s)
+	}
+
+	tokenURL.RawQuery = values.Encode()
+	return tokenURL, nil
+}
+
+// getCredentialsToken requests a token for the challenge, authenticating with
+// the username and password in regOpts. Identity tokens are exchanged for an
+// access token with the OAuth2 refresh token grant.
+func getCredentialsToken(ctx context.Context, challenge registryChallenge, regOpts *registryOptions) (string, error) {
+	tokenURL, err := challenge.tokenURL()
+	if err != nil {
+		return "", err
+	}
+
+	var response *http.Response
+	if regOpts.Username == identityTokenUsername {
+		values := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {regOpts.Password},
+			"client_id":     {"ollama"},
+			"service":       {challenge.Service},
+			"scope":         {challenge.Scope},
+		}
+
+		tokenURL.RawQuery = ""
+
+		headers := make(http.Header)
+		headers.Set("Content-Type", "application/x-www-form-urlencoded")
+		response, err = makeRequest(ctx, http.MethodPost, tokenURL, headers, strings.NewReader(values.Encode()), &registryOptions{Transport: regOpts.Transport})
+	} else {
+		response, err = makeRequest(ctx, http.MethodGet, tokenURL, nil, nil, &registryOptions{
+			Username:  regOpts.Username,
+			Password:  regOpts.Password,
+			Transport: regOpts.Transport,
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(response.Body)
+		return "", fmt.Errorf("%d: %s", response.StatusCode, body)
+	}
+
+	// docker token servers respond with token while OAuth2 servers respond
+	// with access_token
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	if token.Token == "" {
+		return "", errors.New("no token in response")
+	}
+
+	return token.Token, nil
+}
+
+// authorize updates regOpts to answer the challenge of a registry which
+// responded to requestURL with 401. Registries with stored credentials, or
+// credentials in regOpts, are authenticated with them. Otherwise a token is
+// requested with a signature from the ollama key.
+func authorize(ctx context.Context, requestURL *url.URL, challenge registryChallenge, regOpts *registryOptions) error {
+	if regOpts.Username == "" {
+		username, password, err := getCredentials(requestURL.Host)
+		switch {
+		case errors.Is(err, errCredentialsNotFound):
+		case err != nil:
+			// a broken credential helper shouldn't prevent requesting a token
+			// with the ollama key
+			slog.Warn("couldn't get registry credentials", "host", requestURL.Host, "error", err)
+		default:
+			regOpts.Username, regOpts.Password = username, password
+		}
+	}
+
+	switch {
+	case challenge.Scheme == "basic":
+		if regOpts.Username == "" {
+			return fmt.Errorf("%w: no credentials for %s, run `ollama login %s`", errUnauthorized, requestURL.Host, requestURL.Host)
+		}
+
+		// the request is retried with basic auth
+		regOpts.Token = ""
+		return nil
+	case regOpts.Username != "":
+		token, err := getCredentialsToken(ctx, challenge, regOpts)
+		if err != nil {
+			return err
+		}
+
+		regOpts.Token = token
+		return nil
+	default:
+		token, err := getAuthorizationToken(ctx, challenge)
+		if err != nil {
+			return err
+		}
+
+		regOpts.Token = token
+		return nil
+	}
+}
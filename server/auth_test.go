@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseRegistryChallenge(t *testing.T) {
+	cases := []struct {
+		header string
+		want   registryChallenge
+	}{
+		{
+			`Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:user/model:pull"`,
+			registryChallenge{Scheme: "bearer", Realm: "https://ghcr.io/token", Service: "ghcr.io", Scope: "repository:user/model:pull"},
+		},
+		{
+			`Basic realm="registry"`,
+			registryChallenge{Scheme: "basic", Realm: "registry"},
+		},
+	}
+
+	for _, tt := range cases {
+		if got := parseRegistryChallenge(tt.header); got != tt.want {
+			t.Errorf("expected %+v, got %+v", tt.want, got)
+		}
+	}
+}
+
+func TestAuthorizeCredentials(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	token := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" {
+				http.Error(w, "invalid grant", http.StatusBadRequest)
+				return
+			}
+
+			w.Write([]byte(`{"access_token":"access"}`)) //nolint:errcheck
+			return
+		}
+
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("scope") != "repository:library/test:pull" {
+			http.Error(w, "invalid scope", http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{"token":"access"}`)) //nolint:errcheck
+	}))
+	defer token.Close()
+
+	bearer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+token.URL+`",service="test",scope="repository:library/test:pull"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer bearer.Close()
+
+	basic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer basic.Close()
+
+	request := func(t *testing.T, s *httptest.Server) error {
+		t.Helper()
+
+		u, err := url.Parse(s.URL + "/v2/library/test/manifests/latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := makeRequestWithRetry(context.Background(), http.MethodGet, u, nil, nil, &registryOptions{})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		return nil
+	}
+
+	t.Run("basic without credentials", func(t *testing.T) {
+		if err := request(t, basic); !errors.Is(err, errUnauthorized) {
+			t.Errorf("expected unauthorized, got %v", err)
+		}
+	})
+
+	for _, s := range []*httptest.Server{bearer, basic} {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := storeCredentials(u.Host, "user", "pass"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("bearer", func(t *testing.T) {
+		if err := request(t, bearer); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("basic", func(t *testing.T) {
+		if err := request(t, basic); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("identity token", func(t *testing.T) {
+		u, err := url.Parse(bearer.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := storeCredentials(u.Host, identityTokenUsername, "refresh"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := request(t, bearer); err != nil {
+			t.Error(err)
+		}
+	})
+}
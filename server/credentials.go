@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var errCredentialsNotFound = errors.New("credentials not found")
+
+// identityTokenUsername is the username docker uses for credentials whose
+// password is an identity token, i.e. an OAuth2 refresh token
+const identityTokenUsername = "<token>"
+
+// dockerConfig is the subset of docker's config.json which holds registry
+// credentials. Credentials are stored in it by `ollama login` and `docker
+// login` alike.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths,omitempty"`
+
+	// CredsStore is the credential helper used for all registries unless
+	// overridden by CredHelpers
+	CredsStore  string            `json:"credsStore,omitempty"`
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+
+	// raw holds every field of the file so those ollama doesn't use are
+	// written back unchanged
+	raw map[string]json.RawMessage
+}
+
+type dockerAuth struct {
+	// Auth is the base64 encoded username:password
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+func dockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+func loadDockerConfig() (*dockerConfig, error) {
+	p, err := dockerConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return &dockerConfig{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	if err := json.Unmarshal(bts, &config.raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return &config, nil
+}
+
+func (c *dockerConfig) save() error {
+	p, err := dockerConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if c.raw == nil {
+		c.raw = make(map[string]json.RawMessage)
+	}
+
+	auths, err := json.Marshal(c.Auths)
+	if err != nil {
+		return err
+	}
+
+	c.raw["auths"] = auths
+
+	bts, err := json.MarshalIndent(c.raw, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a failed write doesn't lose the
+	// existing config
+	f, err := os.CreateTemp(filepath.Dir(p), "config.json-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(bts); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+// helper returns the name of the credential helper used for host, if any
+func (c *dockerConfig) helper(host string) string {
+	if helper, ok := c.CredHelpers[host]; ok {
+		return helper
+	}
+
+	return c.CredsStore
+}
+
+// auth returns the credentials stored in the config for host. Hosts may be
+// stored with or without a scheme.
+func (c *dockerConfig) auth(host string) (string, dockerAuth, bool) {
+	for key, auth := range c.Auths {
+		if parseRegistryHost(key) == host {
+			return key, auth, true
+		}
+	}
+
+	return "", dockerAuth{}, false
+}
+
+// parseRegistryHost returns the host of a registry given as a host or URL, e.g.
+// ghcr.io or https://ghcr.io/v2/
+func parseRegistryHost(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	host, _, _ := strings.Cut(s, "/")
+	return host
+}
+
+// credentialHelper runs the docker-credential-<name> binary with action,
+// passing it input on stdin
+func credentialHelper(name, action string, input []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+name, action)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// helpers report missing credentials on stdout
+		msg := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(strings.ToLower(msg), "credentials not found") {
+			return nil, errCredentialsNotFound
+		}
+
+		return nil, fmt.Errorf("docker-credential-%s %s: %w: %s", name, action, err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// helperCredentials is the format credential helpers read and write
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// getCredentials returns the username and password stored for the registry
+// at host. The username is identityTokenUsername if the password is an
+// identity token.
+func getCredentials(host string) (username, password string, err error) {
+	config, err := loadDockerConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	if helper := config.helper(host); helper != "" {
+		out, err := credentialHelper(helper, "get", []byte(host))
+		if err != nil {
+			return "", "", err
+		}
+
+		var creds helperCredentials
+		if err := json.Unmarshal(out, &creds); err != nil {
+			return "", "", fmt.Errorf("docker-credential-%s: %w", helper, err)
+		}
+
+		return creds.Username, creds.Secret, nil
+	}
+
+	_, auth, ok := config.auth(host)
+	switch {
+	case !ok:
+		return "", "", errCredentialsNotFound
+	case auth.IdentityToken != "":
+		return identityTokenUsername, auth.IdentityToken, nil
+	}
+
+	bts, err := base64.StdEncoding.DecodeString(auth.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid credentials for %s: %w", host, err)
+	}
+
+	username, password, ok = strings.Cut(string(bts), ":")
+	if !ok {
+		return "", "", fmt.Errorf("invalid credentials for %s", host)
+	}
+
+	return username, password, nil
+}
+
+// storeCredentials stores credentials for the registry at host with its
+// credential helper or, without one, in the docker config
+func storeCredentials(host, username, password string) error {
+	config, err := loadDockerConfig()
+	if err != nil {
+		return err
+	}
+
+	if helper := config.helper(host); helper != "" {
+		bts, err := json.Marshal(helperCredentials{ServerURL: host, Username: username, Secret: password})
+		if err != nil {
+			return err
+		}
+
+		_, err = credentialHelper(helper, "store", bts)
+		return err
+	}
+
+	if key, _, ok := config.auth(host); ok {
+		delete(config.Auths, key)
+	}
+
+	if config.Auths == nil {
+		config.Auths = make(map[string]dockerAuth)
+	}
+
+	config.Auths[host] = dockerAuth{Auth: base64.StdEncoding.EncodeToString([]byte(username + ":" + password))}
+	return config.save()
+}
+
+// eraseCredentials removes the credentials stored for the registry at host.
+// It returns errCredentialsNotFound if there are none.
+func eraseCredentials(host string) error {
+	config, err := loadDockerConfig()
+	if err != nil {
+		return err
+	}
+
+	if helper := config.helper(host); helper != "" {
+		_, err := credentialHelper(helper, "erase", []byte(host))
+		return err
+	}
+
+	key, _, ok := config.auth(host)
+	if !ok {
+		return errCredentialsNotFound
+	}
+
+	delete(config.Auths, key)
+	return config.save()
+}
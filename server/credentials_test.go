@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCredentials(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	if _, _, err := getCredentials("ghcr.io"); !errors.Is(err, errCredentialsNotFound) {
+		t.Fatalf("expected credentials not found, got %v", err)
+	}
+
+	p, err := dockerConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, []byte(`{
+	"auths": {
+		"https://ghcr.io": {"auth": "dXNlcjpwYXNz"},
+		"registry.internal": {"identitytoken": "refresh"}
+	},
+	"currentContext": "desktop-linux"
+}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		host, username, password string
+	}{
+		{"ghcr.io", "user", "pass"},
+		{"registry.internal", identityTokenUsername, "refresh"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.host, func(t *testing.T) {
+			username, password, err := getCredentials(tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if username != tt.username || password != tt.password {
+				t.Errorf("expected %s:%s, got %s:%s", tt.username, tt.password, username, password)
+			}
+		})
+	}
+
+	t.Run("store", func(t *testing.T) {
+		if err := storeCredentials("ghcr.io", "other", "secret"); err != nil {
+			t.Fatal(err)
+		}
+
+		if username, password, err := getCredentials("ghcr.io"); err != nil {
+			t.Fatal(err)
+		} else if username != "other" || password != "secret" {
+			t.Errorf("expected other:secret, got %s:%s", username, password)
+		}
+
+		bts, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var config map[string]any
+		if err := json.Unmarshal(bts, &config); err != nil {
+			t.Fatal(err)
+		}
+
+		if config["currentContext"] != "desktop-linux" {
+			t.Errorf("expected unknown fields to be kept, got %s", bts)
+		}
+
+		if auths := config["auths"].(map[string]any); len(auths) != 2 {
+			t.Errorf("expected ghcr.io to be replaced, got %v", auths)
+		}
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		if err := eraseCredentials("ghcr.io"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := eraseCredentials("ghcr.io"); !errors.Is(err, errCredentialsNotFound) {
+			t.Errorf("expected credentials not found, got %v", err)
+		}
+	})
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper is a shell script")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	store := filepath.Join(dir, "store")
+	if err := os.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(`#!/bin/sh
+case "$1" in
+get)
+	read host
+	if [ "$host" = "ghcr.io" ]; then
+		echo '{"ServerURL":"ghcr.io","Username":"user","Secret":"pass"}'
+	else
+		echo "credentials not found in native keychain"
+		exit 1
+	fi
+	;;
+store)
+	cat > "`+store+`"
+	;;
+esac
+`), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"credsStore":"test"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if username, password, err := getCredentials("ghcr.io"); err != nil {
+		t.Fatal(err)
+	} else if username != "user" || password != "pass" {
+		t.Errorf("expected user:pass, got %s:%s", username, password)
+	}
+
+	if _, _, err := getCredentials("example.com"); !errors.Is(err, errCredentialsNotFound) {
+		t.Errorf("expected credentials not found, got %v", err)
+	}
+
+	if err := storeCredentials("example.com", "user", "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	bts, err := os.ReadFile(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(bts, &creds); err != nil {
+		t.Fatal(err)
+	}
+
+	if creds != (helperCredentials{ServerURL: "example.com", Username: "user", Secret: "pass"}) {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// modelParts are the parts of a model compared by diffModels
+type modelParts struct {
+	modelfile  string
+	template   string
+	system     string
+	parameters map[string]any
+	adapters   []string
+	layers     map[string][]string
+	modelInfo  map[string]any
+}
+
+func loadModelParts(name string) (*modelParts, error) {
+	m, err := GetModel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := ParseNamedManifest(model.ParseName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	p := modelParts{
+		modelfile:  m.String(),
+		system:     m.System,
+		parameters: m.Options,
+		layers:     make(map[string][]string),
+	}
+
+	if m.Template != nil {
+		p.template = m.Template.String()
+	}
+
+	for _, layer := range manifest.Layers {
+		p.layers[layer.MediaType] = append(p.layers[layer.MediaType], layer.Digest)
+		if layer.MediaType == "application/vnd.ollama.image.adapter" {
+			p.adapters = append(p.adapters, layer.Digest)
+		}
+	}
+
+	p.modelInfo, err = getKVData(m.ModelPath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// diffModels returns the changes from the model from to the model to
+func diffModels(from, to string) (*api.ModelDiff, error) {
+	a, err := loadModelParts(from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := loadModelParts(to)
+	if err != nil {
+		return nil, err
+	}
+
+	d := api.ModelDiff{Model: from, Changes: []api.ModelChange{}}
+
+	text := func(section, a, b string) {
+		if a != b {
+			d.Changes = append(d.Changes, api.ModelChange{Section: section, From: orNil(a), To: orNil(b)})
+		}
+	}
+
+	text("modelfile", a.modelfile, b.modelfile)
+	text("template", a.template, b.template)
+	text("system", a.system, b.system)
+	d.Changes = append(d.Changes, diffKeys("parameters", a.parameters, b.parameters)...)
+
+	if !slices.Equal(a.adapters, b.adapters) {
+		d.Changes = append(d.Changes, api.ModelChange{Section: "adapters", From: orNil(a.adapters), To: orNil(b.adapters)})
+	}
+
+	d.Changes = append(d.Changes, diffKeys("layers", a.layers, b.layers)...)
+	d.Changes = append(d.Changes, diffKeys("model_info", a.modelInfo, b.modelInfo)...)
+	return &d, nil
+}
+
+// diffKeys returns the changes to the values in a section keyed by name,
+// sorted by key
+func diffKeys[V any](section string, a, b map[string]V) []api.ModelChange {
+	var changes []api.ModelChange
+	for k, va := range a {
+		vb, ok := b[k]
+		switch {
+		case !ok:
+			changes = append(changes, api.ModelChange{Section: section, Key: k, From: va})
+		case !reflect.DeepEqual(va, vb):
+			changes = append(changes, api.ModelChange{Section: section, Key: k, From: va, To: vb})
+		}
+	}
+
+	for k, vb := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, api.ModelChange{Section: section, Key: k, To: vb})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b api.ModelChange) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+
+	return changes
+}
+
+// orNil returns nil for an empty value so it's left out of a change
+func orNil[V string | []string](v V) any {
+	if len(v) == 0 {
+		return nil
+	}
+
+	return v
+}
@@ -10,7 +10,6 @@ import (
 	"math"
 	"math/rand/v2"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -23,6 +22,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 )
 
@@ -35,6 +35,10 @@ var (
 
 var blobDownloadManager sync.Map
 
+// downloadRateLimiter limits the combined rate of all downloads to
+// OLLAMA_MAX_DOWNLOAD_RATE
+var downloadRateLimiter rateLimiter
+
 type blobDownload struct {
 	Name   string
 	Digest string
@@ -44,6 +48,10 @@ type blobDownload struct {
 
 	Parts []*blobDownloadPart
 
+	// limiter limits the rate of this download to the rate requested by
+	// the pull which started it, if any
+	limiter *rateLimiter
+
 	context.CancelFunc
 
 	done       chan struct{}
@@ -116,13 +124,95 @@ func (p *blobDownloadPart) StopsAt() int64 {
 func (p *blobDownloadPart) Write(b []byte) (n int, err error) {
 	n = len(b)
 	p.blobDownload.Completed.Add(int64(n))
+	p.touch(time.Now())
+	return n, nil
+}
+
+func (p *blobDownloadPart) touch(t time.Time) {
 	p.lastUpdatedMu.Lock()
-	p.lastUpdated = time.Now()
+	p.lastUpdated = t
 	p.lastUpdatedMu.Unlock()
-	return n, nil
 }
 
-func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *registryOptions) error {
+// rateLimiter limits the combined rate of reads from any number of
+// goroutines
+type rateLimiter struct {
+	// rate is in bytes per second. Zero is unlimited.
+	rate atomic.Int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	var l rateLimiter
+	l.rate.Store(rate)
+	return &l
+}
+
+// reserve returns the time at which a read of n bytes is within the rate
+func (l *rateLimiter) reserve(n int) time.Time {
+	now := time.Now()
+	rate := l.rate.Load()
+	if rate <= 0 {
+		return now
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	at := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	return at
+}
+
+// maxThrottledRead keeps reads small so throttled parts share the rate evenly
+const maxThrottledRead = 16 * format.KibiByte
+
+// throttledReader delays reads from r to keep within the rates of limiters
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	part     *blobDownloadPart
+	limiters []*rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+
+	n, err := t.r.Read(p)
+
+	var at time.Time
+	for _, l := range t.limiters {
+		if next := l.reserve(n); next.After(at) {
+			at = next
+		}
+	}
+
+	if d := time.Until(at); d > 0 {
+		// waiting for the limiter isn't a stall
+		t.part.touch(at)
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return n, err
+}
+
+func (b *blobDownload) Prepare(ctx context.Context, endpoints []registryEndpoint) error {
 	partFilePaths, err := filepath.Glob(b.Name + "-partial-*")
 	if err != nil {
 		return err
@@ -142,7 +232,9 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *r
 	}
 
 	if len(b.Parts) == 0 {
-		resp, err := makeRequestWithRetry(ctx, http.MethodHead, requestURL, nil, nil, opts)
+		resp, err := firstEndpoint(ctx, endpoints, func(e registryEndpoint) (*http.Response, error) {
+			return makeRequestWithRetry(ctx, http.MethodHead, e.url, nil, nil, e.regOpts)
+		})
 		if err != nil {
 			return err
 		}
@@ -176,9 +268,9 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *r
 	return nil
 }
 
-func (b *blobDownload) Run(ctx context.Context, requestURL *url.URL, opts *registryOptions) {
+func (b *blobDownload) Run(ctx context.Context, endpoints []registryEndpoint) {
 	defer close(b.done)
-	b.err = b.run(ctx, requestURL, opts)
+	b.err = b.run(ctx, endpoints)
 }
 
 func newBackoff(maxBackoff time.Duration) func(ctx context.Context) error {
@@ -207,7 +299,7 @@ func newBackoff(maxBackoff time.Duration) func(ctx context.Context) error {
 	}
 }
 
-func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *registryOptions) error {
+func (b *blobDownload) run(ctx context.Context, endpoints []registryEndpoint) error {
 	defer blobDownloadManager.Delete(b.Digest)
 	ctx, b.CancelFunc = context.WithCancel(ctx)
 
@@ -220,46 +312,65 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 
 	_ = file.Truncate(b.Total)
 
-	directURL, err := func() (*url.URL, error) {
+	direct, err := func() (registryEndpoint, error) {
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 
 		backoff := newBackoff(10 * time.Second)
 		for {
-			// shallow clone opts to be used in the closure
-			// without affecting the outer opts.
-			newOpts := new(registryOptions)
-			*newOpts = *opts
-
-			newOpts.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-				if len(via) > 10 {
-					return errors.New("maximum redirects exceeded (10) for directURL")
+			direct, err := firstEndpoint(ctx, endpoints, func(e registryEndpoint) (registryEndpoint, error) {
+				// shallow clone opts to be used in the closure
+				// without affecting the outer opts.
+				newOpts := new(registryOptions)
+				*newOpts = *e.regOpts
+
+				newOpts.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+					if len(via) > 10 {
+						return errors.New("maximum redirects exceeded (10) for directURL")
+					}
+
+					// if the hostname is the same, allow the redirect
+					if req.URL.Hostname() == e.url.Hostname() {
+						return nil
+					}
+
+					// stop at the first redirect that is not
+					// the same hostname as the original
+					// request.
+					return http.ErrUseLastResponse
 				}
 
-				// if the hostname is the same, allow the redirect
-				if req.URL.Hostname() == requestURL.Hostname() {
-					return nil
+				resp, err := makeRequestWithRetry(ctx, http.MethodGet, e.url, nil, nil, newOpts)
+				if err != nil {
+					return registryEndpoint{}, err
 				}
-
-				// stop at the first redirect that is not
-				// the same hostname as the original
-				// request.
-				return http.ErrUseLastResponse
-			}
-
-			resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, nil, nil, newOpts)
-			if err != nil {
-				slog.Warn("failed to get direct URL; backing off and retrying", "err", err)
-				if err := backoff(ctx); err != nil {
-					return nil, err
+				defer resp.Body.Close()
+
+				switch resp.StatusCode {
+				case http.StatusTemporaryRedirect:
+					directURL, err := resp.Location()
+					if err != nil {
+						return registryEndpoint{}, err
+					}
+
+					// the redirect is presigned so credentials aren't forwarded
+					return registryEndpoint{url: directURL, regOpts: &registryOptions{Transport: e.regOpts.Transport}}, nil
+				case http.StatusOK:
+					// the endpoint serves the blob itself, e.g. a pull-through cache
+					newOpts.CheckRedirect = nil
+					return registryEndpoint{url: e.url, regOpts: newOpts}, nil
+				default:
+					return registryEndpoint{}, fmt.Errorf("unexpected status code %d", resp.StatusCode)
 				}
-				continue
+			})
+			if err == nil || ctx.Err() != nil {
+				return direct, err
 			}
-			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusTemporaryRedirect {
-				return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+
+			slog.Warn("failed to get direct URL; backing off and retrying", "err", err)
+			if err := backoff(ctx); err != nil {
+				return registryEndpoint{}, err
 			}
-			return resp.Location()
 		}
 	}()
 	if err != nil {
@@ -278,7 +389,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 			var err error
 			for try := 0; try < maxRetries; try++ {
 				w := io.NewOffsetWriter(file, part.StartsAt())
-				err = b.downloadChunk(inner, directURL, w, part)
+				err = b.downloadChunk(inner, direct, w, part)
 				switch {
 				case errors.Is(err, context.Canceled), errors.Is(err, syscall.ENOSPC):
 					// return immediately if the context is canceled or the device is out of space
@@ -322,21 +433,31 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 	return nil
 }
 
-func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w io.Writer, part *blobDownloadPart) error {
+func (b *blobDownload) downloadChunk(ctx context.Context, e registryEndpoint, w io.Writer, part *blobDownloadPart) error {
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", part.StartsAt(), part.StopsAt()-1))
-		resp, err := http.DefaultClient.Do(req)
+		headers := make(http.Header)
+		headers.Set("Range", fmt.Sprintf("bytes=%d-%d", part.StartsAt(), part.StopsAt()-1))
+		resp, err := makeRequest(ctx, http.MethodGet, e.url, headers, nil, e.regOpts)
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
 
-		n, err := io.CopyN(w, io.TeeReader(resp.Body, part), part.Size-part.Completed.Load())
+		switch {
+		case resp.StatusCode == http.StatusPartialContent:
+		case resp.StatusCode == http.StatusOK && part.StartsAt() == 0:
+			// the range was ignored but the body starts at the part anyway
+		default:
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		var body io.Reader = resp.Body
+		if limiters := b.limiters(); len(limiters) > 0 {
+			body = &throttledReader{ctx: ctx, r: resp.Body, part: part, limiters: limiters}
+		}
+
+		n, err := io.CopyN(w, io.TeeReader(body, part), part.Size-part.Completed.Load())
 		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, io.ErrUnexpectedEOF) {
 			// rollback progress
 			b.Completed.Add(-n)
@@ -383,6 +504,20 @@ func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w
 	return g.Wait()
 }
 
+// limiters returns the rate limiters which apply to the download
+func (b *blobDownload) limiters() []*rateLimiter {
+	var limiters []*rateLimiter
+	if downloadRateLimiter.rate.Load() > 0 {
+		limiters = append(limiters, &downloadRateLimiter)
+	}
+
+	if b.limiter != nil {
+		limiters = append(limiters, b.limiter)
+	}
+
+	return limiters
+}
+
 func (b *blobDownload) newPart(offset, size int64) error {
 	part := blobDownloadPart{blobDownload: b, Offset: offset, Size: size, N: len(b.Parts)}
 	if err := b.writePart(part.Name(), &part); err != nil {
@@ -452,10 +587,17 @@ func (b *blobDownload) Wait(ctx context.Context, fn func(api.ProgressResponse))
 }
 
 type downloadOpts struct {
-	mp      ModelPath
-	digest  string
-	regOpts *registryOptions
-	fn      func(api.ProgressResponse)
+	mp        ModelPath
+	digest    string
+	endpoints []registryEndpoint
+	fn        func(api.ProgressResponse)
+
+	// maxRate is the maximum rate of the download in bytes per second
+	maxRate int64
+
+	// store is the model store the blob is downloaded to if it isn't in
+	// any store
+	store string
 }
 
 // downloadBlob downloads a blob from the registry and stores it in the blobs directory
@@ -468,6 +610,11 @@ func downloadBlob(ctx context.Context, opts downloadOpts) (cacheHit bool, _ erro
 	fi, err := os.Stat(fp)
 	switch {
 	case errors.Is(err, os.ErrNotExist):
+		if opts.store != "" {
+			if fp, err = storeBlobsPath(opts.store, opts.digest); err != nil {
+				return false, err
+			}
+		}
 	case err != nil:
 		return false, err
 	default:
@@ -481,18 +628,30 @@ func downloadBlob(ctx context.Context, opts downloadOpts) (cacheHit bool, _ erro
 		return true, nil
 	}
 
-	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest})
+	downloadRateLimiter.rate.Store(envconfig.MaxDownloadRate())
+
+	// a download shared by several pulls is limited to the rate of the
+	// pull which started it
+	var limiter *rateLimiter
+	if opts.maxRate > 0 {
+		limiter = newRateLimiter(opts.maxRate)
+	}
+
+	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest, limiter: limiter})
 	download := data.(*blobDownload)
 	if !ok {
-		requestURL := opts.mp.BaseURL()
-		requestURL = requestURL.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest)
-		if err := download.Prepare(ctx, requestURL, opts.regOpts); err != nil {
+		endpoints := make([]registryEndpoint, len(opts.endpoints))
+		for i, e := range opts.endpoints {
+			endpoints[i] = e.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest)
+		}
+
+		if err := download.Prepare(ctx, endpoints); err != nil {
 			blobDownloadManager.Delete(opts.digest)
 			return false, err
 		}
 
 		//nolint:contextcheck
-		go download.Run(context.Background(), requestURL, opts.regOpts)
+		go download.Run(context.Background(), endpoints)
 	}
 
 	return false, download.Wait(ctx, opts.fn)
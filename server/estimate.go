@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/gpu"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+// estimate estimates the memory m needs with opts, choosing the GPUs and the
+// number of parallel requests as the scheduler does when it loads the model
+// first. numParallel <= 0 lets the number of parallel requests be picked by
+// the free memory. It returns nil if there are no GPUs.
+func (s *Server) estimate(m *Model, ggml *llm.GGML, opts api.Options, numParallel int) *api.MemoryEstimate {
+	gpus := s.sched.getGpuFn()
+	if opts.NumGPU == 0 {
+		gpus = s.sched.getCpuFn()
+	}
+
+	if len(gpus) == 0 {
+		return nil
+	}
+
+	kv := ggml.KV()
+
+	// multimodal and embedding models are always loaded with parallel=1
+	if _, ok := kv[fmt.Sprintf("%s.pooling_type", kv.Architecture())]; ok || len(m.ProjectorPaths) > 0 {
+		numParallel = 1
+	}
+
+	req := &LlmRequest{model: m, opts: opts, origNumCtx: opts.NumCtx}
+
+	cpu := len(gpus) == 1 && gpus[0].Library == "cpu"
+	if cpu {
+		if numParallel <= 0 {
+			numParallel = defaultParallel
+		}
+
+		req.opts.NumCtx = req.origNumCtx * numParallel
+	} else if g := pickBestFullFitByLibrary(req, ggml, gpus, &numParallel); g != nil {
+		gpus = g
+	} else {
+		gpus = pickBestPartialFitByLibrary(req, ggml, gpus, &numParallel)
+	}
+
+	e := llm.EstimateGPULayers(gpus, ggml, m.ProjectorPaths, req.opts)
+
+	// the model is loaded on the CPU if none of its layers fit on the GPUs
+	if !cpu && gpus[0].Library != "metal" && e.Layers == 0 {
+		gpus, cpu = s.sched.getCpuFn(), true
+		e = llm.EstimateGPULayers(gpus, ggml, m.ProjectorPaths, req.opts)
+	}
+
+	estimate := api.MemoryEstimate{
+		Library:     gpus[0].Library,
+		NumCtx:      req.origNumCtx,
+		NumParallel: numParallel,
+		Layers:      e.Layers,
+		TotalLayers: int(kv.BlockCount()) + 1,
+		Graph:       e.Graph,
+		KVSize:      e.KV,
+		VRAMSize:    e.VRAMSize,
+		TotalSize:   e.TotalSize,
+	}
+
+	if !cpu && e.Layers > 0 {
+		split := strings.Split(e.TensorSplit, ",")
+		for i, g := range gpus {
+			a := api.GPUAllocation{ID: g.ID, Name: g.Name, FreeMemory: g.FreeMemory}
+			if i < len(e.GPUSizes) {
+				a.Size = e.GPUSizes[i]
+			}
+
+			if len(gpus) == 1 {
+				a.Layers = e.Layers
+			} else if i < len(split) {
+				a.Layers, _ = strconv.Atoi(split[i])
+			}
+
+			estimate.GPUs = append(estimate.GPUs, a)
+		}
+	}
+
+	// the largest context length which fits is searched for up to the
+	// length the model was trained with
+	fits := func(numCtx int) bool {
+		opts := opts
+		opts.NumCtx = numCtx * numParallel
+		if cpu {
+			return llm.EstimateGPULayers(gpus, ggml, m.ProjectorPaths, opts).TotalSize <= gpus[0].FreeMemory
+		}
+
+		return fitsFully(s.sched.getGpuFn(), ggml, m, opts)
+	}
+
+	estimate.MaxNumCtx = sort.Search(max(int(kv.ContextLength()), req.origNumCtx), func(n int) bool {
+		return !fits(n + 1)
+	})
+
+	return &estimate
+}
+
+// fitsFully reports whether the model fits fully on a single GPU or all the
+// GPUs of a library, like pickBestFullFitByLibrary but without picking the
+// number of parallel requests
+func fitsFully(gpus gpu.GpuInfoList, ggml *llm.GGML, m *Model, opts api.Options) bool {
+	if !envconfig.SchedSpread() {
+		for _, g := range gpus {
+			if ok, _ := llm.PredictServerFit(gpu.GpuInfoList{g}, ggml, m.AdapterPaths, m.ProjectorPaths, opts); ok {
+				return true
+			}
+		}
+	}
+
+	ok, _ := llm.PredictServerFit(gpus, ggml, m.AdapterPaths, m.ProjectorPaths, opts)
+	return ok
+}
+
+func (s *Server) EstimateHandler(c *gin.Context) {
+	var req api.EstimateRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	if !model.ParseName(req.Model).IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model name %q is invalid", req.Model)})
+		return
+	}
+
+	m, err := GetModel(req.Model)
+	if errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found, try pulling it first", req.Model)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts, err := modelOptions(m, req.Options)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ggml, err := llm.LoadModel(m.ModelPath, 0)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	numParallel := req.NumParallel
+	if numParallel <= 0 {
+		numParallel = int(envconfig.NumParallel())
+	}
+
+	estimate := s.estimate(m, ggml, opts, numParallel)
+	if estimate == nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "no GPUs or system memory found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.EstimateResponse{Model: req.Model, MemoryEstimate: *estimate})
+}
@@ -55,7 +55,17 @@ type registryOptions struct {
 	Password string
 	Token    string
 
+	// Sign pushes a signature of the manifest along with it
+	Sign bool
+
+	// MaxRate is the maximum rate of a pull in bytes per second
+	MaxRate int64
+
+	// Store is the model store a pull is written to
+	Store string
+
 	CheckRedirect func(req *http.Request, via []*http.Request) error
+	Transport     http.RoundTripper
 }
 
 type Model struct {
@@ -157,8 +167,15 @@ func (m *Model) String() string {
 		})
 	}
 
-	for k, v := range m.Options {
-		switch v := v.(type) {
+	// parameters are sorted so the Modelfile is the same each time
+	params := make([]string, 0, len(m.Options))
+	for k := range m.Options {
+		params = append(params, k)
+	}
+	slices.Sort(params)
+
+	for _, k := range params {
+		switch v := m.Options[k].(type) {
 		case []any:
 			for _, s := range v {
 				modelfile.Commands = append(modelfile.Commands, parser.Command{
@@ -188,6 +205,19 @@ func (m *Model) String() string {
 		})
 	}
 
+	keys := make([]string, 0, len(m.Config.Labels))
+	for k := range m.Config.Labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		modelfile.Commands = append(modelfile.Commands, parser.Command{
+			Name: "label",
+			Args: fmt.Sprintf("%s=%s", k, m.Config.Labels[k]),
+		})
+	}
+
 	return modelfile.String()
 }
 
@@ -198,6 +228,9 @@ type ConfigV2 struct {
 	ModelType     string   `json:"model_type"`
 	FileType      string   `json:"file_type"`
 
+	// Labels are user defined key=value metadata, set with LABEL
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// required by spec
 	Architecture string `json:"architecture"`
 	OS           string `json:"os"`
@@ -215,6 +248,10 @@ func GetManifest(mp ModelPath) (*Manifest, string, error) {
 		return nil, "", err
 	}
 
+	if n := model.ParseName(mp.GetFullTagname()); n.IsFullyQualified() {
+		fp = resolveManifestPath(n)
+	}
+
 	f, err := os.Open(fp)
 	if err != nil {
 		return nil, "", err
@@ -356,7 +393,7 @@ func realpath(rel, from string) string {
 	return abspath
 }
 
-func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantization string, modelfile *parser.File, fn func(resp api.ProgressResponse)) (err error) {
+func CreateModel(ctx context.Context, sched *Scheduler, name model.Name, modelFileDir, quantization, imatrix, calibration string, modelfile *parser.File, fn func(resp api.ProgressResponse)) (err error) {
 	config := ConfigV2{
 		OS:           "linux",
 		Architecture: "amd64",
@@ -368,6 +405,9 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 	var messages []*api.Message
 	parameters := make(map[string]any)
 
+	var baseLabels map[string]string
+	labels := make(map[string]string)
+
 	var layers []Layer
 	var baseLayers []*layerGGML
 	for _, c := range modelfile.Commands {
@@ -376,11 +416,26 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 
 		switch command {
 		case "model", "adapter":
+			// an importance matrix is computed from, and applied to, an F16
+			// model so safetensors aren't quantized while they're converted
+			streamQuantization := quantization
+			if imatrix != "" || calibration != "" {
+				streamQuantization = ""
+			}
+
 			if name := model.ParseName(c.Args); name.IsValid() && command == "model" {
 				baseLayers, err = parseFromModel(ctx, name, fn)
 				if err != nil {
 					return err
 				}
+
+				// labels are inherited from the base model
+				base, err := GetModel(name.String())
+				if err != nil {
+					return err
+				}
+
+				baseLabels = base.Config.Labels
 			} else if strings.HasPrefix(c.Args, "@") {
 				digest := strings.TrimPrefix(c.Args, "@")
 				if ib, ok := intermediateBlobs[digest]; ok {
@@ -410,14 +465,14 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 				}
 				defer blob.Close()
 
-				baseLayers, err = parseFromFile(ctx, command, baseLayers, blob, digest, fn)
+				baseLayers, err = parseFromFile(ctx, command, baseLayers, blob, digest, streamQuantization, fn)
 				if err != nil {
 					return err
 				}
 			} else if file, err := os.Open(realpath(modelFileDir, c.Args)); err == nil {
 				defer file.Close()
 
-				baseLayers, err = parseFromFile(ctx, command, baseLayers, file, "", fn)
+				baseLayers, err = parseFromFile(ctx, command, baseLayers, file, "", streamQuantization, fn)
 				if err != nil {
 					return err
 				}
@@ -425,7 +480,52 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 				return fmt.Errorf("invalid model reference: %s", c.Args)
 			}
 
+			// the importance matrix is kept as a layer so the model can be
+			// requantized the same way
+			var imatrixLayer *Layer
+			var im llm.Imatrix
+			if imatrix != "" {
+				imatrixLayer, im, err = imatrixFromBlob(imatrix)
+				if err != nil {
+					return err
+				}
+			} else if i := slices.IndexFunc(baseLayers, func(l *layerGGML) bool {
+				return l.MediaType == "application/vnd.ollama.image.imatrix"
+			}); i >= 0 && calibration == "" {
+				imatrixLayer, im, err = imatrixFromBlob(baseLayers[i].Digest)
+				if err != nil {
+					return err
+				}
+			}
+
 			for _, baseLayer := range baseLayers {
+				if baseLayer.MediaType == "application/vnd.ollama.image.imatrix" {
+					continue
+				}
+
+				if calibration != "" &&
+					baseLayer.MediaType == "application/vnd.ollama.image.model" &&
+					baseLayer.GGML != nil &&
+					baseLayer.GGML.Name() == "gguf" {
+					// the activations of a quantized model don't reflect the
+					// weights the importance matrix is applied to
+					if ft := baseLayer.GGML.KV().FileType(); !slices.Contains([]string{"F16", "F32"}, ft.String()) {
+						return fmt.Errorf("importance matrices can only be computed for F16 and F32 models, not %s", ft)
+					}
+
+					fn(api.ProgressResponse{Status: "computing importance matrix"})
+
+					blob, err := GetBlobsPath(baseLayer.Digest)
+					if err != nil {
+						return err
+					}
+
+					imatrixLayer, im, err = computeImatrix(ctx, sched, blob, calibration)
+					if err != nil {
+						return err
+					}
+				}
+
 				if quantization != "" &&
 					baseLayer.MediaType == "application/vnd.ollama.image.model" &&
 					baseLayer.GGML != nil &&
@@ -435,8 +535,9 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 						return err
 					}
 
+					// models converted from safetensors are already quantized
 					ft := baseLayer.GGML.KV().FileType()
-					if !slices.Contains([]string{"F16", "F32"}, ft.String()) {
+					if want != ft && !slices.Contains([]string{"F16", "F32"}, ft.String()) {
 						return errors.New("quantization is only supported for F16 and F32 models")
 					} else if want != ft {
 						fn(api.ProgressResponse{Status: fmt.Sprintf("quantizing %s model to %s", ft, quantization)})
@@ -453,7 +554,7 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 						defer temp.Close()
 						defer os.Remove(temp.Name())
 
-						if err := llm.Quantize(blob, temp.Name(), want); err != nil {
+						if err := llm.Quantize(blob, temp.Name(), want, im); err != nil {
 							return err
 						}
 
@@ -486,6 +587,10 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 
 				layers = append(layers, baseLayer.Layer)
 			}
+
+			if imatrixLayer != nil {
+				layers = append(layers, *imatrixLayer)
+			}
 		case "license", "template", "system":
 			if c.Name == "template" {
 				if _, err := template.Parse(c.Args); err != nil {
@@ -522,6 +627,13 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 			}
 
 			messages = append(messages, &api.Message{Role: role, Content: content})
+		case "label":
+			k, v, err := parseLabel(c.Args)
+			if err != nil {
+				return err
+			}
+
+			labels[k] = v
 		default:
 			ps, err := api.FormatParams(map[string][]string{c.Name: {c.Args}})
 			if err != nil {
@@ -615,6 +727,7 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 	}
 
 	config.RootFS.DiffIDs = digests
+	config.Labels = mergeLabels(baseLabels, labels)
 
 	var b bytes.Buffer
 	if err := json.NewEncoder(&b).Encode(config); err != nil {
@@ -657,21 +770,23 @@ func CopyModel(src, dst model.Name) error {
 		return model.Unqualified(src)
 	}
 
+	// copying an alias copies the model it points to
+	src, _ = resolveAlias(src)
 	if src.Filepath() == dst.Filepath() {
 		return nil
 	}
 
-	manifests, err := GetManifestPath()
-	if err != nil {
+	if _, err := GetManifestPath(); err != nil {
 		return err
 	}
 
-	dstpath := filepath.Join(manifests, dst.Filepath())
+	// the copy is made in the store of the source since its blobs are there
+	srcpath := findInStores("manifests", src.Filepath())
+	dstpath := filepath.Join(writableStoreOf(srcpath), "manifests", dst.Filepath())
 	if err := os.MkdirAll(filepath.Dir(dstpath), 0o755); err != nil {
 		return err
 	}
 
-	srcpath := filepath.Join(manifests, src.Filepath())
 	srcfile, err := os.Open(srcpath)
 	if err != nil {
 		return err
@@ -702,16 +817,30 @@ func deleteUnusedLayers(deleteMap map[string]struct{}) error {
 		delete(deleteMap, manifest.Config.Digest)
 	}
 
+	// layers of pulls which haven't finished are kept so they can be resumed
+	records, err := pullRecords()
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		for _, layer := range record.Layers {
+			delete(deleteMap, layer.Digest)
+		}
+	}
+
 	// only delete the files which are still in the deleteMap
 	for k := range deleteMap {
-		fp, err := GetBlobsPath(k)
+		fps, err := blobPaths(k)
 		if err != nil {
 			slog.Info(fmt.Sprintf("couldn't get file path for '%s': %v", k, err))
 			continue
 		}
-		if err := os.Remove(fp); err != nil {
-			slog.Info(fmt.Sprintf("couldn't remove file '%s': %v", fp, err))
-			continue
+		for _, fp := range fps {
+			if err := os.Remove(fp); err != nil {
+				slog.Info(fmt.Sprintf("couldn't remove file '%s': %v", fp, err))
+				continue
+			}
 		}
 	}
 
@@ -725,22 +854,39 @@ func PruneLayers() error {
 		return err
 	}
 
-	blobs, err := os.ReadDir(p)
+	blobs, err := storeGlob("*")
 	if err != nil {
 		slog.Info(fmt.Sprintf("couldn't read dir '%s': %v", p, err))
 		return err
 	}
 
+	records, err := pullRecords()
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool)
+	for _, record := range records {
+		for _, layer := range record.Layers {
+			pending[layer.Digest] = true
+		}
+	}
+
 	for _, blob := range blobs {
-		name := blob.Name()
+		name := filepath.Base(blob)
 		name = strings.ReplaceAll(name, "-", ":")
 
 		_, err := GetBlobsPath(name)
 		if err != nil {
+			if digest, _, ok := strings.Cut(name, ":partial"); ok && pending[digest] {
+				// keep partial downloads of pulls which will be resumed
+				continue
+			}
+
 			if errors.Is(err, ErrInvalidDigestFormat) {
 				// remove invalid blobs (e.g. partial downloads)
-				if err := os.Remove(filepath.Join(p, blob.Name())); err != nil {
-					slog.Error("couldn't remove blob", "blob", blob.Name(), "error", err)
+				if err := os.Remove(blob); err != nil {
+					slog.Error("couldn't remove blob", "blob", blob, "error", err)
 				}
 			}
 
@@ -839,12 +985,19 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	}
 	defer resp.Body.Close()
 
+	if regOpts.Sign {
+		fn(api.ProgressResponse{Status: "pushing signature"})
+		if err := pushSignature(ctx, mp, fmt.Sprintf("sha256:%x", sha256.Sum256(manifestJSON)), regOpts, fn); err != nil {
+			return err
+		}
+	}
+
 	fn(api.ProgressResponse{Status: "success"})
 
 	return nil
 }
 
-func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) (err error) {
 	mp := ParseModelPath(name)
 
 	// build deleteMap to prune unused layers
@@ -867,26 +1020,66 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return errors.New("insecure protocol http")
 	}
 
+	endpoints, err := pullEndpoints(mp, regOpts)
+	if err != nil {
+		return err
+	}
+
+	store, err := pullStore(mp, regOpts.Store)
+	if err != nil {
+		return err
+	}
+
+	// the pull is recorded until it completes so it can be listed and
+	// resumed if it's interrupted
+	record := pullRecord{Model: name, Insecure: regOpts.Insecure, MaxRate: regOpts.MaxRate, Store: regOpts.Store}
+	if err := record.save(mp); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err == nil || ctx.Err() == nil {
+			if err := removePullRecord(mp); err != nil {
+				slog.Warn("couldn't remove pull record", "model", name, "error", err)
+			}
+		}
+	}()
+
 	fn(api.ProgressResponse{Status: "pulling manifest"})
 
-	manifest, err = pullModelManifest(ctx, mp, regOpts)
+	manifest, err = firstEndpoint(ctx, endpoints, func(e registryEndpoint) (*Manifest, error) {
+		return pullModelManifest(ctx, mp, e)
+	})
 	if err != nil {
 		return fmt.Errorf("pull model manifest: %s", err)
 	}
 
+	// the manifest is verified before its layers are pulled so a model which
+	// fails verification is never written
+	if err := verifyManifestSignature(ctx, mp, endpoints, "sha256:"+manifest.digest, fn); err != nil {
+		return err
+	}
+
 	var layers []Layer
 	layers = append(layers, manifest.Layers...)
 	if manifest.Config.Digest != "" {
 		layers = append(layers, manifest.Config)
 	}
 
+	record.Layers = layers
+	if err := record.save(mp); err != nil {
+		return err
+	}
+
 	skipVerify := make(map[string]bool)
 	for _, layer := range layers {
 		cacheHit, err := downloadBlob(ctx, downloadOpts{
-			mp:      mp,
-			digest:  layer.Digest,
-			regOpts: regOpts,
-			fn:      fn,
+			mp:        mp,
+			digest:    layer.Digest,
+			endpoints: endpoints,
+			fn:        fn,
+			maxRate:   regOpts.MaxRate,
+			store:     store,
 		})
 		if err != nil {
 			return err
@@ -924,7 +1117,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return err
 	}
 
-	fp, err := mp.GetManifestPath()
+	fp, err := mp.manifestPathIn(store)
 	if err != nil {
 		return err
 	}
@@ -938,6 +1131,13 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		return err
 	}
 
+	// a model pulled to another store is moved there
+	if old, err := mp.GetManifestPath(); err == nil && old != fp && !isBaseStore(old) {
+		if err := os.Remove(old); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
 	if !envconfig.NoPrune() && len(deleteMap) > 0 {
 		fn(api.ProgressResponse{Status: "removing unused layers"})
 		if err := deleteUnusedLayers(deleteMap); err != nil {
@@ -950,23 +1150,36 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	return nil
 }
 
-func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *registryOptions) (*Manifest, error) {
-	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
+func pullModelManifest(ctx context.Context, mp ModelPath, e registryEndpoint) (*Manifest, error) {
+	requestURL := e.url.JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
 
 	headers := make(http.Header)
 	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
+	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, e.regOpts)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	// the manifest is hashed exactly as it was sent so it can be checked
+	// against its signature
+	bts, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bts) > maxManifestSize {
+		return nil, fmt.Errorf("manifest is larger than %d bytes", maxManifestSize)
+	}
+
 	var m Manifest
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+	if err := json.Unmarshal(bts, &m); err != nil {
 		return nil, err
 	}
 
-	return &m, err
+	sha256sum := sha256.Sum256(bts)
+	m.digest = hex.EncodeToString(sha256sum[:])
+	return &m, nil
 }
 
 // GetSHA256Digest returns the SHA256 hash of a given buffer and returns it, and the size of buffer
@@ -1027,12 +1240,10 @@ func makeRequestWithRetry(ctx context.Context, method string, requestURL *url.UR
 		case resp.StatusCode == http.StatusUnauthorized:
 			// Handle authentication error with one retry
 			challenge := parseRegistryChallenge(resp.Header.Get("www-authenticate"))
-			token, err := getAuthorizationToken(ctx, challenge)
-			if err != nil {
+			if err := authorize(ctx, requestURL, challenge, regOpts); err != nil {
 				return nil, err
 			}
-			anonymous = getTokenSubject(token) == "anonymous"
-			regOpts.Token = token
+			anonymous = regOpts.Username == "" && getTokenSubject(regOpts.Token) == "anonymous"
 			if body != nil {
 				_, err = body.Seek(0, io.SeekStart)
 				if err != nil {
@@ -1100,6 +1311,7 @@ func makeRequest(ctx context.Context, method string, requestURL *url.URL, header
 
 	resp, err := (&http.Client{
 		CheckRedirect: regOpts.CheckRedirect,
+		Transport:     regOpts.Transport,
 	}).Do(req)
 	if err != nil {
 		return nil, err
@@ -1132,9 +1344,10 @@ func getValue(header, key string) string {
 }
 
 func parseRegistryChallenge(authStr string) registryChallenge {
-	authStr = strings.TrimPrefix(authStr, "Bearer ")
+	scheme, _, _ := strings.Cut(authStr, " ")
 
 	return registryChallenge{
+		Scheme:  strings.ToLower(scheme),
 		Realm:   getValue(authStr, "realm"),
 		Service: getValue(authStr, "service"),
 		Scope:   getValue(authStr, "scope"),
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/convert"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/template"
+)
+
+var errUnknownModelFormat = errors.New("path must be the absolute path of a GGUF file or a safetensors model directory")
+
+// inspectModel decodes the GGUF file or safetensors model directory at path.
+// A safetensors model is returned as it will be once it's converted.
+func inspectModel(path string, verbose bool) (*llm.GGML, string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if fi.IsDir() {
+		ggml, err := convert.InspectModel(os.DirFS(path))
+		if err != nil {
+			return nil, "", err
+		}
+
+		// arrays such as the vocabulary are left out unless verbose, as they
+		// are when a GGUF file is decoded
+		if !verbose {
+			kv := ggml.KV()
+			for k, v := range kv {
+				if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.Len() > 1024 {
+					kv[k] = []any{}
+				}
+			}
+		}
+
+		return ggml, "safetensors", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, "", errUnknownModelFormat
+	}
+
+	if format := llm.DetectGGMLType(b); format != "gguf" && format != "ggla" {
+		return nil, "", errUnknownModelFormat
+	}
+
+	maxArraySize := 0
+	if verbose {
+		maxArraySize = -1
+	}
+
+	ggml, err := llm.LoadModel(path, maxArraySize)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ggml, ggml.Name(), nil
+}
+
+func (s *Server) InspectHandler(c *gin.Context) {
+	var req api.InspectRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the path is opened by the server, so only clients on the same machine
+	// can inspect files
+	if addr, err := netip.ParseAddrPort(c.Request.RemoteAddr); err != nil || !addr.Addr().IsLoopback() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "models can only be inspected on the machine running the server"})
+		return
+	}
+
+	if req.Path == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+
+	opts := api.DefaultOptions()
+	if err := opts.FromMap(req.Options); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ggml *llm.GGML
+	var format string
+	err := errUnknownModelFormat
+	if filepath.IsAbs(req.Path) {
+		ggml, format, err = inspectModel(req.Path, req.Verbose)
+	}
+
+	if err != nil {
+		// every failure is reported the same way so the response doesn't
+		// reveal which files exist on the server
+		slog.Debug("couldn't inspect model", "path", req.Path, "error", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errUnknownModelFormat.Error()})
+		return
+	}
+
+	kv := ggml.KV()
+	resp := api.InspectResponse{
+		Format:         format,
+		ParameterCount: kv.ParameterCount(),
+		ModelInfo:      kv,
+		Tensors:        []api.TensorInfo{},
+	}
+
+	for _, t := range ggml.Tensors().Items {
+		resp.Tensors = append(resp.Tensors, api.TensorInfo{Name: t.Name, Type: t.Type(), Shape: t.Shape})
+	}
+
+	if ct := kv.ChatTemplate(); ct != "" {
+		if t, err := template.Named(ct); err == nil {
+			resp.TemplateName = t.Name
+			resp.Template = string(t.Bytes)
+		}
+	}
+
+	// adapters and projectors aren't run on their own
+	if kv.BlockCount() > 0 && kv.Kind() != "adapter" {
+		resp.Memory = s.estimate(&Model{ModelPath: req.Path}, ggml, opts, int(envconfig.NumParallel()))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
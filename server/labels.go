@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errInvalidLabel  = errors.New("label must be of the form key=value")
+	errInvalidFilter = errors.New("filter must be one of \"label=key\", \"label=key=value\", \"architecture=\", \"family=\", \"format=\" or \"quantization=\"")
+)
+
+// parseLabel parses a label of the form key=value. The value may be quoted.
+func parseLabel(s string) (string, string, error) {
+	k, v, ok := strings.Cut(s, "=")
+	if k = strings.TrimSpace(k); !ok || k == "" || strings.ContainsAny(k, " \t\n") {
+		return "", "", fmt.Errorf("%w: %q", errInvalidLabel, s)
+	}
+
+	v = strings.TrimSpace(v)
+	if unquoted, err := strconv.Unquote(v); err == nil {
+		v = unquoted
+	}
+
+	return k, v, nil
+}
+
+// mergeLabels returns labels with the labels of base it doesn't set. Labels
+// set to an empty value are removed.
+func mergeLabels(base, labels map[string]string) map[string]string {
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+
+	for k, v := range labels {
+		if v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	if len(merged) == 0 {
+		return nil
+	}
+
+	return merged
+}
+
+// setLabels sets the labels of the model n, removing those set to an empty
+// value. The model's config is rewritten so its digest changes.
+func setLabels(n model.Name, labels map[string]string) error {
+	for k := range labels {
+		if _, _, err := parseLabel(k + "="); err != nil {
+			return err
+		}
+	}
+
+	// the labels of an alias are those of the model it points to
+	n, _ = resolveAlias(n)
+
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		return err
+	}
+
+	var config ConfigV2
+	if m.Config.Digest != "" {
+		f, err := m.Config.Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := json.NewDecoder(f).Decode(&config); err != nil {
+			return err
+		}
+	}
+
+	config.Labels = mergeLabels(config.Labels, labels)
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(config); err != nil {
+		return err
+	}
+
+	configLayer, err := NewLayer(&b, "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		return err
+	}
+
+	if err := WriteManifest(n, configLayer, m.Layers); err != nil {
+		return err
+	}
+
+	return m.Config.Remove()
+}
+
+// listFilter is a filter of the models in /api/tags
+type listFilter struct {
+	field string
+	key   string
+	value string
+}
+
+// parseListFilters parses filters of the form field=value, or label=key and
+// label=key=value
+func parseListFilters(filters []string) ([]listFilter, error) {
+	var fs []listFilter
+	for _, s := range filters {
+		field, value, ok := strings.Cut(s, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidFilter, s)
+		}
+
+		f := listFilter{field: strings.ToLower(field), value: value}
+		switch f.field {
+		case "label":
+			f.key, f.value, _ = strings.Cut(value, "=")
+		case "architecture", "arch":
+			f.field = "architecture"
+		case "family", "format", "quantization":
+		default:
+			return nil, fmt.Errorf("%w: %q", errInvalidFilter, s)
+		}
+
+		fs = append(fs, f)
+	}
+
+	return fs, nil
+}
+
+// matchListFilters reports whether a model with details and labels matches
+// every filter
+func matchListFilters(filters []listFilter, details api.ModelDetails, labels map[string]string) bool {
+	for _, f := range filters {
+		var ok bool
+		switch f.field {
+		case "label":
+			var v string
+			v, ok = labels[f.key]
+			ok = ok && (f.value == "" || v == f.value)
+		case "architecture":
+			ok = strings.EqualFold(details.Family, f.value)
+		case "family":
+			ok = strings.EqualFold(details.Family, f.value) || slices.ContainsFunc(details.Families, func(s string) bool {
+				return strings.EqualFold(s, f.value)
+			})
+		case "format":
+			ok = strings.EqualFold(details.Format, f.value)
+		case "quantization":
+			ok = strings.EqualFold(details.QuantizationLevel, f.value)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -13,7 +13,9 @@ type Layer struct {
 	Digest    string `json:"digest"`
 	Size      int64  `json:"size"`
 	From      string `json:"from,omitempty"`
-	status    string
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+	status      string
 }
 
 func NewLayer(r io.Reader, mediatype string) (Layer, error) {
@@ -120,10 +122,30 @@ func (l *Layer) Remove() error {
 		}
 	}
 
-	blob, err := GetBlobsPath(l.Digest)
+	records, err := pullRecords()
 	if err != nil {
 		return err
 	}
 
-	return os.Remove(blob)
+	for _, record := range records {
+		for _, layer := range record.Layers {
+			if layer.Digest == l.Digest {
+				// a pull which hasn't finished is using this layer
+				return nil
+			}
+		}
+	}
+
+	blobs, err := blobPaths(l.Digest)
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range blobs {
+		if err := os.Remove(blob); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
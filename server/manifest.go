@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/types/model"
 )
 
@@ -34,16 +35,15 @@ func (m *Manifest) Size() (size int64) {
 }
 
 func (m *Manifest) Remove() error {
-	if err := os.Remove(m.filepath); err != nil {
-		return err
+	if isBaseStore(m.filepath) {
+		return errReadOnlyStore
 	}
 
-	manifests, err := GetManifestPath()
-	if err != nil {
+	if err := os.Remove(m.filepath); err != nil {
 		return err
 	}
 
-	return PruneDirectory(manifests)
+	return PruneDirectory(filepath.Join(storeOf(m.filepath), "manifests"))
 }
 
 func (m *Manifest) RemoveLayers() error {
@@ -65,12 +65,7 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 		return nil, model.Unqualified(n)
 	}
 
-	manifests, err := GetManifestPath()
-	if err != nil {
-		return nil, err
-	}
-
-	p := filepath.Join(manifests, n.Filepath())
+	p := resolveManifestPath(n)
 
 	var m Manifest
 	f, err := os.Open(p)
@@ -97,12 +92,12 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 }
 
 func WriteManifest(name model.Name, config Layer, layers []Layer) error {
-	manifests, err := GetManifestPath()
-	if err != nil {
-		return err
+	// a model in a base model store is overridden rather than changed
+	p := findInStores("manifests", name.Filepath())
+	if isBaseStore(p) {
+		p = filepath.Join(envconfig.Models(), "manifests", name.Filepath())
 	}
 
-	p := filepath.Join(manifests, name.Filepath())
 	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
 		return err
 	}
@@ -124,15 +119,19 @@ func WriteManifest(name model.Name, config Layer, layers []Layer) error {
 }
 
 func Manifests() (map[model.Name]*Manifest, error) {
-	manifests, err := GetManifestPath()
-	if err != nil {
+	if _, err := GetManifestPath(); err != nil {
 		return nil, err
 	}
 
-	// TODO(mxyng): use something less brittle
-	matches, err := filepath.Glob(filepath.Join(manifests, "*", "*", "*", "*"))
-	if err != nil {
-		return nil, err
+	var matches []string
+	for _, store := range allStores() {
+		// TODO(mxyng): use something less brittle
+		storeMatches, err := filepath.Glob(filepath.Join(store, "manifests", "*", "*", "*", "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		matches = append(matches, storeMatches...)
 	}
 
 	ms := make(map[model.Name]*Manifest)
@@ -143,7 +142,7 @@ func Manifests() (map[model.Name]*Manifest, error) {
 		}
 
 		if !fi.IsDir() {
-			rel, err := filepath.Rel(manifests, match)
+			rel, err := filepath.Rel(filepath.Join(storeOf(match), "manifests"), match)
 			if err != nil {
 				slog.Warn("bad filepath", "path", match, "error", err)
 				continue
@@ -155,6 +154,11 @@ func Manifests() (map[model.Name]*Manifest, error) {
 				continue
 			}
 
+			if _, ok := ms[n]; ok {
+				// the model is in more than one store
+				continue
+			}
+
 			m, err := ParseNamedManifest(n)
 			if syntax := &(json.SyntaxError{}); errors.As(err, &syntax) {
 				slog.Warn("bad manifest", "name", n, "error", err)
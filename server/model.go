@@ -81,7 +81,7 @@ func parseFromModel(ctx context.Context, name model.Name, fn func(api.ProgressRe
 	return layers, nil
 }
 
-func parseFromZipFile(_ context.Context, command string, baseLayers []*layerGGML, f *os.File, digest string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
+func parseFromZipFile(_ context.Context, command string, baseLayers []*layerGGML, f *os.File, digest, quantization string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
 	fi, err := f.Stat()
 	if err != nil {
 		return nil, err
@@ -109,6 +109,7 @@ func parseFromZipFile(_ context.Context, command string, baseLayers []*layerGGML
 	defer os.Remove(t.Name())
 
 	var layerType string
+	var projector *os.File
 
 	switch command {
 	case "adapter":
@@ -129,10 +130,35 @@ func parseFromZipFile(_ context.Context, command string, baseLayers []*layerGGML
 		}
 		layerType = "application/vnd.ollama.image.adapter"
 	case "model":
-		if err := convert.ConvertModel(convert.NewZipReader(r, p, 32<<20), t); err != nil {
+		if quantization != "" {
+			// quantize tensors as they're converted so an intermediate F16 model
+			// isn't written
+			if err := convert.ConvertQuantizedModel(convert.NewZipReader(r, p, 32<<20), t, quantization, func(completed, total int64) {
+				fn(api.ProgressResponse{
+					Status:    fmt.Sprintf("quantizing model to %s", quantization),
+					Total:     total,
+					Completed: completed,
+				})
+			}); err != nil {
+				return nil, err
+			}
+		} else if err := convert.ConvertModel(convert.NewZipReader(r, p, 32<<20), t); err != nil {
 			return nil, err
 		}
 		layerType = "application/vnd.ollama.image.model"
+
+		projector, err = os.CreateTemp(p, "projector")
+		if err != nil {
+			return nil, err
+		}
+		defer projector.Close()
+		defer os.Remove(projector.Name())
+
+		if err := convert.ConvertProjector(convert.NewZipReader(r, p, 32<<20), projector); errors.Is(err, convert.ErrNoProjector) {
+			projector = nil
+		} else if err != nil {
+			return nil, err
+		}
 	}
 
 	if _, err := t.Seek(0, io.SeekStart); err != nil {
@@ -157,11 +183,105 @@ func parseFromZipFile(_ context.Context, command string, baseLayers []*layerGGML
 
 	layers = append(layers, &layerGGML{layer, ggml})
 
-	intermediateBlobs[digest] = layer.Digest
+	if projector != nil {
+		if _, err := projector.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		layer, err := NewLayer(projector, "application/vnd.ollama.image.projector")
+		if err != nil {
+			return nil, err
+		}
+
+		bin, err := layer.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer bin.Close()
+
+		ggml, _, err := llm.DecodeGGML(bin, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, &layerGGML{layer, ggml})
+	} else if quantization == "" {
+		// the cached layer only covers an unquantized model so multimodal and
+		// quantized models are always converted
+		intermediateBlobs[digest] = layer.Digest
+	}
+
 	return detectChatTemplate(layers)
 }
 
-func parseFromFile(ctx context.Context, command string, baseLayers []*layerGGML, file *os.File, digest string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
+// imatrixFromBlob reads the importance matrix in blob digest and returns it with
+// a layer to store it in
+func imatrixFromBlob(digest string) (*Layer, llm.Imatrix, error) {
+	layer, err := NewLayerFromLayer(digest, "application/vnd.ollama.image.imatrix", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := layer.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	im, err := llm.ReadImatrix(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &layer, im, nil
+}
+
+// computeImatrix computes an importance matrix for the model at path from the
+// calibration text in blob digest and returns it with a layer to store it in.
+// The model is evaluated by a runner from sched, which is unloaded once it's
+// done, so it's never loaded into the server itself.
+func computeImatrix(ctx context.Context, sched *Scheduler, path, digest string) (*Layer, llm.Imatrix, error) {
+	blob, err := GetBlobsPath(digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	calibration, err := os.ReadFile(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the runner is released when ctx is canceled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runnerCh, errCh := sched.GetRunner(ctx, &Model{ModelPath: path}, api.DefaultOptions(), &api.Duration{})
+	var runner *runnerRef
+	select {
+	case runner = <-runnerCh:
+	case err := <-errCh:
+		return nil, nil, err
+	}
+
+	im, err := runner.llama.Imatrix(ctx, string(calibration))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var b bytes.Buffer
+	if _, err := im.WriteTo(&b); err != nil {
+		return nil, nil, err
+	}
+
+	layer, err := NewLayer(&b, "application/vnd.ollama.image.imatrix")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &layer, im, nil
+}
+
+func parseFromFile(ctx context.Context, command string, baseLayers []*layerGGML, file *os.File, digest, quantization string, fn func(api.ProgressResponse)) (layers []*layerGGML, err error) {
 	sr := io.NewSectionReader(file, 0, 512)
 	contentType, err := detectContentType(sr)
 	if err != nil {
@@ -172,7 +292,7 @@ func parseFromFile(ctx context.Context, command string, baseLayers []*layerGGML,
 	case "gguf", "ggla":
 		// noop
 	case "application/zip":
-		return parseFromZipFile(ctx, command, baseLayers, file, digest, fn)
+		return parseFromZipFile(ctx, command, baseLayers, file, digest, quantization, fn)
 	default:
 		return nil, fmt.Errorf("unsupported content type: %s", contentType)
 	}
@@ -92,14 +92,41 @@ func (mp ModelPath) GetShortTagname() string {
 }
 
 // GetManifestPath returns the path to the manifest file for the given model path, it is up to the caller to create the directory if it does not exist.
+// The manifest is looked up in every model store.
 func (mp ModelPath) GetManifestPath() (string, error) {
 	if p := filepath.Join(mp.Registry, mp.Namespace, mp.Repository, mp.Tag); filepath.IsLocal(p) {
-		return filepath.Join(envconfig.Models(), "manifests", p), nil
+		return findInStores("manifests", p), nil
 	}
 
 	return "", errModelPathInvalid
 }
 
+// manifestPathIn returns the path to the manifest file for the given model path in store.
+func (mp ModelPath) manifestPathIn(store string) (string, error) {
+	if p := filepath.Join(mp.Registry, mp.Namespace, mp.Repository, mp.Tag); filepath.IsLocal(p) {
+		return filepath.Join(store, "manifests", p), nil
+	}
+
+	return "", errModelPathInvalid
+}
+
+// findInStores returns the path of elem in the first model store which has
+// it, or in the first model store if none do. Base model stores are searched
+// last.
+func findInStores(elem ...string) string {
+	stores := allStores()
+	if len(stores) > 1 {
+		for _, store := range stores {
+			p := filepath.Join(append([]string{store}, elem...)...)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
+
+	return filepath.Join(append([]string{stores[0]}, elem...)...)
+}
+
 func (mp ModelPath) BaseURL() *url.URL {
 	return &url.URL{
 		Scheme: mp.ProtocolScheme,
@@ -126,6 +153,16 @@ func GetBlobsPath(digest string) (string, error) {
 	}
 
 	digest = strings.ReplaceAll(digest, ":", "-")
+	if digest != "" {
+		// an existing blob may be in any store, including a base model store
+		p := findInStores("blobs", digest)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+
+	// new blobs, and the temporary files they're written from, only ever go
+	// in the first model store
 	path := filepath.Join(envconfig.Models(), "blobs", digest)
 	dirPath := filepath.Dir(path)
 	if digest == "" {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"log/slog"
+	"sync"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/llm"
@@ -16,6 +17,11 @@ type tokenizeFunc func(context.Context, string) ([]int, error)
 // chatPrompt truncates any messages that exceed the context window of the model, making sure to always include 1) the
 // latest message and 2) system messages
 func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.Options, msgs []api.Message, tools []api.Tool) (prompt string, images []llm.ImageData, _ error) {
+	var imageTokens int
+	if m.ProjectorPaths != nil {
+		imageTokens = projectorImageTokens(m.ProjectorPaths[0])
+	}
+
 	var system []api.Message
 	// always include the last message
 	n := len(msgs) - 1
@@ -41,9 +47,7 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 		c := len(s)
 		if m.ProjectorPaths != nil {
 			for _, m := range msgs[i:] {
-				// images are represented as 768 sized embeddings
-				// TODO: get embedding length from project metadata
-				c += 768 * len(m.Images)
+				c += imageTokens * len(m.Images)
 			}
 		}
 
@@ -72,3 +76,35 @@ func chatPrompt(ctx context.Context, m *Model, tokenize tokenizeFunc, opts *api.
 
 	return b.String(), images, nil
 }
+
+// defaultImageTokens is the number of tokens assumed for an image when the
+// projector metadata doesn't describe its embedding length
+const defaultImageTokens = 768
+
+// projectorTokens caches the number of tokens an image occupies by the path
+// of the projector. Projectors are blobs named by their digest, so a path always
+// has the same metadata.
+var projectorTokens sync.Map
+
+// projectorImageTokens returns the maximum number of context tokens a single
+// image occupies for the given projector. The projector is only decoded the
+// first time.
+func projectorImageTokens(projector string) int {
+	if tokens, ok := projectorTokens.Load(projector); ok {
+		return tokens.(int)
+	}
+
+	ggml, err := llm.LoadModel(projector, 0)
+	if err != nil {
+		// the projector may be readable later so the default isn't cached
+		return defaultImageTokens
+	}
+
+	tokens := defaultImageTokens
+	if n := ggml.KV().ImageTokens(); n > 0 {
+		tokens = int(n)
+	}
+
+	projectorTokens.Store(projector, tokens)
+	return tokens
+}
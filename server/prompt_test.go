@@ -3,11 +3,14 @@ package server
 import (
 	"bytes"
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/template"
 )
 
@@ -209,3 +212,35 @@ func TestChatPrompt(t *testing.T) {
 		})
 	}
 }
+
+func TestProjectorImageTokens(t *testing.T) {
+	projector := createBinFile(t, llm.KV{
+		"general.architecture":   "clip",
+		"clip.projector_type":    "mlp",
+		"clip.vision.image_size": uint32(336),
+		"clip.vision.patch_size": uint32(14),
+	}, nil)
+
+	if got := projectorImageTokens(projector); got != 576 {
+		t.Fatalf("expected 576 tokens, got %d", got)
+	}
+
+	// the projector isn't decoded again
+	if err := os.Remove(projector); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := projectorImageTokens(projector); got != 576 {
+		t.Errorf("expected the cached 576 tokens, got %d", got)
+	}
+
+	// a projector which can't be read isn't cached
+	missing := filepath.Join(t.TempDir(), "missing")
+	if got := projectorImageTokens(missing); got != defaultImageTokens {
+		t.Errorf("expected the default %d tokens, got %d", defaultImageTokens, got)
+	}
+
+	if _, ok := projectorTokens.Load(missing); ok {
+		t.Error("expected the default not to be cached")
+	}
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+var (
+	errPullPaused    = errors.New("pull paused")
+	errPullCancelled = errors.New("pull cancelled")
+)
+
+// pullRecord is the state of a pull which hasn't finished. It's kept in the
+// pulls directory so pulls can be listed and resumed across restarts.
+type pullRecord struct {
+	Model    string `json:"model"`
+	Insecure bool   `json:"insecure,omitempty"`
+	MaxRate  int64  `json:"max_rate,omitempty"`
+	Store    string `json:"store,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+
+	// Layers are the layers of the model once its manifest is pulled
+	Layers []Layer `json:"layers,omitempty"`
+}
+
+func pullsPath() (string, error) {
+	path := filepath.Join(envconfig.Models(), "pulls")
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func pullRecordPath(mp ModelPath) (string, error) {
+	path, err := pullsPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(path, fmt.Sprintf("%x.json", sha256.Sum256([]byte(mp.GetFullTagname())))), nil
+}
+
+func (r *pullRecord) save(mp ModelPath) error {
+	p, err := pullRecordPath(mp)
+	if err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(p, bts, 0o644)
+}
+
+func loadPullRecord(mp ModelPath) (*pullRecord, error) {
+	p, err := pullRecordPath(mp)
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var r pullRecord
+	if err := json.Unmarshal(bts, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+
+	return &r, nil
+}
+
+func removePullRecord(mp ModelPath) error {
+	p, err := pullRecordPath(mp)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// pullRecords returns the records of every pull which hasn't finished
+func pullRecords() ([]*pullRecord, error) {
+	path, err := pullsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*pullRecord
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		bts, err := os.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var r pullRecord
+		if err := json.Unmarshal(bts, &r); err != nil {
+			slog.Warn("bad pull record", "path", entry.Name(), "error", err)
+			continue
+		}
+
+		records = append(records, &r)
+	}
+
+	return records, nil
+}
+
+// pull is a pull in progress. A model may be pulled by several clients at
+// once so pulls are reference counted.
+type pull struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// references is guarded by pullsMu
+	references int
+
+	// done is closed once every reference is released
+	done chan struct{}
+}
+
+var (
+	pullsMu sync.Mutex
+	pulls   = make(map[string]*pull)
+
+	// shuttingDown is set when the server stops so the pulls it interrupts
+	// are resumed when it next starts rather than paused
+	shuttingDown atomic.Bool
+)
+
+func runningPull(mp ModelPath) (*pull, bool) {
+	pullsMu.Lock()
+	defer pullsMu.Unlock()
+	p, ok := pulls[mp.GetFullTagname()]
+	return p, ok
+}
+
+// runPull pulls the model name so it can be paused and cancelled while it's
+// in progress. A pull whose client goes away is paused.
+func runPull(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	mp := ParseModelPath(name)
+	key := mp.GetFullTagname()
+
+	pullsMu.Lock()
+	p, ok := pulls[key]
+	if !ok {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		p = &pull{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+		pulls[key] = p
+	}
+	p.references++
+	pullsMu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	err := PullModel(ctx, name, regOpts, fn)
+
+	pullsMu.Lock()
+	defer pullsMu.Unlock()
+
+	p.references--
+	if p.references > 0 {
+		return err
+	}
+
+	delete(pulls, key)
+	defer close(p.done)
+
+	cause := context.Cause(p.ctx)
+	if err != nil && ctx.Err() != nil && !shuttingDown.Load() && !errors.Is(cause, errPullCancelled) {
+		// keep what's been pulled so the pull can be resumed
+		if record, err := loadPullRecord(mp); err == nil {
+			record.Paused = true
+			if err := record.save(mp); err != nil {
+				slog.Warn("couldn't pause pull", "model", name, "error", err)
+			}
+		}
+	}
+
+	if err != nil && cause != nil {
+		return cause
+	}
+
+	return err
+}
+
+// waitForDownloads waits for the downloads of layers to stop unless they're
+// used by other pulls
+func waitForDownloads(layers []Layer) {
+	for _, layer := range layers {
+		if v, ok := blobDownloadManager.Load(layer.Digest); ok {
+			if b := v.(*blobDownload); b.references.Load() == 0 && b.done != nil {
+				<-b.done
+			}
+		}
+	}
+}
+
+// pausePull stops the pull of name, keeping what's been downloaded
+func pausePull(name string) error {
+	mp := ParseModelPath(name)
+	if p, ok := runningPull(mp); ok {
+		p.cancel(errPullPaused)
+		<-p.done
+	}
+
+	record, err := loadPullRecord(mp)
+	if err != nil {
+		return err
+	}
+
+	if !record.Paused {
+		record.Paused = true
+		if err := record.save(mp); err != nil {
+			return err
+		}
+	}
+
+	waitForDownloads(record.Layers)
+	return nil
+}
+
+// cancelPull stops the pull of name and removes what's been downloaded
+func cancelPull(name string) error {
+	mp := ParseModelPath(name)
+	if p, ok := runningPull(mp); ok {
+		p.cancel(errPullCancelled)
+		<-p.done
+	}
+
+	record, err := loadPullRecord(mp)
+	if err != nil {
+		return err
+	}
+
+	if err := removePullRecord(mp); err != nil {
+		return err
+	}
+
+	waitForDownloads(record.Layers)
+
+	deleteMap := make(map[string]struct{})
+	for _, layer := range record.Layers {
+		if _, ok := blobDownloadManager.Load(layer.Digest); ok {
+			// another pull is downloading it
+			continue
+		}
+
+		if _, err := GetBlobsPath(layer.Digest); err != nil {
+			return err
+		}
+
+		partials, err := storeGlob(strings.ReplaceAll(layer.Digest, ":", "-") + "-partial*")
+		if err != nil {
+			return err
+		}
+
+		for _, partial := range partials {
+			if err := os.Remove(partial); err != nil {
+				return err
+			}
+		}
+
+		deleteMap[layer.Digest] = struct{}{}
+	}
+
+	if envconfig.NoPrune() {
+		return nil
+	}
+
+	return deleteUnusedLayers(deleteMap)
+}
+
+// resumePull resumes the pull in record in the background
+func resumePull(record *pullRecord) {
+	regOpts := &registryOptions{Insecure: record.Insecure, MaxRate: record.MaxRate, Store: record.Store}
+	go func() {
+		if err := runPull(context.Background(), record.Model, regOpts, func(api.ProgressResponse) {}); err != nil {
+			slog.Warn("couldn't resume pull", "model", record.Model, "error", err)
+		}
+	}()
+}
+
+// resumePulls resumes pulls interrupted by the server stopping
+func resumePulls() error {
+	records, err := pullRecords()
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if !record.Paused {
+			slog.Info("resuming pull", "model", record.Model)
+			resumePull(record)
+		}
+	}
+
+	return nil
+}
+
+// layerProgress returns how much of layer has been downloaded
+func layerProgress(layer Layer) int64 {
+	fp, err := GetBlobsPath(layer.Digest)
+	if err != nil {
+		return 0
+	}
+
+	if fi, err := os.Stat(fp); err == nil {
+		return fi.Size()
+	}
+
+	if v, ok := blobDownloadManager.Load(layer.Digest); ok {
+		return v.(*blobDownload).Completed.Load()
+	}
+
+	partials, err := storeGlob(strings.ReplaceAll(layer.Digest, ":", "-") + "-partial-*")
+	if err != nil {
+		return 0
+	}
+
+	var completed int64
+	for _, partial := range partials {
+		bts, err := os.ReadFile(partial)
+		if err != nil {
+			continue
+		}
+
+		var part jsonBlobDownloadPart
+		if err := json.Unmarshal(bts, &part); err != nil {
+			continue
+		}
+
+		completed += part.Completed
+	}
+
+	return completed
+}
+
+// listPulls returns the progress of every pull which hasn't finished
+func listPulls() ([]api.PullStatus, error) {
+	records, err := pullRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []api.PullStatus{}
+	for _, record := range records {
+		status := api.PullStatus{
+			Model:   ParseModelPath(record.Model).GetShortTagname(),
+			Status:  "pulling",
+			MaxRate: record.MaxRate,
+		}
+
+		if _, ok := runningPull(ParseModelPath(record.Model)); !ok && record.Paused {
+			status.Status = "paused"
+		}
+
+		for _, layer := range record.Layers {
+			status.Total += layer.Size
+			status.Completed += layerProgress(layer)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	slices.SortFunc(statuses, func(a, b api.PullStatus) int {
+		return strings.Compare(a.Model, b.Model)
+	})
+
+	return statuses, nil
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1000)
+
+	start := l.reserve(500)
+	if d := time.Until(start); d > 0 {
+		t.Errorf("expected the first read to be immediate, got %s", d)
+	}
+
+	l.reserve(500)
+	if got := l.reserve(500).Sub(start); got < time.Second || got > time.Second+100*time.Millisecond {
+		t.Errorf("expected the third read after 1s, got %s", got)
+	}
+
+	unlimited := newRateLimiter(0)
+	for range 10 {
+		if d := time.Until(unlimited.reserve(1 << 20)); d > 0 {
+			t.Fatalf("expected unlimited reads to be immediate, got %s", d)
+		}
+	}
+}
+
+// newTestPullRegistry serves a model with a single layer of size bytes and
+// returns the name to pull it by
+func newTestPullRegistry(t *testing.T, size int) string {
+	t.Helper()
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRIES", filepath.Join(t.TempDir(), "registries.toml"))
+	t.Setenv("OLLAMA_TRUST_POLICY", filepath.Join(t.TempDir(), "trust.toml"))
+
+	blob := make([]byte, size)
+	if _, err := rand.Read(blob); err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := NewLayer(bytes.NewReader(blob), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configJSON := []byte(`{"model_format":"gguf"}`)
+	config, err := NewLayer(bytes.NewReader(configJSON), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the layers are served by the test registry, not the store
+	for _, l := range []Layer{layer, config} {
+		fp, err := GetBlobsPath(l.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Remove(fp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestJSON, err := json.Marshal(Manifest{SchemaVersion: 2, Config: config, Layers: []Layer{layer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := map[string][]byte{layer.Digest: blob, config.Digest: configJSON}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/library/test/manifests/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(manifestJSON)
+	})
+	mux.HandleFunc("/v2/library/test/blobs/{digest}", func(w http.ResponseWriter, r *http.Request) {
+		blob, ok := blobs[r.PathValue("digest")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	})
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Host + "/library/test:latest"
+}
+
+// startTestPull starts a rate limited pull of name and waits for it to make
+// progress
+func startTestPull(t *testing.T, ctx context.Context, name string) chan error {
+	t.Helper()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- runPull(ctx, name, &registryOptions{Insecure: true, MaxRate: 16 << 10}, func(api.ProgressResponse) {})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pulls, err := listPulls()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(pulls) == 1 && pulls[0].Completed > 0 {
+			return errCh
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("pull made no progress")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func partialFiles(t *testing.T) []string {
+	t.Helper()
+
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partials, err := filepath.Glob(filepath.Join(blobs, "*-partial*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return partials
+}
+
+func TestPullPauseResume(t *testing.T) {
+	name := newTestPullRegistry(t, 64<<10)
+
+	errCh := startTestPull(t, context.Background(), name)
+	if err := pausePull(name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-errCh; !errors.Is(err, errPullPaused) {
+		t.Fatalf("expected %v, got %v", errPullPaused, err)
+	}
+
+	pulls, err := listPulls()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pulls) != 1 || pulls[0].Status != "paused" || pulls[0].Completed == 0 || pulls[0].Completed >= pulls[0].Total {
+		t.Fatalf("expected a partially complete paused pull, got %+v", pulls)
+	}
+
+	// what's been downloaded survives a restart
+	if err := PruneLayers(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(partialFiles(t)) == 0 {
+		t.Fatal("expected partial files to be kept")
+	}
+
+	var resumedAt int64
+	if err := runPull(context.Background(), name, &registryOptions{Insecure: true}, func(r api.ProgressResponse) {
+		if r.Digest != "" && resumedAt == 0 {
+			resumedAt = r.Completed
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if resumedAt == 0 {
+		t.Error("expected the pull to resume from where it was paused")
+	}
+
+	if _, err := ParseNamedManifest(model.ParseName(name)); err != nil {
+		t.Fatal(err)
+	}
+
+	if pulls, err := listPulls(); err != nil {
+		t.Fatal(err)
+	} else if len(pulls) != 0 {
+		t.Errorf("expected no pulls, got %+v", pulls)
+	}
+}
+
+func TestPullCancel(t *testing.T) {
+	name := newTestPullRegistry(t, 64<<10)
+
+	errCh := startTestPull(t, context.Background(), name)
+	if err := cancelPull(name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-errCh; !errors.Is(err, errPullCancelled) {
+		t.Fatalf("expected %v, got %v", errPullCancelled, err)
+	}
+
+	if partials := partialFiles(t); len(partials) > 0 {
+		t.Errorf("expected partial files to be removed, got %v", partials)
+	}
+
+	if pulls, err := listPulls(); err != nil {
+		t.Fatal(err)
+	} else if len(pulls) != 0 {
+		t.Errorf("expected no pulls, got %+v", pulls)
+	}
+
+	if err := cancelPull(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestPullClientGone(t *testing.T) {
+	name := newTestPullRegistry(t, 64<<10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := startTestPull(t, ctx, name)
+	cancel()
+
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	record, err := loadPullRecord(ParseModelPath(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !record.Paused {
+		t.Error("expected the pull to be paused")
+	}
+
+	waitForDownloads(record.Layers)
+}
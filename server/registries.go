@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// registriesConfig maps a registry host to the mirrors models are pulled
+// through. It's read from the file named by OLLAMA_REGISTRIES, e.g.
+//
+//	[registry."registry.ollama.ai"]
+//	fallback = true
+//
+//	[[registry."registry.ollama.ai".mirrors]]
+//	endpoint = "https://ollama-cache.internal"
+//	username = "ci"
+//	password = "secret"
+//	ca = "/etc/ssl/certs/internal-ca.pem"
+type registriesConfig struct {
+	Registry map[string]registryHost `toml:"registry"`
+}
+
+type registryHost struct {
+	// Mirrors are tried in order before the registry itself
+	Mirrors []registryMirror `toml:"mirrors"`
+
+	// Fallback controls whether the registry itself is tried after its
+	// mirrors. Default is true.
+	Fallback *bool `toml:"fallback"`
+}
+
+type registryMirror struct {
+	Endpoint string `toml:"endpoint"`
+
+	// Username and Password are sent to the mirror with basic auth
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// CA is a PEM bundle of certificate authorities trusted in addition to
+	// the system's
+	CA         string `toml:"ca"`
+	SkipVerify bool   `toml:"skip_verify"`
+}
+
+func loadRegistriesConfig(path string) (*registriesConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config registriesConfig
+	if err := toml.NewDecoder(f).DisallowUnknownFields().Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// transport returns the transport used to connect to the mirror or nil if the
+// default transport can be used
+func (m registryMirror) transport() (http.RoundTripper, error) {
+	if m.CA == "" && !m.SkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: m.SkipVerify}
+	if m.CA != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(m.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", m.CA)
+		}
+
+		config.RootCAs = pool
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = config
+	return t, nil
+}
+
+// registryEndpoint is a URL a model's manifest or blobs can be pulled from and
+// the options used to request it
+type registryEndpoint struct {
+	url     *url.URL
+	regOpts *registryOptions
+}
+
+func (e registryEndpoint) JoinPath(elem ...string) registryEndpoint {
+	return registryEndpoint{url: e.url.JoinPath(elem...), regOpts: e.regOpts}
+}
+
+// pullEndpoints returns the endpoints mp is pulled from in the order they're
+// tried: the configured mirrors of its registry followed by the registry itself
+func pullEndpoints(mp ModelPath, regOpts *registryOptions) ([]registryEndpoint, error) {
+	registry := registryEndpoint{url: mp.BaseURL(), regOpts: regOpts}
+
+	config, err := loadRegistriesConfig(envconfig.Registries())
+	if errors.Is(err, os.ErrNotExist) {
+		return []registryEndpoint{registry}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	host, ok := config.Registry[mp.Registry]
+	if !ok {
+		return []registryEndpoint{registry}, nil
+	}
+
+	var endpoints []registryEndpoint
+	for _, mirror := range host.Mirrors {
+		u, err := url.Parse(mirror.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("mirror %q: %w", mirror.Endpoint, err)
+		}
+
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("mirror %q: %w", mirror.Endpoint, ErrInvalidProtocol)
+		}
+
+		transport, err := mirror.transport()
+		if err != nil {
+			return nil, fmt.Errorf("mirror %q: %w", mirror.Endpoint, err)
+		}
+
+		endpoints = append(endpoints, registryEndpoint{
+			url: u,
+			regOpts: &registryOptions{
+				Username:  mirror.Username,
+				Password:  mirror.Password,
+				Transport: transport,
+			},
+		})
+	}
+
+	if host.Fallback == nil || *host.Fallback {
+		endpoints = append(endpoints, registry)
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no mirrors configured for %s and fallback is disabled", mp.Registry)
+	}
+
+	return endpoints, nil
+}
+
+// firstEndpoint calls fn with each endpoint in order until one succeeds
+func firstEndpoint[T any](ctx context.Context, endpoints []registryEndpoint, fn func(registryEndpoint) (T, error)) (t T, err error) {
+	for i, e := range endpoints {
+		t, err = fn(e)
+		if err == nil || ctx.Err() != nil {
+			return t, err
+		}
+
+		if i < len(endpoints)-1 {
+			slog.Warn("request failed, trying next endpoint", "url", e.url.Redacted(), "error", err)
+		}
+	}
+
+	return t, err
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestPullEndpoints(t *testing.T) {
+	t.Setenv("OLLAMA_REGISTRIES", filepath.Join(t.TempDir(), "registries.toml"))
+
+	urls := func(t *testing.T, name string) []string {
+		t.Helper()
+
+		endpoints, err := pullEndpoints(ParseModelPath(name), &registryOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var s []string
+		for _, e := range endpoints {
+			s = append(s, e.url.String())
+		}
+
+		return s
+	}
+
+	t.Run("no config", func(t *testing.T) {
+		if got := urls(t, "llama3"); !slices.Equal(got, []string{"https://registry.ollama.ai"}) {
+			t.Errorf("unexpected endpoints %v", got)
+		}
+	})
+
+	if err := os.WriteFile(envconfig.Registries(), []byte(`
+[registry."registry.ollama.ai"]
+[[registry."registry.ollama.ai".mirrors]]
+endpoint = "https://mirror1.internal"
+username = "user"
+password = "pass"
+
+[[registry."registry.ollama.ai".mirrors]]
+endpoint = "http://mirror2.internal:5000/ollama"
+
+[registry."example.com"]
+fallback = false
+
+[[registry."example.com".mirrors]]
+endpoint = "https://mirror.internal"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("fallback", func(t *testing.T) {
+		want := []string{"https://mirror1.internal", "http://mirror2.internal:5000/ollama", "https://registry.ollama.ai"}
+		if got := urls(t, "llama3"); !slices.Equal(got, want) {
+			t.Errorf("unexpected endpoints %v", got)
+		}
+	})
+
+	t.Run("no fallback", func(t *testing.T) {
+		if got := urls(t, "example.com/library/llama3"); !slices.Equal(got, []string{"https://mirror.internal"}) {
+			t.Errorf("unexpected endpoints %v", got)
+		}
+	})
+
+	t.Run("unconfigured", func(t *testing.T) {
+		if got := urls(t, "other.com/library/llama3"); !slices.Equal(got, []string{"https://other.com"}) {
+			t.Errorf("unexpected endpoints %v", got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if err := os.WriteFile(envconfig.Registries(), []byte(`
+[[registry."registry.ollama.ai".mirrors]]
+endpoint = "ftp://mirror.internal"
+`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := pullEndpoints(ParseModelPath("llama3"), &registryOptions{}); err == nil {
+			t.Error("expected error for invalid endpoint")
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		if err := os.WriteFile(envconfig.Registries(), []byte(`
+[[registry."registry.ollama.ai".mirrors]]
+url = "https://mirror.internal"
+`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := pullEndpoints(ParseModelPath("llama3"), &registryOptions{}); err == nil {
+			t.Error("expected error for unknown field")
+		}
+	})
+}
+
+func TestPullModelMirror(t *testing.T) {
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	blob := []byte("the quick brown fox jumps over the lazy dog")
+	config := []byte(`{"model_format":"gguf"}`)
+	blobs := map[string][]byte{
+		fmt.Sprintf("sha256:%x", sha256.Sum256(blob)):   blob,
+		fmt.Sprintf("sha256:%x", sha256.Sum256(config)): config,
+	}
+
+	manifest, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+		Config:        Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(config)), Size: int64(len(config))},
+		Layers:        []Layer{{MediaType: "application/vnd.ollama.image.model", Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(blob)), Size: int64(len(blob))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			http.Error(w, "unauthorized", http.StatusForbidden)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/library/test/manifests/latest":
+			w.Write(manifest) //nolint:errcheck
+		case strings.HasPrefix(r.URL.Path, "/v2/library/test/blobs/"):
+			b, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/library/test/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mirror.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mirror.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registries := filepath.Join(t.TempDir(), "registries.toml")
+	t.Setenv("OLLAMA_REGISTRIES", registries)
+	if err := os.WriteFile(registries, []byte(fmt.Sprintf(`
+[registry."registry.ollama.ai"]
+fallback = false
+
+[[registry."registry.ollama.ai".mirrors]]
+endpoint = %q
+
+[[registry."registry.ollama.ai".mirrors]]
+endpoint = %q
+username = "user"
+password = "pass"
+ca = %q
+`, broken.URL, mirror.URL, ca)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PullModel(context.Background(), "test", &registryOptions{}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseNamedManifest(model.ParseName("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, layer := range append(m.Layers, m.Config) {
+		if err := verifyBlob(layer.Digest); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+	"github.com/ollama/ollama/version"
+)
+
+// maxManifestSize is the largest manifest the registry accepts
+const maxManifestSize = 4 << 20
+
+// registryError aborts the request with an error in the format described by
+// the distribution spec
+func registryError(c *gin.Context, status int, code string, err error) {
+	c.AbortWithStatusJSON(status, gin.H{"errors": []gin.H{{"code": code, "message": err.Error()}}})
+}
+
+// registryName returns the name of the model addressed by the request. The
+// registry serves models under the default host, regardless of the host it's
+// reached by, so models pulled from ollama.com are served under their
+// original names and models pushed to it can be run by their short names.
+func registryName(c *gin.Context, tag string) (model.Name, error) {
+	n := model.ParseName(c.Param("namespace") + "/" + c.Param("model") + ":" + tag)
+	if !n.IsFullyQualified() {
+		return model.Name{}, model.Unqualified(n)
+	}
+
+	return n, nil
+}
+
+// registryURL returns an absolute URL to path on the host the request was
+// made to
+func registryURL(c *gin.Context, path ...string) string {
+	u := url.URL{Scheme: "http", Host: c.Request.Host}
+	if c.Request.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	return u.JoinPath(append([]string{"v2", c.Param("namespace"), c.Param("model")}, path...)...).String()
+}
+
+// uploadPath returns the path of the file an upload is written to. Uploads
+// are kept in the blobs directory so they can be renamed into place once
+// they're complete, and don't match the blob naming scheme so incomplete
+// uploads are removed when the store is pruned.
+func uploadPath(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		return "", fmt.Errorf("invalid upload id %q", id)
+	}
+
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(blobs, "upload-"+id), nil
+}
+
+// registryAuthMiddleware requires requests to authenticate with the username
+// and password of user using basic auth
+func registryAuthMiddleware(user *url.Userinfo) gin.HandlerFunc {
+	password, _ := user.Password()
+	return func(c *gin.Context) {
+		u, p, ok := c.Request.BasicAuth()
+		// compare both so the time taken doesn't reveal which was wrong
+		usernameOK := subtle.ConstantTimeCompare([]byte(u), []byte(user.Username())) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		if !ok || !usernameOK || !passwordOK {
+			c.Header("WWW-Authenticate", `Basic realm="ollama"`)
+			registryError(c, http.StatusUnauthorized, "UNAUTHORIZED", errors.New("authentication required"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (s *Server) RegistryVersionHandler(c *gin.Context) {
+	// clients check their credentials, e.g. with `ollama login`, by sending
+	// them here
+	if _, _, ok := c.Request.BasicAuth(); ok && s.registryPush != nil {
+		if registryAuthMiddleware(s.registryPush)(c); c.IsAborted() {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (s *Server) RegistryManifestHandler(c *gin.Context) {
+	n, err := registryName(c, c.Param("tag"))
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", err)
+		return
+	}
+
+	// models are served from every store, and aliases by the model they
+	// point to
+	bts, err := os.ReadFile(resolveManifestPath(n))
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Errorf("manifest %s not found", n.DisplayShortest()))
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(bts, &m); err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	c.Header("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(bts)))
+	c.Header("Content-Length", strconv.Itoa(len(bts)))
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", m.MediaType)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Data(http.StatusOK, m.MediaType, bts)
+}
+
+func (s *Server) RegistryPutManifestHandler(c *gin.Context) {
+	n, err := registryName(c, c.Param("tag"))
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "NAME_INVALID", err)
+		return
+	}
+
+	bts, err := io.ReadAll(io.LimitReader(c.Request.Body, maxManifestSize+1))
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	} else if len(bts) > maxManifestSize {
+		registryError(c, http.StatusRequestEntityTooLarge, "SIZE_INVALID", errors.New("manifest is too large"))
+		return
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(bts, &m); err != nil {
+		registryError(c, http.StatusBadRequest, "MANIFEST_INVALID", err)
+		return
+	}
+
+	layers := m.Layers
+	if m.Config.Digest != "" {
+		layers = append(layers, m.Config)
+	}
+
+	for _, layer := range layers {
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			registryError(c, http.StatusBadRequest, "DIGEST_INVALID", err)
+			return
+		}
+
+		if fi, err := os.Stat(p); err != nil || fi.Size() != layer.Size {
+			registryError(c, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", fmt.Errorf("blob %s not found", layer.Digest))
+			return
+		}
+	}
+
+	manifests, err := GetManifestPath()
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	// the manifest is written as it was sent so its digest is unchanged
+	p := filepath.Join(manifests, n.Filepath())
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	if err := os.WriteFile(p, bts, 0o644); err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	slog.Info("registry received manifest", "model", n.DisplayShortest())
+	c.Header("Location", registryURL(c, "manifests", c.Param("tag")))
+	c.Header("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(bts)))
+	c.Status(http.StatusCreated)
+}
+
+// RegistryBlobHandler serves a blob. The registry serves blobs itself rather
+// than redirecting to storage elsewhere, which pulls treat the same as a
+// redirect to the blob, including ranged requests for each part.
+func (s *Server) RegistryBlobHandler(c *gin.Context) {
+	p, err := GetBlobsPath(c.Param("digest"))
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", err)
+		return
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Errorf("blob %s not found", c.Param("digest")))
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+	defer f.Close()
+
+	c.Header("Docker-Content-Digest", c.Param("digest"))
+	c.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, f)
+}
+
+func (s *Server) RegistryStartUploadHandler(c *gin.Context) {
+	// a blob which already exists is mounted rather than uploaded
+	if digest := c.Query("mount"); digest != "" {
+		if p, err := GetBlobsPath(digest); err == nil {
+			if _, err := os.Stat(p); err == nil {
+				c.Header("Location", registryURL(c, "blobs", digest))
+				c.Header("Docker-Content-Digest", digest)
+				c.Status(http.StatusCreated)
+				return
+			}
+		}
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	id := hex.EncodeToString(b[:])
+	p, err := uploadPath(id)
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+	f.Close()
+
+	c.Header("Location", registryURL(c, "blobs", "uploads", id))
+	c.Header("Docker-Upload-UUID", id)
+	c.Header("Range", "0-0")
+	c.Status(http.StatusAccepted)
+}
+
+// writeUpload writes the request body to the upload at the offset given by
+// its Content-Range or, without one, to the end of the upload
+func writeUpload(c *gin.Context, f *os.File) error {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if s := c.GetHeader("Content-Range"); s != "" {
+		start, _, ok := strings.Cut(strings.TrimPrefix(s, "bytes="), "-")
+		if !ok {
+			return fmt.Errorf("invalid Content-Range %q", s)
+		}
+
+		if offset, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return fmt.Errorf("invalid Content-Range %q", s)
+		}
+	}
+
+	// parts may be uploaded concurrently so each is written at its offset
+	// rather than appended
+	_, err = io.Copy(io.NewOffsetWriter(f, offset), c.Request.Body)
+	return err
+}
+
+func (s *Server) RegistryUploadHandler(c *gin.Context) {
+	p, err := uploadPath(c.Param("id"))
+	if err != nil {
+		registryError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", err)
+		return
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", fmt.Errorf("upload %s not found", c.Param("id")))
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+	defer f.Close()
+
+	if err := writeUpload(c, f); err != nil {
+		registryError(c, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err)
+		return
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	c.Header("Location", registryURL(c, "blobs", "uploads", c.Param("id")))
+	c.Header("Docker-Upload-UUID", c.Param("id"))
+	c.Header("Range", fmt.Sprintf("0-%d", max(fi.Size()-1, 0)))
+	c.Status(http.StatusAccepted)
+}
+
+// finishUpload writes the last chunk of the upload, which the request
+// finishing it may carry, and returns the digest of the upload
+func finishUpload(c *gin.Context, f *os.File) (string, error) {
+	if err := writeUpload(c, f); err != nil {
+		return "", err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	// GetSHA256Digest exits on read errors, which an upload mustn't cause
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+func (s *Server) RegistryFinishUploadHandler(c *gin.Context) {
+	digest := c.Query("digest")
+	blob, err := GetBlobsPath(digest)
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", err)
+		return
+	}
+
+	p, err := uploadPath(c.Param("id"))
+	if err != nil {
+		registryError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", err)
+		return
+	}
+
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		registryError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", fmt.Errorf("upload %s not found", c.Param("id")))
+		return
+	} else if err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	got, err := finishUpload(c, f)
+	f.Close()
+	if err != nil {
+		registryError(c, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err)
+		return
+	}
+
+	if got != digest {
+		if err := os.Remove(p); err != nil {
+			slog.Warn("couldn't remove upload", "path", p, "error", err)
+		}
+
+		registryError(c, http.StatusBadRequest, "DIGEST_INVALID", fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, got))
+		return
+	}
+
+	if err := os.Rename(p, blob); err != nil {
+		registryError(c, http.StatusInternalServerError, "UNKNOWN", err)
+		return
+	}
+
+	c.Header("Location", registryURL(c, "blobs", digest))
+	c.Header("Docker-Content-Digest", digest)
+	c.Status(http.StatusCreated)
+}
+
+// RegistryRoutes returns the routes of the registry API used to push and pull
+// models, backed by the local model store. Models can only be pushed if the
+// registry has credentials to authenticate pushes with.
+func (s *Server) RegistryRoutes() http.Handler {
+	r := gin.Default()
+	r.HandleMethodNotAllowed = true
+	r.Use(
+		allowedHostsMiddleware(s.addr),
+		func(c *gin.Context) {
+			c.Header("Docker-Distribution-API-Version", "registry/2.0")
+		},
+	)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		r.Handle(method, "/v2/", s.RegistryVersionHandler)
+		r.Handle(method, "/v2/:namespace/:model/manifests/:tag", s.RegistryManifestHandler)
+		r.Handle(method, "/v2/:namespace/:model/blobs/:digest", s.RegistryBlobHandler)
+	}
+
+	if s.registryPush != nil {
+		push := r.Group("/v2/:namespace/:model", registryAuthMiddleware(s.registryPush))
+		push.PUT("/manifests/:tag", s.RegistryPutManifestHandler)
+		push.POST("/blobs/uploads/", s.RegistryStartUploadHandler)
+		push.PATCH("/blobs/uploads/:id", s.RegistryUploadHandler)
+		push.PUT("/blobs/uploads/:id", s.RegistryFinishUploadHandler)
+	}
+
+	return r
+}
+
+// ServeRegistry serves the local model store as a registry models can be
+// pulled from and, if push is set, pushed to by clients authenticating with
+// the credentials in OLLAMA_REGISTRY_AUTH. Unlike Serve, it doesn't load or
+// run models.
+func ServeRegistry(ln net.Listener, push bool) error {
+	initLogging()
+	slog.Info("registry config", "env", envconfig.Values())
+
+	s := &Server{addr: ln.Addr()}
+	if push {
+		username, password, ok := strings.Cut(envconfig.RegistryAuth(), ":")
+		if !ok || username == "" || password == "" {
+			return errors.New("pushing to the registry requires OLLAMA_REGISTRY_AUTH to be set to username:password")
+		}
+
+		s.registryPush = url.UserPassword(username, password)
+	}
+
+	if err := initStore(); err != nil {
+		return err
+	}
+
+	srvr := &http.Server{Handler: s.RegistryRoutes()}
+
+	ctx, done := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		srvr.Close()
+		done()
+	}()
+
+	slog.Info(fmt.Sprintf("Serving registry on %s (version %s)", ln.Addr(), version.Version))
+	err := srvr.Serve(ln)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
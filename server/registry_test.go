@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestRegistryUpload(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	s := httptest.NewServer((&Server{registryPush: url.UserPassword("user", "pass")}).RegistryRoutes())
+	defer s.Close()
+
+	do := func(t *testing.T, method, u string, headers map[string]string, body []byte) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, u, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		req.SetBasicAuth("user", "pass")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	blob := []byte("the quick brown fox jumps over the lazy dog")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	start := func(t *testing.T) string {
+		t.Helper()
+
+		resp := do(t, http.MethodPost, s.URL+"/v2/library/test/blobs/uploads/", nil, nil)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", resp.StatusCode)
+		}
+
+		return resp.Header.Get("Location")
+	}
+
+	t.Run("parts", func(t *testing.T) {
+		location := start(t)
+
+		// parts uploaded out of order are written at their offsets
+		resp := do(t, http.MethodPatch, location, map[string]string{"Content-Range": "20-42"}, blob[20:])
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", resp.StatusCode)
+		}
+
+		resp = do(t, http.MethodPatch, resp.Header.Get("Location"), map[string]string{"Content-Range": "0-19"}, blob[:20])
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d", resp.StatusCode)
+		}
+
+		if got := resp.Header.Get("Range"); got != "0-42" {
+			t.Errorf("expected range 0-42, got %s", got)
+		}
+
+		resp = do(t, http.MethodPut, resp.Header.Get("Location")+"?digest="+url.QueryEscape(digest), nil, nil)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", resp.StatusCode)
+		}
+
+		if err := verifyBlob(digest); err != nil {
+			t.Fatal(err)
+		}
+
+		resp = do(t, http.MethodGet, s.URL+"/v2/library/test/blobs/"+digest, map[string]string{"Range": "bytes=4-8"}, nil)
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("expected status 206, got %d", resp.StatusCode)
+		}
+
+		if got, err := io.ReadAll(resp.Body); err != nil {
+			t.Fatal(err)
+		} else if string(got) != "quick" {
+			t.Errorf("expected quick, got %q", got)
+		}
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		location := start(t)
+
+		resp := do(t, http.MethodPut, location+"?digest="+url.QueryEscape(digest), nil, []byte("the lazy dog"))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", resp.StatusCode)
+		}
+
+		resp = do(t, http.MethodPatch, location, nil, blob)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected upload to be removed, got status %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("mount", func(t *testing.T) {
+		resp := do(t, http.MethodPost, s.URL+"/v2/library/other/blobs/uploads/?mount="+url.QueryEscape(digest)+"&from=library/test", nil, nil)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		resp := do(t, http.MethodPut, s.URL+"/v2/library/test/manifests/latest", nil, []byte(fmt.Sprintf(`{"schemaVersion":2,"layers":[{"digest":"sha256:%x","size":1}]}`, sha256.Sum256(nil))))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestRegistryPushPull(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRIES", filepath.Join(t.TempDir(), "registries.toml"))
+
+	s := httptest.NewServer((&Server{registryPush: url.UserPassword("user", "pass")}).RegistryRoutes())
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := NewLayer(bytes.NewReader([]byte("the quick brown fox jumps over the lazy dog")), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(bytes.NewReader([]byte(`{"model_format":"gguf"}`)), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := u.Host + "/library/test:latest"
+	if err := WriteManifest(model.ParseName(name), config, []Layer{layer}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PushModel(context.Background(), name, &registryOptions{Insecure: true, Username: "user", Password: "pass"}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the registry stores models under the default host
+	pushed, err := ParseNamedManifest(model.ParseName("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := ParseNamedManifest(model.ParseName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := local.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	pulled, err := ParseNamedManifest(model.ParseName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pulled.digest != pushed.digest {
+		t.Errorf("expected pulled manifest %s, got %s", pushed.digest, pulled.digest)
+	}
+
+	resp, err := http.Get(s.URL + "/v2/library/missing/manifests/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestRegistryPushAuth(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"layers":[{"digest":"sha256:%x","size":1}]}`, sha256.Sum256(nil)))
+
+	cases := []struct {
+		name     string
+		push     *url.Userinfo
+		username string
+		password string
+		code     int
+	}{
+		{"pull only", nil, "", "", http.StatusMethodNotAllowed},
+		{"pull only with credentials", nil, "user", "pass", http.StatusMethodNotAllowed},
+		{"no credentials", url.UserPassword("user", "pass"), "", "", http.StatusUnauthorized},
+		{"wrong username", url.UserPassword("user", "pass"), "other", "pass", http.StatusUnauthorized},
+		{"wrong password", url.UserPassword("user", "pass"), "user", "other", http.StatusUnauthorized},
+		// the manifest's layer is missing, so it's authenticated then rejected
+		{"credentials", url.UserPassword("user", "pass"), "user", "pass", http.StatusBadRequest},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer((&Server{registryPush: tt.push}).RegistryRoutes())
+			defer s.Close()
+
+			req, err := http.NewRequest(http.MethodPut, s.URL+"/v2/library/test/manifests/latest", bytes.NewReader(manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.code {
+				t.Errorf("expected status %d, got %d", tt.code, resp.StatusCode)
+			}
+
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("expected a challenge")
+			}
+		})
+	}
+}
+
+func TestRegistryStores(t *testing.T) {
+	stores := setStores(t, 2)
+
+	layer, err := NewLayer(bytes.NewReader([]byte("weights")), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(bytes.NewReader([]byte(`{"model_format":"gguf"}`)), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteManifest(model.ParseName("second"), config, []Layer{layer}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveModel(model.ParseName("second"), stores[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setAlias(model.ParseName("prod"), model.ParseName("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseNamedManifest(model.ParseName("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer((&Server{}).RegistryRoutes())
+	defer s.Close()
+
+	for _, name := range []string{"second", "prod"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(s.URL + "/v2/library/" + name + "/manifests/latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", resp.StatusCode)
+			}
+
+			if got := resp.Header.Get("Docker-Content-Digest"); got != "sha256:"+m.digest {
+				t.Errorf("expected digest sha256:%s, got %s", m.digest, got)
+			}
+		})
+	}
+}
+
+func TestFinishUploadReadError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// an upload which can be written but not read back
+	f, err := os.OpenFile(filepath.Join(t.TempDir(), "upload"), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPut, "/", bytes.NewReader([]byte("part")))
+
+	if digest, err := finishUpload(c, f); err == nil {
+		t.Errorf("expected a read error, got digest %s", digest)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -42,6 +43,10 @@ var mode string = gin.DebugMode
 type Server struct {
 	addr  net.Addr
 	sched *Scheduler
+
+	// registryPush is the credentials models are pushed to the registry
+	// with, or nil if the registry is pull-only
+	registryPush *url.Userinfo
 }
 
 func init() {
@@ -423,6 +428,35 @@ func normalize(vec []float32) []float32 {
 	return vec
 }
 
+func (s *Server) TokenizeHandler(c *gin.Context) {
+	var req api.TokenizeRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, _, opts, err := s.scheduleRunner(c.Request.Context(), req.Model, []Capability{}, req.Options, req.KeepAlive)
+	if err != nil {
+		handleScheduleError(c, req.Model, err)
+		return
+	}
+
+	tokens, err := r.Tokenize(c.Request.Context(), req.Prompt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if tokens == nil {
+		tokens = []int{}
+	}
+
+	c.JSON(http.StatusOK, api.TokenizeResponse{Model: req.Model, Tokens: tokens, NumCtx: opts.NumCtx})
+}
+
 func (s *Server) EmbeddingsHandler(c *gin.Context) {
 	var req api.EmbeddingRequest
 	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
@@ -486,22 +520,40 @@ func (s *Server) PullHandler(c *gin.Context) {
 		return
 	}
 
+	if req.Store != "" {
+		if _, err := findStore(req.Store); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
+
+		// the pull is paused rather than left blocked if the client goes away
+		ctx := c.Request.Context()
+		send := func(v any) {
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+			}
+		}
+
 		fn := func(r api.ProgressResponse) {
-			ch <- r
+			send(r)
 		}
 
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Username: req.Username,
+			Password: req.Password,
+			MaxRate:  req.MaxRate,
+			Store:    req.Store,
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
-
-		if err := PullModel(ctx, name.DisplayShortest(), regOpts, fn); err != nil {
-			ch <- gin.H{"error": err.Error()}
+		if err := runPull(ctx, name.DisplayShortest(), regOpts, fn); err != nil {
+			send(gin.H{"error": err.Error()})
 		}
 	}()
 
@@ -513,6 +565,70 @@ func (s *Server) PullHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+func (s *Server) ListPullsHandler(c *gin.Context) {
+	pulls, err := listPulls()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListPullsResponse{Pulls: pulls})
+}
+
+func (s *Server) PausePullHandler(c *gin.Context) {
+	handlePullsRequest(c, pausePull)
+}
+
+func (s *Server) ResumePullHandler(c *gin.Context) {
+	handlePullsRequest(c, func(name string) error {
+		mp := ParseModelPath(name)
+		record, err := loadPullRecord(mp)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := runningPull(mp); !ok {
+			resumePull(record)
+		}
+
+		return nil
+	})
+}
+
+func (s *Server) CancelPullHandler(c *gin.Context) {
+	handlePullsRequest(c, cancelPull)
+}
+
+// handlePullsRequest applies fn to the pull named by a [api.PullsRequest]
+func handlePullsRequest(c *gin.Context, fn func(string) error) {
+	var req api.PullsRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := model.ParseName(req.Model)
+	if !name.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid model name"})
+		return
+	}
+
+	if err := fn(name.DisplayShortest()); errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("pull of '%s' not found", req.Model)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func (s *Server) PushHandler(c *gin.Context) {
 	var req api.PushRequest
 	err := c.ShouldBindJSON(&req)
@@ -544,6 +660,9 @@ func (s *Server) PushHandler(c *gin.Context) {
 
 		regOpts := &registryOptions{
 			Insecure: req.Insecure,
+			Username: req.Username,
+			Password: req.Password,
+			Sign:     req.Sign,
 		}
 
 		ctx, cancel := context.WithCancel(c.Request.Context())
@@ -562,6 +681,75 @@ func (s *Server) PushHandler(c *gin.Context) {
 	streamResponse(c, ch)
 }
 
+func (s *Server) LoginHandler(c *gin.Context) {
+	var req api.LoginRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	host := parseRegistryHost(req.Registry)
+	if host == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "registry is required"})
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "username and password are required"})
+		return
+	}
+
+	// check the credentials are accepted by the registry before storing them
+	requestURL := &url.URL{Scheme: "https", Host: host, Path: "/v2/"}
+	resp, err := makeRequestWithRetry(c.Request.Context(), http.MethodGet, requestURL, nil, nil, &registryOptions{
+		Insecure: req.Insecure,
+		Username: req.Username,
+		Password: req.Password,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("login to %s failed: %v", host, err)})
+		return
+	}
+	resp.Body.Close()
+
+	if err := storeCredentials(host, req.Username, req.Password); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) LogoutHandler(c *gin.Context) {
+	var req api.LogoutRequest
+	if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	host := parseRegistryHost(req.Registry)
+	if host == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "registry is required"})
+		return
+	}
+
+	if err := eraseCredentials(host); errors.Is(err, errCredentialsNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("not logged in to %s", host)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func checkNameExists(name model.Name) error {
 	names, err := Manifests()
 	if err != nil {
@@ -603,6 +791,14 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		return
 	}
 
+	if r.Imatrix != "" && r.Calibration != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "imatrix and calibration cannot both be set"})
+		return
+	} else if r.Imatrix != "" && cmp.Or(r.Quantize, r.Quantization) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "imatrix requires quantize"})
+		return
+	}
+
 	var sr io.Reader = strings.NewReader(r.Modelfile)
 	if r.Path != "" && r.Modelfile == "" {
 		f, err := os.Open(r.Path)
@@ -632,7 +828,7 @@ func (s *Server) CreateHandler(c *gin.Context) {
 		defer cancel()
 
 		quantization := cmp.Or(r.Quantize, r.Quantization)
-		if err := CreateModel(ctx, name, filepath.Dir(r.Path), strings.ToUpper(quantization), f, fn); errors.Is(err, errBadTemplate) {
+		if err := CreateModel(ctx, s.sched, name, filepath.Dir(r.Path), strings.ToUpper(quantization), r.Imatrix, r.Calibration, f, fn); errors.Is(err, errBadTemplate) {
 			ch <- gin.H{"error": err.Error(), "status": http.StatusBadRequest}
 		} else if err != nil {
 			ch <- gin.H{"error": err.Error()}
@@ -663,13 +859,35 @@ func (s *Server) DeleteHandler(c *gin.Context) {
 		return
 	}
 
+	// removing an alias leaves the model it points to
+	if _, ok := resolveAlias(n); ok {
+		if err := removeAlias(n); errors.Is(err, errReadOnlyStore) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
 	m, err := ParseNamedManifest(n)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := m.Remove(); err != nil {
+	// removing a model would leave the aliases which point to it dangling
+	if as, err := aliasesOf(n); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if len(as) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s, remove them or point them to another model first", errAliased, strings.Join(as, ", "))})
+		return
+	}
+
+	if err := m.Remove(); errors.Is(err, errReadOnlyStore) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -680,6 +898,33 @@ func (s *Server) DeleteHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) StorageHandler(c *gin.Context) {
+	resp, err := storageUsage()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) GCHandler(c *gin.Context) {
+	var req api.GCRequest
+	// the request body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := collectGarbage(req.DryRun)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) ShowHandler(c *gin.Context) {
 	var req api.ShowRequest
 	err := c.ShouldBindJSON(&req)
@@ -701,6 +946,13 @@ func (s *Server) ShowHandler(c *gin.Context) {
 		return
 	}
 
+	if req.Diff != "" {
+		if _, err := GetModel(req.Diff); os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Diff)})
+			return
+		}
+	}
+
 	resp, err := GetModelInfo(req)
 	if err != nil {
 		switch {
@@ -801,6 +1053,27 @@ func GetModelInfo(req api.ShowRequest) (*api.ShowResponse, error) {
 			return nil, err
 		}
 		resp.ProjectorInfo = projectorData
+
+		if tokens := projectorData.ImageTokens(); tokens > 0 {
+			resp.Vision = &api.VisionInfo{
+				ProjectorType:  projectorData.ProjectorType(),
+				ImageSize:      projectorData.ImageSize(),
+				PatchSize:      projectorData.PatchSize(),
+				ImageMean:      projectorData.ImageMean(),
+				ImageStd:       projectorData.ImageStd(),
+				GridPinpoints:  projectorData.ImageGridPinpoints(),
+				PatchMergeType: projectorData.PatchMergeType(),
+				MaxTiles:       projectorData.ImageTiles(),
+				TokensPerImage: tokens,
+			}
+		}
+	}
+
+	if req.Diff != "" {
+		resp.Diff, err = diffModels(req.Diff, req.Model)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return resp, nil
@@ -830,6 +1103,12 @@ func getKVData(digest string, verbose bool) (llm.KV, error) {
 }
 
 func (s *Server) ListHandler(c *gin.Context) {
+	filters, err := parseListFilters(c.QueryArray("filter"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ms, err := Manifests()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -837,6 +1116,7 @@ func (s *Server) ListHandler(c *gin.Context) {
 	}
 
 	models := []api.ListModelResponse{}
+	listed := make(map[model.Name]int)
 	for n, m := range ms {
 		var cf ConfigV2
 
@@ -855,6 +1135,7 @@ func (s *Server) ListHandler(c *gin.Context) {
 		}
 
 		// tag should never be masked
+		listed[n] = len(models)
 		models = append(models, api.ListModelResponse{
 			Model:      n.DisplayShortest(),
 			Name:       n.DisplayShortest(),
@@ -868,9 +1149,36 @@ func (s *Server) ListHandler(c *gin.Context) {
 				ParameterSize:     cf.ModelType,
 				QuantizationLevel: cf.FileType,
 			},
+			Labels: cf.Labels,
 		})
 	}
 
+	as, err := aliases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for n, a := range as {
+		target := model.ParseName(a.Target)
+		i, ok := listed[target]
+		if _, exists := ms[n]; exists || !ok {
+			// the alias is hidden by a model or points to nothing
+			continue
+		}
+
+		m := models[i]
+		m.Model = n.DisplayShortest()
+		m.Name = n.DisplayShortest()
+		m.ModifiedAt = a.modTime
+		m.Target = target.DisplayShortest()
+		models = append(models, m)
+	}
+
+	models = slices.DeleteFunc(models, func(m api.ListModelResponse) bool {
+		return !matchListFilters(filters, m.Details, m.Labels)
+	})
+
 	slices.SortStableFunc(models, func(i, j api.ListModelResponse) int {
 		// most recently modified first
 		return cmp.Compare(j.ModifiedAt.Unix(), i.ModifiedAt.Unix())
@@ -913,6 +1221,100 @@ func (s *Server) CopyHandler(c *gin.Context) {
 	}
 }
 
+func (s *Server) LabelsHandler(c *gin.Context) {
+	var r api.LabelsRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := model.ParseName(r.Model)
+	if !n.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q is invalid", r.Model)})
+		return
+	}
+
+	if err := setLabels(n, r.Labels); errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Model)})
+	} else if errors.Is(err, errInvalidLabel) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (s *Server) AliasHandler(c *gin.Context) {
+	var r api.AliasRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := model.ParseName(r.Alias)
+	if !n.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("alias %q is invalid", r.Alias)})
+		return
+	}
+
+	target := model.ParseName(r.Target)
+	if !target.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("target %q is invalid", r.Target)})
+		return
+	}
+
+	if err := checkNameExists(n); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := setAlias(n, target); errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Target)})
+	} else if errors.Is(err, errAliasTarget) || errors.Is(err, errAliasModel) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (s *Server) MoveHandler(c *gin.Context) {
+	var r api.MoveRequest
+	if err := c.ShouldBindJSON(&r); errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := model.ParseName(r.Model)
+	if !n.IsValid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q is invalid", r.Model)})
+		return
+	}
+
+	store, err := findStore(r.Store)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// moving an alias moves the model it points to under its own name
+	n, _ = resolveAlias(n)
+	if err := moveModel(n, store); errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %q not found", r.Model)})
+	} else if errors.Is(err, errReadOnlyStore) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 func (s *Server) HeadBlobHandler(c *gin.Context) {
 	path, err := GetBlobsPath(c.Param("digest"))
 	if err != nil {
@@ -1082,13 +1484,27 @@ func (s *Server) GenerateRoutes() http.Handler {
 	)
 
 	r.POST("/api/pull", s.PullHandler)
+	r.GET("/api/pulls", s.ListPullsHandler)
+	r.POST("/api/pulls/pause", s.PausePullHandler)
+	r.POST("/api/pulls/resume", s.ResumePullHandler)
+	r.POST("/api/pulls/cancel", s.CancelPullHandler)
+	r.GET("/api/storage", s.StorageHandler)
+	r.POST("/api/gc", s.GCHandler)
 	r.POST("/api/generate", s.GenerateHandler)
 	r.POST("/api/chat", s.ChatHandler)
 	r.POST("/api/embed", s.EmbedHandler)
 	r.POST("/api/embeddings", s.EmbeddingsHandler)
+	r.POST("/api/tokenize", s.TokenizeHandler)
+	r.POST("/api/inspect", s.InspectHandler)
+	r.POST("/api/estimate", s.EstimateHandler)
 	r.POST("/api/create", s.CreateHandler)
 	r.POST("/api/push", s.PushHandler)
+	r.POST("/api/login", s.LoginHandler)
+	r.POST("/api/logout", s.LogoutHandler)
 	r.POST("/api/copy", s.CopyHandler)
+	r.POST("/api/move", s.MoveHandler)
+	r.POST("/api/alias", s.AliasHandler)
+	r.POST("/api/labels", s.LabelsHandler)
 	r.DELETE("/api/delete", s.DeleteHandler)
 	r.POST("/api/show", s.ShowHandler)
 	r.POST("/api/blobs/:digest", s.CreateBlobHandler)
@@ -1116,13 +1532,12 @@ func (s *Server) GenerateRoutes() http.Handler {
 	return r
 }
 
-func Serve(ln net.Listener) error {
+func initLogging() {
 	level := slog.LevelInfo
 	if envconfig.Debug() {
 		level = slog.LevelDebug
 	}
 
-	slog.Info("server config", "env", envconfig.Values())
 	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level:     level,
 		AddSource: true,
@@ -1137,7 +1552,10 @@ func Serve(ln net.Listener) error {
 	})
 
 	slog.SetDefault(slog.New(handler))
+}
 
+// initStore fixes up and prunes the model store before it's served
+func initStore() error {
 	blobsDir, err := GetBlobsPath("")
 	if err != nil {
 		return err
@@ -1162,6 +1580,17 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
+	return nil
+}
+
+func Serve(ln net.Listener) error {
+	initLogging()
+	slog.Info("server config", "env", envconfig.Values())
+
+	if err := initStore(); err != nil {
+		return err
+	}
+
 	ctx, done := context.WithCancel(context.Background())
 	schedCtx, schedDone := context.WithCancel(ctx)
 	sched := InitScheduler(schedCtx)
@@ -1187,6 +1616,7 @@ func Serve(ln net.Listener) error {
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-signals
+		shuttingDown.Store(true)
 		srvr.Close()
 		schedDone()
 		sched.unloadAllRunners()
@@ -1205,7 +1635,11 @@ func Serve(ln net.Listener) error {
 	gpus := gpu.GetGPUInfo()
 	gpus.LogDetails()
 
-	err = srvr.Serve(ln)
+	if err := resumePulls(); err != nil {
+		slog.Warn("couldn't resume pulls", "error", err)
+	}
+
+	err := srvr.Serve(ln)
 	// If server is closed from the signal handler, wait for the ctx to be done
 	// otherwise error out quickly
 	if !errors.Is(err, http.ErrServerClosed) {
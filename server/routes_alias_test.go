@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	for _, name := range []string{"blue", "green"} {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:      name,
+			Modelfile: fmt.Sprintf("FROM %s\nSYSTEM %s", createBinFile(t, nil, nil), name),
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	w := createRequest(t, s.AliasHandler, api.AliasRequest{Alias: "prod", Target: "blue"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	system := func(t *testing.T, name string) string {
+		t.Helper()
+
+		m, err := GetModel(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return m.System
+	}
+
+	if got := system(t, "prod"); got != "blue" {
+		t.Errorf("expected prod to be blue, got %q", got)
+	}
+
+	w = createRequest(t, s.AliasHandler, api.AliasRequest{Alias: "prod", Target: "green"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	if got := system(t, "prod"); got != "green" {
+		t.Errorf("expected prod to be green, got %q", got)
+	}
+
+	green, err := ParseNamedManifest(model.ParseName("green"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := ParseNamedManifest(model.ParseName("prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prod.digest != green.digest {
+		t.Errorf("expected digest %s, got %s", green.digest, prod.digest)
+	}
+
+	w = createRequest(t, s.ListHandler, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	var resp api.ListResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Models) != 3 {
+		t.Fatalf("expected 3 models, actual %d", len(resp.Models))
+	}
+
+	for _, m := range resp.Models {
+		if m.Name == "prod:latest" && (m.Target != "green:latest" || m.Digest != green.digest) {
+			t.Errorf("expected prod to point to green, got %+v", m)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		req    api.AliasRequest
+		status int
+	}{
+		{"alias to alias", api.AliasRequest{Alias: "staging", Target: "prod"}, http.StatusBadRequest},
+		{"alias is a model", api.AliasRequest{Alias: "blue", Target: "green"}, http.StatusBadRequest},
+		{"missing target", api.AliasRequest{Alias: "staging", Target: "red"}, http.StatusNotFound},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := createRequest(t, s.AliasHandler, tt.req)
+			if w.Code != tt.status {
+				t.Errorf("expected status code %d, actual %d", tt.status, w.Code)
+			}
+		})
+	}
+
+	// removing the alias leaves the model
+	w = createRequest(t, s.DeleteHandler, api.DeleteRequest{Name: "prod"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	checkFileExists(t, filepath.Join(p, "aliases", "*", "*", "*", "*"), []string{})
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+		filepath.Join(p, "manifests", "registry.ollama.ai", "library", "blue", "latest"),
+		filepath.Join(p, "manifests", "registry.ollama.ai", "library", "green", "latest"),
+	})
+}
+
+func TestMoveAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stores := setStores(t, 2)
+
+	var s Server
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:      "blue",
+		Modelfile: fmt.Sprintf("FROM %s\nSYSTEM blue", createBinFile(t, nil, nil)),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.AliasHandler, api.AliasRequest{Alias: "prod", Target: "blue"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	w = createRequest(t, s.MoveHandler, api.MoveRequest{Model: "prod", Store: stores[1]})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	// the model is moved under its own name and the alias still points to it
+	checkFileExists(t, filepath.Join(stores[0], "manifests", "*", "*", "*", "*"), []string{})
+	checkFileExists(t, filepath.Join(stores[1], "manifests", "*", "*", "*", "*"), []string{
+		filepath.Join(stores[1], "manifests", "registry.ollama.ai", "library", "blue", "latest"),
+	})
+
+	if target, ok := resolveAlias(model.ParseName("prod")); !ok || target.DisplayShortest() != "blue:latest" {
+		t.Errorf("expected prod to point to blue, got %s", target.DisplayShortest())
+	}
+
+	m, err := GetModel("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.System != "blue" {
+		t.Errorf("expected prod to be blue, got %q", m.System)
+	}
+}
+
+func TestCopyAlias(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:      "blue",
+		Modelfile: fmt.Sprintf("FROM %s\nSYSTEM blue", createBinFile(t, nil, nil)),
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.AliasHandler, api.AliasRequest{Alias: "prod", Target: "blue"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	w = createRequest(t, s.CopyHandler, api.CopyRequest{Source: "prod", Destination: "backup"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	m, err := GetModel("backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.System != "blue" {
+		t.Errorf("expected backup to be blue, got %q", m.System)
+	}
+
+	// copying an alias onto the model it points to leaves the model as it is
+	w = createRequest(t, s.CopyHandler, api.CopyRequest{Source: "prod", Destination: "blue"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	if m, err := GetModel("blue"); err != nil {
+		t.Fatal(err)
+	} else if m.System != "blue" {
+		t.Errorf("expected blue to be unchanged, got %q", m.System)
+	}
+}
+
+func TestDeleteAliased(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+
+	var s Server
+
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name:      "blue",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, nil, nil)),
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d", w.Code)
+	}
+
+	for _, alias := range []string{"prod", "staging"} {
+		w := createRequest(t, s.AliasHandler, api.AliasRequest{Alias: alias, Target: "blue"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+	}
+
+	w = createRequest(t, s.DeleteHandler, api.DeleteRequest{Name: "blue"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code 400, actual %d", w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), "prod:latest, staging:latest") {
+		t.Errorf("expected the aliases in the error, got %s", w.Body.String())
+	}
+
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+		filepath.Join(p, "manifests", "registry.ollama.ai", "library", "blue", "latest"),
+	})
+
+	// once the aliases are removed so is the model
+	for _, name := range []string{"prod", "staging", "blue"} {
+		w := createRequest(t, s.DeleteHandler, api.DeleteRequest{Name: name})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200 deleting %s, actual %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{})
+}
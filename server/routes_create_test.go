@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
 )
 
 var stream bool = false
@@ -66,6 +68,7 @@ func createRequest(t *testing.T, fn func(*gin.Context), body any) *httptest.Resp
 	}
 
 	c.Request = &http.Request{
+		URL:  &url.URL{},
 		Body: io.NopCloser(&b),
 	}
 
@@ -616,3 +619,145 @@ func TestCreateDetectTemplate(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateImatrix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	var s Server
+
+	createBlob := func(t *testing.T, r io.Reader) string {
+		t.Helper()
+
+		layer, err := NewLayer(r, "application/octet-stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return layer.Digest
+	}
+
+	imatrixLayers := func(t *testing.T, name string) []string {
+		t.Helper()
+
+		m, err := ParseNamedManifest(model.ParseName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var digests []string
+		for _, layer := range m.Layers {
+			if layer.MediaType == "application/vnd.ollama.image.imatrix" {
+				digests = append(digests, layer.Digest)
+			}
+		}
+
+		return digests
+	}
+
+	var b bytes.Buffer
+	if _, err := (llm.Imatrix{"blk.0.attn_q.weight": {1, 2, 3, 4}}).WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	imatrix := createBlob(t, &b)
+
+	// quantizing an F16 model to F16 keeps it as it is
+	f16 := func(t *testing.T) string {
+		t.Helper()
+		return createBinFile(t, llm.KV{"general.file_type": uint32(1)}, nil)
+	}
+
+	t.Run("imatrix", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:      "test",
+			Modelfile: fmt.Sprintf("FROM %s", f16(t)),
+			Quantize:  "f16",
+			Imatrix:   imatrix,
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		if digests := imatrixLayers(t, "test"); !slices.Equal(digests, []string{imatrix}) {
+			t.Errorf("expected imatrix layer %s, actual %v", imatrix, digests)
+		}
+	})
+
+	t.Run("inherited", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:      "test2",
+			Modelfile: "FROM test",
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d", w.Code)
+		}
+
+		if digests := imatrixLayers(t, "test2"); !slices.Equal(digests, []string{imatrix}) {
+			t.Errorf("expected imatrix layer %s, actual %v", imatrix, digests)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:      "test3",
+			Modelfile: fmt.Sprintf("FROM %s", f16(t)),
+			Quantize:  "f16",
+			Imatrix:   createBlob(t, bytes.NewReader([]byte("not an imatrix"))),
+		})
+
+		if !bytes.Contains(w.Body.Bytes(), []byte("invalid imatrix")) {
+			t.Errorf("expected invalid imatrix error, actual %s", w.Body.String())
+		}
+	})
+
+	t.Run("both", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:        "test4",
+			Modelfile:   fmt.Sprintf("FROM %s", createBinFile(t, nil, nil)),
+			Imatrix:     imatrix,
+			Calibration: imatrix,
+			Stream:      &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+	})
+
+	t.Run("unquantized", func(t *testing.T) {
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:      "test5",
+			Modelfile: fmt.Sprintf("FROM %s", f16(t)),
+			Imatrix:   imatrix,
+			Stream:    &stream,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status code 400, actual %d", w.Code)
+		}
+
+		if !bytes.Contains(w.Body.Bytes(), []byte("requires quantize")) {
+			t.Errorf("expected quantize error, actual %s", w.Body.String())
+		}
+	})
+
+	t.Run("quantized base", func(t *testing.T) {
+		// the server has no scheduler, so this would panic if a runner was
+		// scheduled to compute the importance matrix
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{
+			Name:        "test6",
+			Modelfile:   fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{"general.file_type": uint32(2)}, nil)),
+			Calibration: createBlob(t, bytes.NewReader([]byte("calibration text"))),
+		})
+
+		if !bytes.Contains(w.Body.Bytes(), []byte("only be computed for F16 and F32 models")) {
+			t.Errorf("expected quantized base error, actual %s", w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/gpu"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestEstimate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_NUM_PARALLEL", "")
+	t.Setenv("OLLAMA_SCHED_SPREAD", "")
+
+	var gpus gpu.GpuInfoList
+	setGPUs := func(free ...uint64) {
+		gpus = make(gpu.GpuInfoList, len(free))
+		for i, f := range free {
+			gpus[i] = gpu.GpuInfo{Library: "cuda", ID: fmt.Sprint(i), MinimumMemory: 1 << 20}
+			gpus[i].FreeMemory = f
+		}
+	}
+
+	cpus := gpu.GpuInfoList{{Library: "cpu"}}
+	cpus[0].FreeMemory = 16 << 30
+
+	s := Server{
+		sched: &Scheduler{
+			getGpuFn: func() gpu.GpuInfoList { return gpus },
+			getCpuFn: func() gpu.GpuInfoList { return cpus },
+		},
+	}
+
+	tensor := func(name string, shape ...uint64) llm.Tensor {
+		size := uint64(2)
+		for _, n := range shape {
+			size *= n
+		}
+		return llm.Tensor{Name: name, Kind: 1, Shape: shape, WriterTo: bytes.NewReader(make([]byte, size))}
+	}
+
+	// the layers are large enough for a model to be split across GPUs
+	// without the graph filling them
+	tensors := []llm.Tensor{tensor("output.weight", 256, 4), tensor("token_embd.weight", 256, 4)}
+	for i := range 8 {
+		tensors = append(tensors, tensor(fmt.Sprintf("blk.%d.ffn_up.weight", i), 256, 4096))
+	}
+
+	var stream bool
+	w := createRequest(t, s.CreateHandler, api.CreateRequest{
+		Model: "test",
+		Modelfile: fmt.Sprintf("FROM %s", createBinFile(t, llm.KV{
+			"general.architecture":          "llama",
+			"llama.block_count":             uint32(8),
+			"llama.context_length":          uint32(32768),
+			"llama.embedding_length":        uint32(256),
+			"llama.attention.head_count":    uint32(8),
+			"llama.attention.head_count_kv": uint32(8),
+			"tokenizer.ggml.tokens":         []string{"a", "b", "c", "d"},
+		}, tensors)),
+		Stream: &stream,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	estimate := func(t *testing.T, req api.EstimateRequest) api.EstimateResponse {
+		t.Helper()
+		w := createRequest(t, s.EstimateHandler, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.EstimateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		setGPUs(8 << 30)
+		resp := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"num_ctx": 1024}})
+
+		if resp.Library != "cuda" || resp.NumCtx != 1024 || resp.NumParallel != 1 {
+			t.Errorf("expected an estimate for cuda with num_ctx 1024, got %+v", resp)
+		}
+
+		if resp.Layers != 9 || resp.TotalLayers != 9 {
+			t.Errorf("expected all 9 layers to fit, got %d/%d", resp.Layers, resp.TotalLayers)
+		}
+
+		// k,v = 2 bytes * num_ctx * blocks * (head_k + head_v) * heads_kv
+		if kv := uint64(2 * 1024 * 8 * (32 + 32) * 8); resp.KVSize != kv {
+			t.Errorf("expected a kv cache of %d, got %d", kv, resp.KVSize)
+		}
+
+		if len(resp.GPUs) != 1 || resp.GPUs[0].Layers != 9 || resp.GPUs[0].Size != resp.VRAMSize {
+			t.Errorf("expected the model on a single GPU, got %+v", resp.GPUs)
+		}
+
+		if resp.MaxNumCtx != 32768 {
+			t.Errorf("expected the trained context length to fit, got %d", resp.MaxNumCtx)
+		}
+	})
+
+	t.Run("f16 kv", func(t *testing.T) {
+		setGPUs(8 << 30)
+		f16 := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1})
+		f32 := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"f16_kv": false}})
+
+		if f32.KVSize != 2*f16.KVSize {
+			t.Errorf("expected the f32 kv cache to be twice %d, got %d", f16.KVSize, f32.KVSize)
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		setGPUs(8 << 30)
+		resp := estimate(t, api.EstimateRequest{Model: "test"})
+		if resp.NumParallel != defaultParallel {
+			t.Errorf("expected parallel %d, got %d", defaultParallel, resp.NumParallel)
+		}
+
+		one := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1})
+		if resp.KVSize != uint64(defaultParallel)*one.KVSize {
+			t.Errorf("expected the kv cache to be %d times %d, got %d", defaultParallel, one.KVSize, resp.KVSize)
+		}
+	})
+
+	t.Run("max num_ctx", func(t *testing.T) {
+		setGPUs(8 << 30)
+		want := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"num_ctx": 16384}})
+
+		// a GPU with too little memory for a context length of 16384 but
+		// enough for 8192
+		setGPUs(want.VRAMSize)
+		resp := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1})
+		if resp.MaxNumCtx < 8192 || resp.MaxNumCtx >= 16384 {
+			t.Fatalf("expected a max num_ctx between 8192 and 16384, got %d", resp.MaxNumCtx)
+		}
+
+		if resp := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"num_ctx": resp.MaxNumCtx}}); resp.Layers != 9 {
+			t.Errorf("expected num_ctx %d to fit, got %d layers", resp.NumCtx, resp.Layers)
+		}
+
+		if resp := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"num_ctx": resp.MaxNumCtx + 1}}); resp.Layers == 9 {
+			t.Errorf("expected num_ctx %d not to fit", resp.NumCtx)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		setGPUs(8 << 30)
+		want := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"num_batch": 32}})
+
+		// neither GPU fits the model on its own
+		setGPUs(want.VRAMSize*3/4, want.VRAMSize*3/4)
+		resp := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: map[string]any{"num_batch": 32}})
+		if resp.Layers != 9 || len(resp.GPUs) != 2 {
+			t.Fatalf("expected the model to be split across 2 GPUs, got %d layers on %+v", resp.Layers, resp.GPUs)
+		}
+
+		var layers int
+		for _, g := range resp.GPUs {
+			if g.Layers == 0 || g.Size > g.FreeMemory {
+				t.Errorf("expected layers within the free memory of GPU %s, got %+v", g.ID, g)
+			}
+			layers += g.Layers
+		}
+
+		if layers != resp.Layers {
+			t.Errorf("expected %d layers across the GPUs, got %d", resp.Layers, layers)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		setGPUs(8 << 30)
+		opts := map[string]any{"num_ctx": 32768, "num_batch": 32}
+		want := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: opts})
+
+		setGPUs(want.VRAMSize / 2)
+		resp := estimate(t, api.EstimateRequest{Model: "test", NumParallel: 1, Options: opts})
+		if resp.Layers == 0 || resp.Layers >= 9 || resp.VRAMSize >= resp.TotalSize {
+			t.Errorf("expected some of the layers on the GPU, got %+v", resp)
+		}
+
+		if resp.MaxNumCtx >= 32768 {
+			t.Errorf("expected a max num_ctx below 32768, got %d", resp.MaxNumCtx)
+		}
+	})
+
+	t.Run("cpu", func(t *testing.T) {
+		setGPUs(8 << 30)
+		resp := estimate(t, api.EstimateRequest{Model: "test", Options: map[string]any{"num_gpu": 0}})
+		if resp.Library != "cpu" || resp.Layers != 0 || resp.GPUs != nil {
+			t.Errorf("expected an estimate for cpu, got %+v", resp)
+		}
+
+		if resp.NumParallel != defaultParallel {
+			t.Errorf("expected parallel %d, got %d", defaultParallel, resp.NumParallel)
+		}
+
+		if resp.MaxNumCtx != 32768 {
+			t.Errorf("expected the trained context length to fit, got %d", resp.MaxNumCtx)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			model string
+			code  int
+		}{
+			{"", http.StatusBadRequest},
+			{"missing", http.StatusNotFound},
+		}
+
+		for _, tt := range cases {
+			w := createRequest(t, s.EstimateHandler, api.EstimateRequest{Model: tt.model})
+			if w.Code != tt.code {
+				t.Errorf("%q: expected status %d, got %d: %s", tt.model, tt.code, w.Code, w.Body.String())
+			}
+		}
+	})
+}
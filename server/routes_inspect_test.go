@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/gpu"
+	"github.com/ollama/ollama/llm"
+)
+
+func TestInspect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	gpus := gpu.GpuInfoList{{Library: "cuda", ID: "0", MinimumMemory: 1 << 20}}
+	gpus[0].FreeMemory = 8 << 30
+
+	s := Server{
+		sched: &Scheduler{
+			getGpuFn: func() gpu.GpuInfoList { return gpus },
+			getCpuFn: func() gpu.GpuInfoList { return gpu.GpuInfoList{{Library: "cpu"}} },
+		},
+	}
+
+	// files can only be inspected by clients on the same machine
+	local := func(c *gin.Context) {
+		c.Request.RemoteAddr = "127.0.0.1:54321"
+		s.InspectHandler(c)
+	}
+
+	tensor := func(name string, kind uint32, shape ...uint64) llm.Tensor {
+		size := uint64(4)
+		if kind == 1 {
+			size = 2
+		}
+		for _, n := range shape {
+			size *= n
+		}
+		return llm.Tensor{Name: name, Kind: kind, Shape: shape, WriterTo: bytes.NewReader(make([]byte, size))}
+	}
+
+	path := createBinFile(t, llm.KV{
+		"general.architecture":          "llama",
+		"llama.block_count":             uint32(2),
+		"llama.context_length":          uint32(4096),
+		"llama.embedding_length":        uint32(16),
+		"llama.attention.head_count":    uint32(4),
+		"llama.attention.head_count_kv": uint32(4),
+		"tokenizer.ggml.tokens":         []string{"a", "b", "c", "d"},
+	}, []llm.Tensor{
+		tensor("blk.0.attn_q.weight", 1, 16, 16),
+		tensor("blk.1.attn_q.weight", 1, 16, 16),
+		tensor("output.weight", 0, 16, 4),
+		tensor("token_embd.weight", 1, 16, 4),
+	})
+
+	t.Run("gguf", func(t *testing.T) {
+		w := createRequest(t, local, api.InspectRequest{Path: path, Options: map[string]any{"num_ctx": 1024}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.InspectResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Format != "gguf" {
+			t.Errorf("expected format gguf, got %s", resp.Format)
+		}
+
+		if resp.ParameterCount != 16*16*2+16*4*2 {
+			t.Errorf("expected %d parameters, got %d", 16*16*2+16*4*2, resp.ParameterCount)
+		}
+
+		if resp.ModelInfo["general.architecture"] != "llama" {
+			t.Errorf("expected architecture llama, got %v", resp.ModelInfo["general.architecture"])
+		}
+
+		want := []api.TensorInfo{
+			{Name: "blk.0.attn_q.weight", Type: "F16", Shape: []uint64{16, 16}},
+			{Name: "blk.1.attn_q.weight", Type: "F16", Shape: []uint64{16, 16}},
+			{Name: "output.weight", Type: "F32", Shape: []uint64{4, 16}},
+			{Name: "token_embd.weight", Type: "F16", Shape: []uint64{4, 16}},
+		}
+		if diff := cmp.Diff(want, resp.Tensors); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+
+		if resp.Memory == nil {
+			t.Fatal("expected a memory estimate")
+		}
+
+		if resp.Memory.Library != "cuda" || resp.Memory.NumCtx != 1024 {
+			t.Errorf("expected an estimate for cuda with num_ctx 1024, got %+v", resp.Memory)
+		}
+
+		if resp.Memory.Layers != 3 || resp.Memory.TotalLayers != 3 {
+			t.Errorf("expected all 3 layers to fit, got %d/%d", resp.Memory.Layers, resp.Memory.TotalLayers)
+		}
+
+		if resp.Memory.VRAMSize == 0 || resp.Memory.VRAMSize != resp.Memory.TotalSize {
+			t.Errorf("expected the model to be loaded in VRAM, got %+v", resp.Memory)
+		}
+	})
+
+	t.Run("cpu", func(t *testing.T) {
+		w := createRequest(t, local, api.InspectRequest{Path: path, Options: map[string]any{"num_gpu": 0}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.InspectResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Memory == nil || resp.Memory.Library != "cpu" || resp.Memory.Layers != 0 {
+			t.Errorf("expected an estimate for cpu, got %+v", resp.Memory)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		text := filepath.Join(t.TempDir(), "notes.txt")
+		if err := os.WriteFile(text, []byte("hello"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if w := createRequest(t, local, api.InspectRequest{}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+
+		// paths which aren't models are indistinguishable from missing ones
+		want := `{"error":"path must be the absolute path of a GGUF file or a safetensors model directory"}`
+		for _, path := range []string{"model.gguf", filepath.Join(t.TempDir(), "missing.gguf"), text, t.TempDir()} {
+			w := createRequest(t, local, api.InspectRequest{Path: path})
+			if w.Code != http.StatusBadRequest || w.Body.String() != want {
+				t.Errorf("%q: expected status 400 with %s, got %d: %s", path, want, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		remote := func(c *gin.Context) {
+			c.Request.RemoteAddr = "192.0.2.1:54321"
+			s.InspectHandler(c)
+		}
+
+		if w := createRequest(t, remote, api.InspectRequest{Path: path}); w.Code != http.StatusForbidden {
+			t.Errorf("expected status 403, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -63,3 +65,106 @@ func TestList(t *testing.T) {
 		t.Fatalf("expected slices to be equal %v", actualNames)
 	}
 }
+
+func TestListFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var s Server
+
+	create := func(t *testing.T, name, modelfile string) {
+		t.Helper()
+
+		w := createRequest(t, s.CreateHandler, api.CreateRequest{Name: name, Modelfile: modelfile})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	create(t, "search", fmt.Sprintf("FROM %s\nLABEL owner=search-team\nLABEL stage=prod", createBinFile(t, map[string]any{"general.architecture": "llama"}, nil)))
+	create(t, "search-canary", "FROM search\nLABEL stage=canary")
+	create(t, "chat", fmt.Sprintf("FROM %s\nLABEL owner=\"chat team\"", createBinFile(t, map[string]any{"general.architecture": "gemma"}, nil)))
+
+	list := func(t *testing.T, filters ...string) []string {
+		t.Helper()
+
+		w := NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{URL: &url.URL{RawQuery: url.Values{"filter": filters}.Encode()}}
+
+		s.ListHandler(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp api.ListResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, m := range resp.Models {
+			names = append(names, m.Name)
+		}
+
+		slices.Sort(names)
+		return names
+	}
+
+	cases := []struct {
+		filters []string
+		expect  []string
+	}{
+		{nil, []string{"chat:latest", "search-canary:latest", "search:latest"}},
+		{[]string{"label=owner=search-team"}, []string{"search-canary:latest", "search:latest"}},
+		{[]string{"label=owner=search-team", "label=stage=canary"}, []string{"search-canary:latest"}},
+		{[]string{"label=owner=chat team"}, []string{"chat:latest"}},
+		{[]string{"label=stage"}, []string{"search-canary:latest", "search:latest"}},
+		{[]string{"architecture=gemma"}, []string{"chat:latest"}},
+		{[]string{"family=LLAMA", "label=stage=prod"}, []string{"search:latest"}},
+		{[]string{"label=owner=nobody"}, nil},
+	}
+
+	for _, tt := range cases {
+		t.Run(strings.Join(tt.filters, ","), func(t *testing.T) {
+			if actual := list(t, tt.filters...); !slices.Equal(actual, tt.expect) {
+				t.Errorf("expected %v, actual %v", tt.expect, actual)
+			}
+		})
+	}
+
+	w := createRequest(t, s.LabelsHandler, api.LabelsRequest{Model: "search", Labels: map[string]string{"stage": "", "tier": "gold"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	if actual, expect := list(t, "label=tier=gold"), []string{"search:latest"}; !slices.Equal(actual, expect) {
+		t.Errorf("expected %v, actual %v", expect, actual)
+	}
+
+	if actual, expect := list(t, "label=stage"), []string{"search-canary:latest"}; !slices.Equal(actual, expect) {
+		t.Errorf("expected %v, actual %v", expect, actual)
+	}
+
+	m, err := GetModel("search")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if modelfile := m.String(); !strings.Contains(modelfile, "LABEL owner=search-team\nLABEL tier=gold\n") {
+		t.Errorf("expected labels in modelfile, got %s", modelfile)
+	}
+
+	w = createRequest(t, s.LabelsHandler, api.LabelsRequest{Model: "missing", Labels: map[string]string{"tier": "gold"}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code 404, actual %d", w.Code)
+	}
+
+	c, _ := gin.CreateTestContext(NewRecorder())
+	c.Request = &http.Request{URL: &url.URL{RawQuery: "filter=size=big"}}
+	s.ListHandler(c)
+	if c.Writer.Status() != http.StatusBadRequest {
+		t.Errorf("expected status code 400, actual %d", c.Writer.Status())
+	}
+}
@@ -68,7 +68,7 @@ func Test_Routes(t *testing.T) {
 		fn := func(resp api.ProgressResponse) {
 			t.Logf("Status: %s", resp.Status)
 		}
-		err = CreateModel(context.TODO(), model.ParseName(name), "", "", modelfile, fn)
+		err = CreateModel(context.TODO(), nil, model.ParseName(name), "", "", "", "", modelfile, fn)
 		require.NoError(t, err)
 	}
 
@@ -418,6 +418,82 @@ func TestShow(t *testing.T) {
 	}
 }
 
+func TestShowDiff(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var s Server
+
+	createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name: "base",
+		Modelfile: fmt.Sprintf(
+			"FROM %s\nTEMPLATE {{ .Prompt }}\nPARAMETER temperature 0.5\nPARAMETER top_k 10",
+			createBinFile(t, llm.KV{"general.architecture": "test", "test.context_length": uint32(2048)}, nil),
+		),
+	})
+
+	createRequest(t, s.CreateHandler, api.CreateRequest{
+		Name: "changed",
+		Modelfile: fmt.Sprintf(
+			"FROM %s\nTEMPLATE {{ .Prompt }}\nSYSTEM You are a pirate.\nPARAMETER temperature 0.8\nPARAMETER stop <end>",
+			createBinFile(t, llm.KV{"general.architecture": "test", "test.context_length": uint32(4096)}, nil),
+		),
+	})
+
+	w := createRequest(t, s.ShowHandler, api.ShowRequest{Model: "changed", Diff: "base"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code 200, actual %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp api.ShowResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Diff == nil || resp.Diff.Model != "base" {
+		t.Fatalf("expected a diff with base, got %v", resp.Diff)
+	}
+
+	changes := make(map[string]api.ModelChange)
+	for _, c := range resp.Diff.Changes {
+		changes[c.Section+" "+c.Key] = c
+	}
+
+	if _, ok := changes["modelfile "]; !ok {
+		t.Error("expected the Modelfile to change")
+	}
+
+	if _, ok := changes["template "]; ok {
+		t.Error("expected the template not to change")
+	}
+
+	cases := map[string]api.ModelChange{
+		"system ":                        {Section: "system", To: "You are a pirate."},
+		"parameters temperature":         {Section: "parameters", Key: "temperature", From: 0.5, To: 0.8},
+		"parameters top_k":               {Section: "parameters", Key: "top_k", From: float64(10)},
+		"parameters stop":                {Section: "parameters", Key: "stop", To: []any{"<end>"}},
+		"model_info test.context_length": {Section: "model_info", Key: "test.context_length", From: float64(2048), To: float64(4096)},
+	}
+
+	for k, want := range cases {
+		got, ok := changes[k]
+		if !ok {
+			t.Errorf("expected a change to %s", k)
+			continue
+		}
+
+		assert.Equal(t, want, got, k)
+	}
+
+	if c := changes["layers application/vnd.ollama.image.model"]; c.From == nil || c.To == nil {
+		t.Errorf("expected the model layer to change, got %v", c)
+	}
+
+	w = createRequest(t, s.ShowHandler, api.ShowRequest{Model: "changed", Diff: "missing"})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status code 404, actual %d", w.Code)
+	}
+}
+
 func TestNormalize(t *testing.T) {
 	type testCase struct {
 		input []float32
@@ -19,6 +19,7 @@ import (
 	"github.com/ollama/ollama/format"
 	"github.com/ollama/ollama/gpu"
 	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
 )
 
 type LlmRequest struct {
@@ -375,9 +376,16 @@ func (s *Scheduler) processCompleted(ctx context.Context) {
 			s.loadedMu.Lock()
 			slog.Debug("got lock to unload", "modelPath", runner.modelPath)
 			finished := runner.waitForVRAMRecovery()
+			m := runner.model
 			runner.unload()
 			delete(s.loaded, runner.modelPath)
 			s.loadedMu.Unlock()
+
+			// the model is promoted once it's unloaded so it isn't moved
+			// from under the runner
+			if m != nil && envconfig.PromoteModels() {
+				promoteModel(model.ParseName(m.Name))
+			}
 			slog.Debug("runner released", "modelPath", runner.modelPath)
 			runner.refMu.Unlock()
 
@@ -597,6 +605,12 @@ func (runner *runnerRef) needsReload(ctx context.Context, req *LlmRequest) bool
 	// Normalize the NumCtx for parallelism
 	optsExisting.NumCtx = optsExisting.NumCtx / runner.numParallel
 
+	// Compare the types the KV cache is stored as, which f16_kv and the
+	// defaults can give without setting them
+	optsExisting.CacheTypeK, optsExisting.CacheTypeV = llm.KVCacheTypes(*runner.Options)
+	optsNew.CacheTypeK, optsNew.CacheTypeV = llm.KVCacheTypes(req.opts)
+	optsExisting.F16KV, optsNew.F16KV = true, true
+
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	if !reflect.DeepEqual(runner.model.AdapterPaths, req.model.AdapterPaths) || // have the adapters changed?
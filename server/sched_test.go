@@ -613,6 +613,15 @@ func TestNeedsReload(t *testing.T) {
 	req.opts.NumGPU = -1
 	resp = runner.needsReload(ctx, req)
 	require.False(t, resp)
+	req.opts.CacheTypeK = "q8_0"
+	resp = runner.needsReload(ctx, req)
+	require.True(t, resp)
+	req.opts.CacheTypeK = "f16"
+	resp = runner.needsReload(ctx, req)
+	require.False(t, resp)
+	req.opts.F16KV = false
+	resp = runner.needsReload(ctx, req)
+	require.True(t, resp)
 }
 
 func TestUnloadAllRunners(t *testing.T) {
@@ -709,6 +718,8 @@ type mockLlm struct {
 	completionResp     error
 	embeddingResp      []float32
 	embeddingRespErr   error
+	imatrixResp        llm.Imatrix
+	imatrixRespErr     error
 	tokenizeResp       []int
 	tokenizeRespErr    error
 	detokenizeResp     string
@@ -730,6 +741,10 @@ func (s *mockLlm) Embedding(ctx context.Context, input string) ([]float32, error
 	return s.embeddingResp, s.embeddingRespErr
 }
 
+func (s *mockLlm) Imatrix(ctx context.Context, calibration string) (llm.Imatrix, error) {
+	return s.imatrixResp, s.imatrixRespErr
+}
+
 func (s *mockLlm) Tokenize(ctx context.Context, content string) ([]int, error) {
 	return s.tokenizeResp, s.tokenizeRespErr
 }
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/auth"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// Signatures are stored in the layout used by cosign: a manifest tagged with
+// the digest of the signed manifest whose layers are simple signing payloads
+// naming that digest, each annotated with a signature of the payload.
+const (
+	signatureMediaType     = "application/vnd.dev.cosign.simplesigning.v1+json"
+	signatureAnnotation    = "dev.cosignproject.cosign/signature"
+	signatureManifestType  = "application/vnd.oci.image.manifest.v1+json"
+	signatureConfigType    = "application/vnd.oci.image.config.v1+json"
+	maxSignaturePayloadLen = 64 << 10
+)
+
+var errSignatureNotFound = errors.New("manifest is not signed")
+
+type signaturePayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]any `json:"optional"`
+}
+
+// signatureTag returns the tag the signature of the manifest with digest is
+// pushed to
+func signatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// dockerReference returns the repository of mp a signature is made for
+func dockerReference(mp ModelPath) string {
+	return mp.Registry + "/" + mp.GetNamespaceRepository()
+}
+
+// pushSignature signs the manifest with digest with the ollama key and pushes
+// the signature to the repository of mp
+func pushSignature(ctx context.Context, mp ModelPath, digest string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
+	var payload signaturePayload
+	payload.Critical.Identity.DockerReference = dockerReference(mp)
+	payload.Critical.Image.DockerManifestDigest = digest
+	payload.Critical.Type = "cosign container image signature"
+
+	bts, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	signature, err := auth.SignBytes(bts)
+	if err != nil {
+		return err
+	}
+
+	layer, err := NewLayer(bytes.NewReader(bts), signatureMediaType)
+	if err != nil {
+		return err
+	}
+
+	layer.Annotations = map[string]string{signatureAnnotation: base64.StdEncoding.EncodeToString(signature)}
+
+	config, err := NewLayer(strings.NewReader("{}"), signatureConfigType)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range []Layer{layer, config} {
+		if err := uploadBlob(ctx, mp, layer, regOpts, fn); err != nil {
+			return err
+		}
+	}
+
+	manifestJSON, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     signatureManifestType,
+		Config:        config,
+		Layers:        []Layer{layer},
+	})
+	if err != nil {
+		return err
+	}
+
+	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", signatureTag(digest))
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", signatureManifestType)
+	resp, err := makeRequestWithRetry(ctx, http.MethodPut, requestURL, headers, bytes.NewReader(manifestJSON), regOpts)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// signature is a payload and its signature
+type signature struct {
+	payload   []byte
+	signature []byte
+}
+
+// pullSignatures returns the signatures of the manifest with digest
+func pullSignatures(ctx context.Context, mp ModelPath, e registryEndpoint, digest string) ([]signature, error) {
+	requestURL := e.url.JoinPath("v2", mp.GetNamespaceRepository(), "manifests", signatureTag(digest))
+
+	headers := make(http.Header)
+	headers.Set("Accept", signatureManifestType+", application/vnd.docker.distribution.manifest.v2+json")
+	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, e.regOpts)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errSignatureNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	// each signature is a separate layer
+	var signatures []signature
+	for _, layer := range m.Layers {
+		if layer.MediaType != signatureMediaType || layer.Size > maxSignaturePayloadLen {
+			continue
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[signatureAnnotation])
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature: %w", err)
+		}
+
+		payload, err := pullSignaturePayload(ctx, mp, e, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		signatures = append(signatures, signature{payload: payload, signature: sig})
+	}
+
+	if len(signatures) == 0 {
+		return nil, errSignatureNotFound
+	}
+
+	return signatures, nil
+}
+
+func pullSignaturePayload(ctx context.Context, mp ModelPath, e registryEndpoint, digest string) ([]byte, error) {
+	requestURL := e.url.JoinPath("v2", mp.GetNamespaceRepository(), "blobs", digest)
+	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, nil, nil, e.regOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, maxSignaturePayloadLen))
+	if err != nil {
+		return nil, err
+	}
+
+	if got := fmt.Sprintf("sha256:%x", sha256.Sum256(payload)); got != digest {
+		return nil, fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, got)
+	}
+
+	return payload, nil
+}
+
+// trustPolicy lists the keys trusted to sign models by namespace. It's read
+// from the file named by OLLAMA_TRUST_POLICY, e.g.
+//
+//	[namespace."registry.ollama.ai/myteam"]
+//	mode = "enforce"
+//	keys = ["ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAA..."]
+type trustPolicy struct {
+	Namespace map[string]trustNamespace `toml:"namespace"`
+}
+
+type trustNamespace struct {
+	// Mode is either "enforce", in which case models which aren't signed
+	// by one of the keys are not pulled, or "warn", in which case they're
+	// pulled with a warning
+	Mode string `toml:"mode"`
+
+	// Keys are ed25519 public keys in authorized_keys format, as printed
+	// for the ollama key
+	Keys []string `toml:"keys"`
+}
+
+func loadTrustPolicy(path string) (*trustPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var policy trustPolicy
+	if err := toml.NewDecoder(f).DisallowUnknownFields().Decode(&policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, ns := range policy.Namespace {
+		if ns.Mode != "enforce" && ns.Mode != "warn" {
+			return nil, fmt.Errorf("%s: namespace %q: invalid mode %q", path, name, ns.Mode)
+		}
+	}
+
+	return &policy, nil
+}
+
+// verify checks one of the signatures is of a payload naming the manifest
+// with digest in the repository of mp and was made by one of the namespace's
+// keys
+func (ns trustNamespace) verify(mp ModelPath, digest string, signatures []signature) error {
+	var keys []ed25519.PublicKey
+	for _, key := range ns.Keys {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", key, err)
+		}
+
+		cryptoPub, ok := pub.(ssh.CryptoPublicKey)
+		if !ok {
+			return fmt.Errorf("invalid key %q", key)
+		}
+
+		ed25519Pub, ok := cryptoPub.CryptoPublicKey().(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key %q is not an ed25519 key", key)
+		}
+
+		keys = append(keys, ed25519Pub)
+	}
+
+	for _, s := range signatures {
+		var payload signaturePayload
+		if err := json.Unmarshal(s.payload, &payload); err != nil {
+			return fmt.Errorf("invalid signature payload: %w", err)
+		}
+
+		// the signature of another manifest, or of this manifest in another
+		// repository, may be pushed to this one's tag
+		if payload.Critical.Image.DockerManifestDigest != digest ||
+			payload.Critical.Identity.DockerReference != dockerReference(mp) {
+			continue
+		}
+
+		for _, key := range keys {
+			if ed25519.Verify(key, s.payload, s.signature) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("manifest is not signed by a trusted key")
+}
+
+// verifyManifestSignature checks the manifest of mp with digest is signed by a
+// key trusted for its namespace. Models in namespaces without a policy aren't
+// verified.
+func verifyManifestSignature(ctx context.Context, mp ModelPath, endpoints []registryEndpoint, digest string, fn func(api.ProgressResponse)) error {
+	policy, err := loadTrustPolicy(envconfig.TrustPolicy())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ns, ok := policy.Namespace[mp.Registry+"/"+mp.Namespace]
+	if !ok {
+		return nil
+	}
+
+	fn(api.ProgressResponse{Status: "verifying signature"})
+
+	signatures, err := firstEndpoint(ctx, endpoints, func(e registryEndpoint) ([]signature, error) {
+		return pullSignatures(ctx, mp, e, digest)
+	})
+	if err == nil {
+		err = ns.verify(mp, digest, signatures)
+	}
+
+	if err != nil {
+		if ns.Mode == "warn" {
+			slog.Warn("signature verification failed", "model", mp.GetFullTagname(), "error", err)
+			fn(api.ProgressResponse{Status: fmt.Sprintf("warning: signature verification failed: %v", err)})
+			return nil
+		}
+
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// newTestKey writes a new ollama key to the home directory and returns its
+// public key in authorized_keys format
+func newTestKey(t *testing.T) string {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ollama"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".ollama", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPub)))
+}
+
+func TestPullVerifySignature(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", os.Getenv("HOME"))
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_REGISTRIES", filepath.Join(t.TempDir(), "registries.toml"))
+	t.Setenv("OLLAMA_TRUST_POLICY", filepath.Join(t.TempDir(), "trust.toml"))
+
+	s := httptest.NewServer((&Server{registryPush: url.UserPassword("user", "pass")}).RegistryRoutes())
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := newTestKey(t)
+
+	layer, err := NewLayer(bytes.NewReader([]byte("the quick brown fox jumps over the lazy dog")), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(bytes.NewReader([]byte(`{"model_format":"gguf"}`)), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(t *testing.T, name string, sign bool) {
+		t.Helper()
+
+		if err := WriteManifest(model.ParseName(name), config, []Layer{layer}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := PushModel(context.Background(), name, &registryOptions{Insecure: true, Sign: sign, Username: "user", Password: "pass"}, func(api.ProgressResponse) {}); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := ParseNamedManifest(model.ParseName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Remove(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signed := u.Host + "/library/signed:latest"
+	push(t, signed, true)
+
+	unsigned := u.Host + "/library/unsigned:latest"
+	push(t, unsigned, false)
+
+	// the same manifest in another repository with the signature made for
+	// the first copied to it
+	replayed := u.Host + "/library/replayed:latest"
+	push(t, replayed, false)
+
+	sigs := mustGlob(t, filepath.Join(envconfig.Models(), "manifests", "registry.ollama.ai", "library", "signed", "*.sig"))
+	if len(sigs) != 1 {
+		t.Fatalf("expected a signature, got %v", sigs)
+	}
+
+	sig, err := os.ReadFile(sigs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(envconfig.Models(), "manifests", "registry.ollama.ai", "library", "replayed", filepath.Base(sigs[0])), sig, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := func(t *testing.T, mode, key string) {
+		t.Helper()
+
+		if err := os.WriteFile(envconfig.TrustPolicy(), []byte(fmt.Sprintf(`
+[namespace."%s/library"]
+mode = %q
+keys = [%q]
+`, u.Host, mode, key)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pull := func(t *testing.T, name string) error {
+		t.Helper()
+
+		err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, func(api.ProgressResponse) {})
+		if m, err := ParseNamedManifest(model.ParseName(name)); err == nil {
+			if err := m.Remove(); err != nil {
+				t.Fatal(err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+
+		return err
+	}
+
+	exists := func(name string) bool {
+		_, err := ParseNamedManifest(model.ParseName(name))
+		return err == nil
+	}
+
+	t.Run("trusted", func(t *testing.T) {
+		policy(t, "enforce", key)
+		if err := pull(t, signed); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		policy(t, "enforce", key)
+		if err := pull(t, unsigned); err == nil {
+			t.Fatal("expected unsigned model to fail verification")
+		}
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		policy(t, "enforce", key)
+		if err := pull(t, replayed); err == nil {
+			t.Fatal("expected a signature for another repository to fail verification")
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		other := newTestKey(t)
+		policy(t, "enforce", other)
+
+		err := PullModel(context.Background(), signed, &registryOptions{Insecure: true}, func(api.ProgressResponse) {})
+		if err == nil {
+			t.Fatal("expected model signed by another key to fail verification")
+		}
+
+		if exists(signed) {
+			t.Error("expected manifest not to be written")
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		policy(t, "warn", key)
+		if err := pull(t, unsigned); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPullModelManifestDigest(t *testing.T) {
+	// trailing whitespace which a JSON decoder would leave unread
+	manifest := append([]byte("{\n  \"schemaVersion\": 2,\n  \"layers\": []\n}"), bytes.Repeat([]byte("\n"), 64<<10)...)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(manifest)
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := pullModelManifest(context.Background(), ParseModelPath("library/test"), registryEndpoint{url: u, regOpts: &registryOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("%x", sha256.Sum256(manifest)); m.digest != want {
+		t.Errorf("expected digest %s, got %s", want, m.digest)
+	}
+}
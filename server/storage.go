@@ -0,0 +1,289 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+// gcGracePeriod is how long unused blobs are kept before they're collected.
+// Blobs are written before the manifests which use them, e.g. while a model
+// is being created, so new blobs may be about to be used.
+const gcGracePeriod = time.Hour
+
+// storedBlob is a blob in the store. A partial download may be several files.
+type storedBlob struct {
+	digest  string
+	size    int64
+	modTime time.Time
+	files   []string
+}
+
+// storeIndex is what uses each blob in the store
+type storeIndex struct {
+	blobs    map[string]*storedBlob
+	partials map[string]*storedBlob
+
+	// models are the digests of the blobs each model uses
+	models map[model.Name][]string
+
+	// stores are the model stores each model is in
+	stores map[model.Name]string
+
+	// references are the number of models using each blob
+	references map[string]int
+
+	// pulls are the models being pulled which use each blob
+	pulls map[string]string
+}
+
+func indexStore() (*storeIndex, error) {
+	if _, err := GetBlobsPath(""); err != nil {
+		return nil, err
+	}
+
+	files, err := storeGlob("*")
+	if err != nil {
+		return nil, err
+	}
+
+	idx := storeIndex{
+		blobs:      make(map[string]*storedBlob),
+		partials:   make(map[string]*storedBlob),
+		models:     make(map[model.Name][]string),
+		stores:     make(map[model.Name]string),
+		references: make(map[string]int),
+		pulls:      make(map[string]string),
+	}
+
+	for _, file := range files {
+		digest, _, partial := strings.Cut(strings.ReplaceAll(filepath.Base(file), "-", ":"), ":partial")
+		if _, err := GetBlobsPath(digest); digest == "" || err != nil {
+			// not a blob, e.g. an upload to the registry
+			continue
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		blobs := idx.blobs
+		if partial {
+			blobs = idx.partials
+		}
+
+		b, ok := blobs[digest]
+		if !ok {
+			b = &storedBlob{digest: digest}
+			blobs[digest] = b
+		}
+
+		b.files = append(b.files, file)
+		if fi.ModTime().After(b.modTime) {
+			b.modTime = fi.ModTime()
+		}
+
+		if !partial {
+			// a blob in several stores takes space in each
+			b.size += fi.Size()
+		}
+	}
+
+	// partial downloads are sparse so they're counted by what's downloaded
+	for _, b := range idx.partials {
+		b.size = layerProgress(Layer{Digest: b.digest})
+	}
+
+	manifests, err := Manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	for n, m := range manifests {
+		idx.stores[n] = storeOf(m.filepath)
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer.Digest == "" || slices.Contains(idx.models[n], layer.Digest) {
+				continue
+			}
+
+			idx.models[n] = append(idx.models[n], layer.Digest)
+			idx.references[layer.Digest]++
+		}
+	}
+
+	records, err := pullRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		for _, layer := range record.Layers {
+			idx.pulls[layer.Digest] = ParseModelPath(record.Model).GetShortTagname()
+		}
+	}
+
+	return &idx, nil
+}
+
+func sortBlobs(blobs []api.BlobStorage) {
+	slices.SortFunc(blobs, func(a, b api.BlobStorage) int {
+		return cmp.Compare(a.Digest, b.Digest)
+	})
+}
+
+// storageUsage reports the space used by each model, and by blobs which
+// aren't used by any model
+func storageUsage() (*api.StorageResponse, error) {
+	idx, err := indexStore()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := api.StorageResponse{
+		Path:     strings.Join(envconfig.ModelStores(), string(filepath.ListSeparator)),
+		Models:   []api.ModelStorage{},
+		Orphaned: []api.BlobStorage{},
+		Partial:  []api.BlobStorage{},
+	}
+
+	for n, digests := range idx.models {
+		m := api.ModelStorage{Name: n.DisplayShortest(), Store: idx.stores[n]}
+		for _, digest := range digests {
+			b, ok := idx.blobs[digest]
+			if !ok {
+				continue
+			}
+
+			if idx.references[digest] > 1 {
+				m.Shared += b.size
+			} else {
+				m.Exclusive += b.size
+			}
+		}
+
+		m.Size = m.Exclusive + m.Shared
+		resp.Models = append(resp.Models, m)
+	}
+
+	for digest, b := range idx.blobs {
+		resp.Size += b.size
+		if idx.references[digest] == 0 && idx.pulls[digest] == "" {
+			resp.Orphaned = append(resp.Orphaned, api.BlobStorage{Digest: digest, Size: b.size})
+		}
+	}
+
+	for digest, b := range idx.partials {
+		resp.Size += b.size
+		resp.Partial = append(resp.Partial, api.BlobStorage{Digest: digest, Size: b.size, Pull: idx.pulls[digest]})
+	}
+
+	slices.SortFunc(resp.Models, func(a, b api.ModelStorage) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	sortBlobs(resp.Orphaned)
+	sortBlobs(resp.Partial)
+
+	return &resp, nil
+}
+
+// collectGarbage removes blobs which aren't used by any model or pull,
+// copies of blobs in stores none of whose models use them, and partial
+// downloads which won't be resumed. With dryRun it only reports what
+// would be removed.
+func collectGarbage(dryRun bool) (*api.GCResponse, error) {
+	idx, err := indexStore()
+	if err != nil {
+		return nil, err
+	}
+
+	var garbage []*storedBlob
+	for digest, b := range idx.blobs {
+		if idx.references[digest] == 0 && idx.pulls[digest] == "" && time.Since(b.modTime) > gcGracePeriod {
+			garbage = append(garbage, b)
+		}
+	}
+
+	// copies of blobs left in a store by models promoted from it are
+	// removed once a store whose models use the blob has a copy
+	used := make(map[string]map[string]bool)
+	for n, digests := range idx.models {
+		store := idx.stores[n]
+		if used[store] == nil {
+			used[store] = make(map[string]bool)
+		}
+
+		for _, digest := range digests {
+			used[store][digest] = true
+		}
+	}
+
+	for digest, b := range idx.blobs {
+		if idx.references[digest] == 0 || idx.pulls[digest] != "" {
+			continue
+		}
+
+		var kept, stale []string
+		for _, file := range b.files {
+			if used[storeOf(file)][digest] {
+				kept = append(kept, file)
+			} else {
+				stale = append(stale, file)
+			}
+		}
+
+		if len(kept) > 0 && len(stale) > 0 {
+			size := b.size / int64(len(b.files)) * int64(len(stale))
+			garbage = append(garbage, &storedBlob{digest: digest, size: size, modTime: b.modTime, files: stale})
+		}
+	}
+
+	for digest, b := range idx.partials {
+		if _, ok := blobDownloadManager.Load(digest); ok {
+			continue
+		}
+
+		if idx.pulls[digest] == "" && time.Since(b.modTime) > gcGracePeriod {
+			garbage = append(garbage, b)
+		}
+	}
+
+	resp := api.GCResponse{Removed: []api.BlobStorage{}}
+	for _, b := range garbage {
+		if !dryRun {
+			for _, file := range b.files {
+				if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return nil, err
+				}
+			}
+		}
+
+		resp.Removed = append(resp.Removed, api.BlobStorage{Digest: b.digest, Size: b.size})
+		resp.Size += b.size
+	}
+
+	sortBlobs(resp.Removed)
+
+	if !dryRun {
+		if _, err := GetManifestPath(); err != nil {
+			return nil, err
+		}
+
+		for _, store := range envconfig.ModelStores() {
+			manifests := filepath.Join(store, "manifests")
+			if err := PruneDirectory(manifests); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+func mustGlob(t *testing.T, pattern string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return matches
+}
+
+func TestStorage(t *testing.T) {
+	models := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", models)
+
+	newLayer := func(t *testing.T, content string) Layer {
+		t.Helper()
+
+		layer, err := NewLayer(strings.NewReader(content), "application/vnd.ollama.image.model")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return layer
+	}
+
+	// age makes a blob's files older than the grace period
+	age := func(t *testing.T, pattern string) {
+		t.Helper()
+
+		old := time.Now().Add(-2 * gcGracePeriod)
+		for _, p := range mustGlob(t, pattern) {
+			if err := os.Chtimes(p, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	shared := newLayer(t, "shared")
+	config := newLayer(t, "{}")
+	only := newLayer(t, "only in one")
+
+	if err := WriteManifest(model.ParseName("one"), config, []Layer{shared, only}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteManifest(model.ParseName("two"), config, []Layer{shared}); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := newLayer(t, "orphaned")
+	fresh := newLayer(t, "just created")
+
+	// a partial download with no pull and one of a pull which will resume
+	partial := func(t *testing.T, digest string, completed int64) {
+		t.Helper()
+
+		fp, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(fp+"-partial", bytes.Repeat([]byte{0}, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		bts, err := json.Marshal(jsonBlobDownloadPart{Size: 100, Completed: completed})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(fp+"-partial-0", bts, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	abandoned := "sha256:" + strings.Repeat("a", 64)
+	pulling := "sha256:" + strings.Repeat("b", 64)
+	partial(t, abandoned, 30)
+	partial(t, pulling, 40)
+
+	record := pullRecord{Model: "three", Layers: []Layer{{Digest: pulling, Size: 100}}}
+	if err := record.save(ParseModelPath("three")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, digest := range []string{orphan.Digest, abandoned, pulling} {
+		fp, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		age(t, fp+"*")
+	}
+
+	storage, err := storageUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantShared := shared.Size + config.Size
+	want := []api.ModelStorage{
+		{Name: "one:latest", Store: models, Size: wantShared + only.Size, Exclusive: only.Size, Shared: wantShared},
+		{Name: "two:latest", Store: models, Size: wantShared, Shared: wantShared},
+	}
+
+	if len(storage.Models) != len(want) {
+		t.Fatalf("expected %d models, got %+v", len(want), storage.Models)
+	}
+
+	for i := range want {
+		if storage.Models[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], storage.Models[i])
+		}
+	}
+
+	if len(storage.Orphaned) != 2 {
+		t.Errorf("expected 2 orphaned blobs, got %+v", storage.Orphaned)
+	}
+
+	if len(storage.Partial) != 2 || storage.Partial[0].Size != 30 || storage.Partial[1].Pull != "three:latest" {
+		t.Errorf("unexpected partial downloads %+v", storage.Partial)
+	}
+
+	if wantSize := shared.Size + config.Size + only.Size + orphan.Size + fresh.Size + 70; storage.Size != wantSize {
+		t.Errorf("expected size %d, got %d", wantSize, storage.Size)
+	}
+
+	dryRun, err := collectGarbage(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new blobs and partial downloads of pulls are kept
+	wantRemoved := []string{abandoned, orphan.Digest}
+	if orphan.Digest < abandoned {
+		wantRemoved = []string{orphan.Digest, abandoned}
+	}
+
+	if len(dryRun.Removed) != 2 || dryRun.Removed[0].Digest != wantRemoved[0] || dryRun.Removed[1].Digest != wantRemoved[1] {
+		t.Fatalf("expected %v to be removed, got %+v", wantRemoved, dryRun.Removed)
+	}
+
+	if dryRun.Size != orphan.Size+30 {
+		t.Errorf("expected %d bytes reclaimed, got %d", orphan.Size+30, dryRun.Size)
+	}
+
+	if err := verifyBlob(orphan.Digest); err != nil {
+		t.Fatalf("expected dry run to keep blob: %v", err)
+	}
+
+	gc, err := collectGarbage(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gc.Removed) != 2 {
+		t.Fatalf("expected 2 blobs removed, got %+v", gc.Removed)
+	}
+
+	for _, digest := range []string{orphan.Digest, abandoned} {
+		fp, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if matches := mustGlob(t, fp+"*"); len(matches) > 0 {
+			t.Errorf("expected %s to be removed, got %v", digest, matches)
+		}
+	}
+
+	for _, digest := range []string{shared.Digest, only.Digest, config.Digest, fresh.Digest} {
+		fp, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(fp); errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be kept", digest)
+		}
+	}
+
+	fp, err := GetBlobsPath(pulling)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matches := mustGlob(t, fp+"-partial*"); len(matches) != 2 {
+		t.Errorf("expected the partial download of a pull to be kept, got %v", matches)
+	}
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+var (
+	errUnknownStore  = errors.New("unknown model store")
+	errReadOnlyStore = errors.New("model is in a read-only base model store")
+)
+
+// allStores returns the model stores followed by the read-only base model
+// stores
+func allStores() []string {
+	return append(envconfig.ModelStores(), envconfig.BaseModels()...)
+}
+
+// isBaseStore reports whether path is in a read-only base model store
+func isBaseStore(path string) bool {
+	for _, store := range envconfig.BaseModels() {
+		if rel, err := filepath.Rel(store, path); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writableStoreOf returns the model store which contains path, or the first
+// model store if path is in a base model store
+func writableStoreOf(path string) string {
+	if isBaseStore(path) {
+		return envconfig.Models()
+	}
+
+	return storeOf(path)
+}
+
+// findStore returns the model store named by path, which must be one of the
+// directories in OLLAMA_MODELS
+func findStore(path string) (string, error) {
+	for _, store := range envconfig.ModelStores() {
+		if filepath.Clean(store) == filepath.Clean(path) {
+			return store, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w %q, expected one of %s", errUnknownStore, path, strings.Join(envconfig.ModelStores(), ", "))
+}
+
+// storeOf returns the model store which contains path
+func storeOf(path string) string {
+	for _, store := range allStores() {
+		if rel, err := filepath.Rel(store, path); err == nil && filepath.IsLocal(rel) {
+			return store
+		}
+	}
+
+	return envconfig.Models()
+}
+
+// pullStore returns the model store mp is pulled to: the one it's already in,
+// otherwise store if it's set, or OLLAMA_PULL_STORE
+func pullStore(mp ModelPath, store string) (string, error) {
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(fp); err == nil && store == "" && !isBaseStore(fp) {
+		return storeOf(fp), nil
+	}
+
+	if store = cmp.Or(store, envconfig.PullStore()); store != "" {
+		return findStore(store)
+	}
+
+	return envconfig.Models(), nil
+}
+
+// storeBlobsPath returns the path of the blob with digest in store
+func storeBlobsPath(store, digest string) (string, error) {
+	if _, err := GetBlobsPath(digest); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(store, "blobs", strings.ReplaceAll(digest, ":", "-"))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// storeGlob returns the files matching pattern in the blobs directory of
+// every model store. Base model stores are left out since their files are
+// never removed.
+func storeGlob(pattern string) ([]string, error) {
+	var matches []string
+	for _, store := range envconfig.ModelStores() {
+		storeMatches, err := filepath.Glob(filepath.Join(store, "blobs", pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		matches = append(matches, storeMatches...)
+	}
+
+	return matches, nil
+}
+
+// blobPaths returns the path of every copy of the blob with digest outside
+// the base model stores
+func blobPaths(digest string) ([]string, error) {
+	if _, err := GetBlobsPath(digest); err != nil {
+		return nil, err
+	}
+
+	return storeGlob(strings.ReplaceAll(digest, ":", "-"))
+}
+
+// copyFile copies src to dst. dst is written to a temporary file first so
+// it's never incomplete.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+"-copy-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
+
+// transferModel copies the blobs of n to store and moves its manifest there,
+// leaving the copies of the blobs in the store it was in. It returns that
+// store and the digests of the blobs.
+func transferModel(n model.Name, store string) (from string, digests []string, _ error) {
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if isBaseStore(m.filepath) {
+		return "", nil, errReadOnlyStore
+	}
+
+	from = storeOf(m.filepath)
+	if from == store {
+		return from, nil, nil
+	}
+
+	for _, layer := range append(m.Layers, m.Config) {
+		if layer.Digest == "" {
+			continue
+		}
+
+		src, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return "", nil, err
+		}
+
+		dst, err := storeBlobsPath(store, layer.Digest)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if _, err := os.Stat(dst); errors.Is(err, os.ErrNotExist) {
+			if err := copyFile(src, dst); err != nil {
+				return "", nil, err
+			}
+		} else if err != nil {
+			return "", nil, err
+		}
+
+		digests = append(digests, layer.Digest)
+	}
+
+	// the manifest is copied as it is so its digest is unchanged
+	dst := filepath.Join(store, "manifests", n.Filepath())
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", nil, err
+	}
+
+	if err := copyFile(m.filepath, dst); err != nil {
+		return "", nil, err
+	}
+
+	if err := m.Remove(); err != nil {
+		return "", nil, err
+	}
+
+	return from, digests, nil
+}
+
+// moveModel moves the manifest and blobs of n to store. Blobs which are
+// also used by other models in the store n is moved from are copied rather
+// than moved.
+func moveModel(n model.Name, store string) error {
+	from, digests, err := transferModel(n, store)
+	if err != nil || from == store {
+		return err
+	}
+
+	// remove the copies of blobs no other model in the old store uses
+	manifests, err := Manifests()
+	if err != nil {
+		return err
+	}
+
+	inUse := make(map[string]bool)
+	for _, m := range manifests {
+		if storeOf(m.filepath) == from {
+			for _, layer := range append(m.Layers, m.Config) {
+				inUse[layer.Digest] = true
+			}
+		}
+	}
+
+	for _, digest := range digests {
+		if inUse[digest] {
+			continue
+		}
+
+		p := filepath.Join(from, "blobs", strings.ReplaceAll(digest, ":", "-"))
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var promotions sync.Map
+
+// promoteModel moves n to the first model store in the background if it's
+// in another
+func promoteModel(n model.Name) {
+	if !n.IsValid() || len(envconfig.ModelStores()) < 2 {
+		return
+	}
+
+	if fp := findInStores("manifests", n.Filepath()); storeOf(fp) == envconfig.Models() || isBaseStore(fp) {
+		return
+	}
+
+	if _, loaded := promotions.LoadOrStore(n, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer promotions.Delete(n)
+
+		// the copies of the blobs in the old store are left for `ollama gc`
+		// since a request may be about to load the model from them
+		store := envconfig.Models()
+		if _, _, err := transferModel(n, store); err != nil {
+			slog.Warn("couldn't promote model", "model", n.DisplayShortest(), "store", store, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/types/model"
+)
+
+// setStores sets OLLAMA_MODELS to n new model stores
+func setStores(t *testing.T, n int) []string {
+	t.Helper()
+
+	var stores []string
+	for range n {
+		stores = append(stores, t.TempDir())
+	}
+
+	t.Setenv("OLLAMA_MODELS", strings.Join(stores, string(filepath.ListSeparator)))
+	return stores
+}
+
+func TestMoveModel(t *testing.T) {
+	stores := setStores(t, 2)
+
+	layer, err := NewLayer(strings.NewReader("weights"), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(strings.NewReader("{}"), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"one", "two"} {
+		if err := WriteManifest(model.ParseName(name), config, []Layer{layer}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := moveModel(model.ParseName("one"), stores[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseNamedManifest(model.ParseName("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := storeOf(m.filepath); got != stores[1] {
+		t.Errorf("expected the manifest in %s, got %s", stores[1], got)
+	}
+
+	// the blobs are still used by two so they're copied
+	for _, store := range stores {
+		for _, digest := range []string{layer.Digest, config.Digest} {
+			if _, err := os.Stat(filepath.Join(store, "blobs", strings.ReplaceAll(digest, ":", "-"))); err != nil {
+				t.Errorf("expected %s in %s: %v", digest, store, err)
+			}
+		}
+	}
+
+	manifests, err := Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifests) != 2 {
+		t.Errorf("expected 2 models, got %d", len(manifests))
+	}
+
+	// moving the last model which uses the blobs moves them
+	if err := moveModel(model.ParseName("two"), stores[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if matches := mustGlob(t, filepath.Join(stores[0], "blobs", "*")); len(matches) > 0 {
+		t.Errorf("expected no blobs in %s, got %v", stores[0], matches)
+	}
+
+	if matches := mustGlob(t, filepath.Join(stores[0], "manifests", "*", "*", "*", "*")); len(matches) > 0 {
+		t.Errorf("expected no manifests in %s, got %v", stores[0], matches)
+	}
+
+	fp, err := GetBlobsPath(layer.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := storeOf(fp); got != stores[1] {
+		t.Errorf("expected the blob to be found in %s, got %s", stores[1], got)
+	}
+
+	if err := moveModel(model.ParseName("three"), stores[1]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+
+	if _, err := findStore(t.TempDir()); !errors.Is(err, errUnknownStore) {
+		t.Errorf("expected %v, got %v", errUnknownStore, err)
+	}
+}
+
+func TestTransferModel(t *testing.T) {
+	stores := setStores(t, 2)
+
+	layer, err := NewLayer(strings.NewReader("weights"), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(strings.NewReader("{}"), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := model.ParseName("one")
+	if err := WriteManifest(n, config, []Layer{layer}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveModel(n, stores[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	from, digests, err := transferModel(n, stores[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if from != stores[1] {
+		t.Errorf("expected the model to be transferred from %s, got %s", stores[1], from)
+	}
+
+	if len(digests) != 2 {
+		t.Errorf("expected 2 digests, got %v", digests)
+	}
+
+	// the copies in the old store are left for gc
+	blobs := func(store string) []string {
+		return mustGlob(t, filepath.Join(store, "blobs", "sha256-*"))
+	}
+
+	if got := blobs(stores[1]); len(got) != 2 {
+		t.Errorf("expected 2 blobs in %s, got %v", stores[1], got)
+	}
+
+	resp, err := collectGarbage(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Removed) != 2 {
+		t.Errorf("expected 2 removed blobs, got %v", resp.Removed)
+	}
+
+	if got := blobs(stores[1]); len(got) > 0 {
+		t.Errorf("expected no blobs in %s, got %v", stores[1], got)
+	}
+
+	if got := blobs(stores[0]); len(got) != 2 {
+		t.Errorf("expected 2 blobs in %s, got %v", stores[0], got)
+	}
+
+	m, err := ParseNamedManifest(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := storeOf(m.filepath); got != stores[0] {
+		t.Errorf("expected the manifest in %s, got %s", stores[0], got)
+	}
+}
+
+func TestPullStore(t *testing.T) {
+	name := newTestPullRegistry(t, 1<<10)
+	stores := setStores(t, 2)
+
+	if err := PullModel(context.Background(), name, &registryOptions{Insecure: true, Store: stores[1]}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if matches := mustGlob(t, filepath.Join(stores[0], "blobs", "*")); len(matches) > 0 {
+		t.Errorf("expected no blobs in %s, got %v", stores[0], matches)
+	}
+
+	m, err := ParseNamedManifest(model.ParseName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := storeOf(m.filepath); got != stores[1] {
+		t.Fatalf("expected the manifest in %s, got %s", stores[1], got)
+	}
+
+	for _, layer := range append(m.Layers, m.Config) {
+		if err := verifyBlob(layer.Digest); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// pulling again updates the model where it is
+	t.Setenv("OLLAMA_PULL_STORE", stores[0])
+	if err := PullModel(context.Background(), name, &registryOptions{Insecure: true}, func(api.ProgressResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if matches := mustGlob(t, filepath.Join(stores[0], "manifests", "*", "*", "*", "*")); len(matches) > 0 {
+		t.Errorf("expected no manifests in %s, got %v", stores[0], matches)
+	}
+}
+
+// readOnly makes every directory in dir read-only until the test ends
+func readOnly(t *testing.T, dir string) {
+	t.Helper()
+
+	var dirs []string
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range dirs {
+		if err := os.Chmod(d, 0o555); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, d := range dirs {
+			os.Chmod(d, 0o755)
+		}
+	})
+}
+
+func TestBaseStore(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", base)
+
+	weights, err := NewLayer(strings.NewReader("weights"), "application/vnd.ollama.image.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := NewLayer(strings.NewReader("{}"), "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteManifest(model.ParseName("base"), config, []Layer{weights}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a blob no model uses and a partial download are left alone in the base
+	if _, err := NewLayer(strings.NewReader("unused"), "application/vnd.ollama.image.model"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(base, "blobs", "sha256-partial"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	user := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", user)
+	t.Setenv("OLLAMA_BASE_MODELS", base)
+	readOnly(t, base)
+
+	// the user store has no blobs yet, but temporary files still go there
+	if blobs, err := GetBlobsPath(""); err != nil {
+		t.Fatal(err)
+	} else if blobs != filepath.Join(user, "blobs") {
+		t.Errorf("expected blobs to be written to %s, got %s", filepath.Join(user, "blobs"), blobs)
+	}
+
+	system, err := NewLayer(strings.NewReader("be brief"), "application/vnd.ollama.image.system")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteManifest(model.ParseName("derived"), config, []Layer{weights, system}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifests) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(manifests))
+	}
+
+	m, err := ParseNamedManifest(model.ParseName("base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Remove(); !errors.Is(err, errReadOnlyStore) {
+		t.Errorf("expected %v, got %v", errReadOnlyStore, err)
+	}
+
+	if err := moveModel(model.ParseName("base"), user); !errors.Is(err, errReadOnlyStore) {
+		t.Errorf("expected %v, got %v", errReadOnlyStore, err)
+	}
+
+	if err := PruneLayers(); err != nil {
+		t.Fatal(err)
+	}
+
+	baseFiles := func() []string {
+		return append(mustGlob(t, filepath.Join(base, "blobs", "*")), mustGlob(t, filepath.Join(base, "manifests", "*", "*", "*", "*"))...)
+	}
+
+	if files := baseFiles(); len(files) != 5 {
+		t.Fatalf("expected the base to be unchanged, got %v", files)
+	}
+
+	// blobs used from the base aren't copied
+	if matches := mustGlob(t, filepath.Join(user, "blobs", "*")); len(matches) != 1 {
+		t.Errorf("expected only the system blob in the user store, got %v", matches)
+	}
+
+	// changing a base model overrides it in the user store
+	if err := WriteManifest(model.ParseName("base"), config, []Layer{weights, system}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = ParseNamedManifest(model.ParseName("base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := storeOf(m.filepath); got != user {
+		t.Errorf("expected the model in %s, got %s", user, got)
+	}
+
+	for _, name := range []string{"base", "derived"} {
+		m, err := ParseNamedManifest(model.ParseName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Remove(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.RemoveLayers(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if matches := mustGlob(t, filepath.Join(user, "blobs", "*")); len(matches) > 0 {
+		t.Errorf("expected no blobs in the user store, got %v", matches)
+	}
+
+	if files := baseFiles(); len(files) != 5 {
+		t.Errorf("expected the base to be unchanged, got %v", files)
+	}
+
+	// the base model is visible again
+	if _, err := ParseNamedManifest(model.ParseName("base")); err != nil {
+		t.Error(err)
+	}
+}